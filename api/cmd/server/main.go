@@ -9,13 +9,52 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/compose"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/cosign"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/gates"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/http/server"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/sbom"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/worker"
 )
 
 func main() {
 	cfg := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg.DatabaseURL, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+	if cfg.ComposePolicyFile != "" {
+		policy, err := compose.LoadPolicy(cfg.ComposePolicyFile)
+		if err != nil {
+			log.Fatalf("compose policy load failed: %v", err)
+		}
+		cfg.ComposePolicy = &policy
+	}
+	if _, err := gates.Parse(cfg.ReleaseGates, nil); err != nil {
+		log.Fatalf("release gates invalid: %v", err)
+	}
+	if !cfg.CosignMode.Valid() || !cfg.ProvenanceMode.Valid() {
+		log.Fatalf("COSIGN_MODE and PROVENANCE_MODE must be off, optional or required")
+	}
+	if cfg.CosignMode.Enabled() || cfg.ProvenanceMode.Enabled() {
+		verifier, err := cosign.LoadVerifier(cfg.CosignRootsFile, cfg.RekorPublicKeyFile)
+		if err != nil {
+			log.Fatalf("cosign trust roots load failed: %v", err)
+		}
+		cfg.Cosign = verifier
+	}
+	if cfg.VulnDBFile != "" {
+		vulnDB, err := sbom.OpenVulnDB(cfg.VulnDBFile)
+		if err != nil {
+			log.Fatalf("vulnerability db load failed: %v", err)
+		}
+		cfg.VulnDB = vulnDB
+	}
 
 	gormDB, err := db.Connect(cfg.DatabaseURL)
 	if err != nil {
@@ -31,6 +70,34 @@ func main() {
 	if err := db.Migrate(context.Background(), gormDB); err != nil {
 		log.Fatalf("db migrate failed: %v", err)
 	}
+	if cfg.DownloadHashSecret == "" {
+		// Every replica and restart must hash clients alike, or dedup and
+		// the per-IP cap miss repeats, so the secret is kept in the database.
+		secret, err := store.LoadOrCreateSecret(context.Background(), gormDB, "download_hash")
+		if err != nil {
+			log.Fatalf("download hash secret: %v", err)
+		}
+		cfg.DownloadHashSecret = secret
+		log.Printf("DOWNLOAD_HASH_SECRET not set; using the secret stored in the database")
+	}
+
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go worker.Every(workerCtx, "download recompute", cfg.DownloadRecomputeInterval, func(ctx context.Context) error {
+		// Events within the dedup window are still needed to spot repeats.
+		retention := max(cfg.DownloadEventRetention, cfg.DownloadDedupWindow)
+		if err := store.RollupDownloadEvents(ctx, gormDB, time.Now().Add(-retention)); err != nil {
+			return err
+		}
+		return store.RecomputeDownloads(ctx, gormDB, cfg.TrendingHalfLife)
+	})
+	pruneInterval := time.Hour
+	if cfg.PublishEventRetention <= 0 {
+		pruneInterval = 0
+	}
+	go worker.Every(workerCtx, "publish event prune", pruneInterval, func(ctx context.Context) error {
+		return store.PrunePublishEvents(ctx, gormDB, time.Now().Add(-cfg.PublishEventRetention))
+	})
 
 	h := server.New(cfg, gormDB)
 
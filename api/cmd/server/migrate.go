@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+)
+
+const migrateUsage = "usage: server migrate up [version] | down [steps] | status"
+
+// runMigrate implements `server migrate`: up applies pending migrations (up
+// to version), down reverts the last steps migrations (default 1) and status
+// lists them.
+func runMigrate(databaseURL string, args []string) error {
+	if len(args) == 0 || len(args) > 2 || (args[0] != "up" && args[0] != "down" && args[0] != "status") ||
+		(args[0] == "status" && len(args) != 1) {
+		return errors.New(migrateUsage)
+	}
+	n := 0
+	if len(args) == 2 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil || v < 1 {
+			return fmt.Errorf("%s: %q is not a positive number", migrateUsage, args[1])
+		}
+		n = v
+	}
+
+	gormDB, err := db.Connect(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		sqlDB, err := gormDB.DB()
+		if err == nil {
+			_ = sqlDB.Close()
+		}
+	}()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		if n == 0 {
+			n = db.LatestVersion()
+		}
+		if err := db.MigrateUp(ctx, gormDB, n); err != nil {
+			return err
+		}
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		if err := db.MigrateDown(ctx, gormDB, n); err != nil {
+			return err
+		}
+	}
+
+	statuses, current, err := db.Status(ctx, gormDB)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d, binary version %d\n", current, db.LatestVersion())
+	if current > db.LatestVersion() {
+		return fmt.Errorf("%w: upgrade the binary", db.ErrSchemaTooNew)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package compose
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Violation is a single policy breach. Path is the location in the compose
+// file, e.g. "services.spotify.volumes[0]".
+type Violation struct {
+	Service string `json:"service,omitempty"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// PolicyError carries every violation found in a compose file.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.Path+": "+v.Message)
+	}
+	return "compose_file violates policy: " + strings.Join(parts, "; ")
+}
+
+type file struct {
+	Services map[string]service `yaml:"services"`
+	Volumes  map[string]*struct {
+		DriverOpts map[string]string `yaml:"driver_opts"`
+	} `yaml:"volumes"`
+}
+
+type service struct {
+	Image       string   `yaml:"image"`
+	Volumes     []any    `yaml:"volumes"`
+	Ports       []any    `yaml:"ports"`
+	Privileged  bool     `yaml:"privileged"`
+	NetworkMode string   `yaml:"network_mode"`
+	CapAdd      []string `yaml:"cap_add"`
+	Devices     []any    `yaml:"devices"`
+}
+
+var variablePattern = regexp.MustCompile(`\$\{?([A-Za-z_][A-Za-z0-9_]*)`)
+
+// Check parses content and returns a *PolicyError listing every violation,
+// or nil when the file satisfies policy.
+func Check(content string, policy Policy) error {
+	violations := Analyze(content, policy)
+	if len(violations) == 0 {
+		return nil
+	}
+	return &PolicyError{Violations: violations}
+}
+
+func Analyze(content string, policy Policy) []Violation {
+	out := []Violation{}
+	add := func(service, path, format string, args ...any) {
+		out = append(out, Violation{Service: service, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	referenced := map[string]bool{}
+	for _, match := range variablePattern.FindAllStringSubmatch(content, -1) {
+		referenced[match[1]] = true
+	}
+	for _, name := range policy.RequiredVariables {
+		if !referenced[name] {
+			add("", "$", "must reference %s", name)
+		}
+	}
+	for _, name := range policy.DeniedVariables {
+		if referenced[name] {
+			add("", "$", "must not reference %s", name)
+		}
+	}
+
+	var doc file
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		add("", "$", "invalid compose yaml: %v", err)
+		return out
+	}
+	if len(doc.Services) == 0 {
+		add("", "services", "must define services")
+	}
+
+	names := make([]string, 0, len(doc.Services))
+	for name := range doc.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		svc := doc.Services[name]
+		base := "services." + name
+		if strings.TrimSpace(svc.Image) == "" {
+			add(name, base+".image", "image is required")
+		}
+		if svc.Privileged && !policy.AllowPrivileged {
+			add(name, base+".privileged", "privileged containers are not allowed")
+		}
+		if strings.EqualFold(strings.TrimSpace(svc.NetworkMode), "host") && !policy.AllowHostNetwork {
+			add(name, base+".network_mode", "host networking is not allowed")
+		}
+		for i, capability := range svc.CapAdd {
+			normalized := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(capability)), "CAP_")
+			if !containsFold(policy.AllowedCapabilities, normalized) {
+				add(name, fmt.Sprintf("%s.cap_add[%d]", base, i), "capability %s is not allowed", normalized)
+			}
+		}
+		for i, raw := range svc.Volumes {
+			at := fmt.Sprintf("%s.volumes[%d]", base, i)
+			kind, source, err := parseVolume(raw)
+			if err != nil {
+				add(name, at, "%v", err)
+				continue
+			}
+			checkMount(policy, kind, source, func(format string, args ...any) { add(name, at, format, args...) })
+		}
+		for i, raw := range svc.Devices {
+			at := fmt.Sprintf("%s.devices[%d]", base, i)
+			device, err := parseDevice(raw)
+			if err != nil {
+				add(name, at, "%v", err)
+				continue
+			}
+			if !matchesAny(policy.AllowedDevices, device) {
+				add(name, at, "device %s is not allowed", device)
+			}
+		}
+		for i, raw := range svc.Ports {
+			at := fmt.Sprintf("%s.ports[%d]", base, i)
+			published, err := parsePublishedPort(raw)
+			if err != nil {
+				add(name, at, "%v", err)
+				continue
+			}
+			if published != "" && !containsFold(policy.AllowedHostPorts, published) {
+				add(name, at, "publishing host port %s is not allowed", published)
+			}
+		}
+	}
+
+	volumeNames := make([]string, 0, len(doc.Volumes))
+	for name := range doc.Volumes {
+		volumeNames = append(volumeNames, name)
+	}
+	sort.Strings(volumeNames)
+	for _, name := range volumeNames {
+		vol := doc.Volumes[name]
+		// A local volume with "o: bind" is a bind mount of driver_opts.device.
+		if vol == nil || !strings.Contains(vol.DriverOpts["o"], "bind") {
+			continue
+		}
+		checkMount(policy, "bind", vol.DriverOpts["device"], func(format string, args ...any) {
+			add("", "volumes."+name+".driver_opts.device", format, args...)
+		})
+	}
+	return out
+}
+
+func checkMount(policy Policy, kind, source string, fail func(format string, args ...any)) {
+	switch kind {
+	case "bind":
+		if strings.Contains(source, "..") {
+			fail("bind mount %s must not contain ..", source)
+			return
+		}
+		for _, prefix := range policy.AllowedBindPrefixes {
+			if strings.HasPrefix(source, prefix) {
+				return
+			}
+		}
+		fail("bind mount %s is outside the allowed roots", source)
+	case "volume":
+		if source != "" && !policy.AllowNamedVolumes {
+			fail("named volume %s is not allowed", source)
+		}
+	case "tmpfs":
+	default:
+		fail("volume type %s is not allowed", kind)
+	}
+}
+
+// parseVolume returns the mount type ("bind", "volume" or "tmpfs") and source
+// of a short ("src:dst[:mode]") or long syntax volume entry.
+func parseVolume(raw any) (string, string, error) {
+	switch v := raw.(type) {
+	case string:
+		parts := splitOutsideBraces(v)
+		if len(parts) == 1 {
+			return "volume", "", nil
+		}
+		source := parts[0]
+		if isHostPath(source) {
+			return "bind", source, nil
+		}
+		return "volume", source, nil
+	case map[string]any:
+		kind, _ := v["type"].(string)
+		source, _ := v["source"].(string)
+		if kind == "" {
+			kind = "volume"
+		}
+		return kind, source, nil
+	}
+	return "", "", fmt.Errorf("unsupported volume syntax")
+}
+
+func parseDevice(raw any) (string, error) {
+	switch v := raw.(type) {
+	case string:
+		return splitOutsideBraces(v)[0], nil
+	case map[string]any:
+		source, _ := v["source"].(string)
+		if source != "" {
+			return source, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported device syntax")
+}
+
+// parsePublishedPort returns the host side of a port mapping, or "" when the
+// port is only exposed to the container network.
+func parsePublishedPort(raw any) (string, error) {
+	switch v := raw.(type) {
+	case int:
+		return "", nil
+	case string:
+		spec, _, _ := strings.Cut(v, "/")
+		parts := splitOutsideBraces(spec)
+		switch len(parts) {
+		case 1:
+			return "", nil
+		case 2:
+			return parts[0], nil
+		case 3:
+			return parts[1], nil
+		}
+	case map[string]any:
+		switch published := v["published"].(type) {
+		case nil:
+			return "", nil
+		case int:
+			return fmt.Sprint(published), nil
+		case string:
+			return published, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported port syntax")
+}
+
+func isHostPath(source string) bool {
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") ||
+		strings.HasPrefix(source, "~") || strings.HasPrefix(source, "$")
+}
+
+// splitOutsideBraces splits on ':' except inside ${...}, so defaults like
+// ${ROOT:-/srv} stay intact.
+func splitOutsideBraces(value string) []string {
+	parts := []string{}
+	depth, start := 0, 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+		case ':':
+			if depth == 0 {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, value[start:])
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package compose
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnalyzeReportsEveryViolation(t *testing.T) {
+	content := `
+services:
+  app:
+    image: ghcr.io/acme/app:1.0.0
+    privileged: true
+    network_mode: host
+    cap_add: [NET_ADMIN, CAP_SYS_TIME]
+    devices:
+      - /dev/ttyUSB0:/dev/ttyUSB0
+    ports:
+      - "8080:80"
+      - "127.0.0.1:9000:9000/udp"
+      - "3000"
+      - target: 80
+        published: 8081
+    volumes:
+      - ${INTEGRATIONS_ROOT}/integrations/app:/data
+      - ${INTEGRATIONS_ROOT}/../secrets:/secrets
+      - /var/run/docker.sock:/var/run/docker.sock
+      - cache:/cache
+      - type: bind
+        source: ./config
+        target: /config
+  sidecar:
+    volumes:
+      - ${HOMENAVI_ROOT:-/srv}/data:/data
+volumes:
+  cache: {}
+  sneaky:
+    driver_opts:
+      type: none
+      o: bind
+      device: /etc
+`
+	got := map[string]bool{}
+	for _, v := range Analyze(content, DefaultPolicy()) {
+		got[v.Path] = true
+	}
+	want := []string{
+		"$",
+		"services.app.privileged",
+		"services.app.network_mode",
+		"services.app.cap_add[0]",
+		"services.app.cap_add[1]",
+		"services.app.devices[0]",
+		"services.app.ports[0]",
+		"services.app.ports[1]",
+		"services.app.ports[3]",
+		"services.app.volumes[1]",
+		"services.app.volumes[2]",
+		"services.app.volumes[4]",
+		"services.sidecar.image",
+		"services.sidecar.volumes[0]",
+		"volumes.sneaky.driver_opts.device",
+	}
+	for _, path := range want {
+		if !got[path] {
+			t.Errorf("expected violation at %s", path)
+		}
+	}
+	for _, path := range []string{"services.app.ports[2]", "services.app.volumes[0]", "services.app.volumes[3]"} {
+		if got[path] {
+			t.Errorf("unexpected violation at %s", path)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d violation paths, got %v", len(want), got)
+	}
+}
+
+func TestLoadPolicyKeepsDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("allowed_devices: [\"/dev/ttyUSB*\"]\nallowed_capabilities: [NET_ADMIN]\n"), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("load policy: %v", err)
+	}
+	if !policy.AllowNamedVolumes || len(policy.AllowedBindPrefixes) == 0 {
+		t.Fatalf("expected defaults to be kept, got %+v", policy)
+	}
+	content := "services:\n  app:\n    image: app\n    cap_add: [net_admin]\n    devices: [\"/dev/ttyUSB1:/dev/ttyUSB1\"]\n    volumes: [\"${INTEGRATIONS_ROOT}/app:/data\"]\n"
+	if violations := Analyze(content, policy); len(violations) != 0 {
+		t.Fatalf("expected no violations, got %+v", violations)
+	}
+}
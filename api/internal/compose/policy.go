@@ -0,0 +1,54 @@
+package compose
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Policy decides which compose features an integration may use. Empty
+// allow-lists deny everything of that kind.
+type Policy struct {
+	// RequiredVariables must each be referenced somewhere in the file.
+	RequiredVariables []string `yaml:"required_variables" json:"required_variables"`
+	// DeniedVariables must not be referenced anywhere in the file.
+	DeniedVariables []string `yaml:"denied_variables" json:"denied_variables"`
+	// AllowedBindPrefixes lists the host path prefixes bind mounts may use.
+	AllowedBindPrefixes []string `yaml:"allowed_bind_prefixes" json:"allowed_bind_prefixes"`
+	AllowNamedVolumes   bool     `yaml:"allow_named_volumes" json:"allow_named_volumes"`
+	AllowPrivileged     bool     `yaml:"allow_privileged" json:"allow_privileged"`
+	AllowHostNetwork    bool     `yaml:"allow_host_network" json:"allow_host_network"`
+	// AllowedCapabilities lists cap_add entries, without the CAP_ prefix.
+	AllowedCapabilities []string `yaml:"allowed_capabilities" json:"allowed_capabilities"`
+	// AllowedDevices lists host device paths; path.Match patterns are accepted.
+	AllowedDevices []string `yaml:"allowed_devices" json:"allowed_devices"`
+	// AllowedHostPorts lists published host ports as written in the file,
+	// e.g. "8080" or "9000-9010".
+	AllowedHostPorts []string `yaml:"allowed_host_ports" json:"allowed_host_ports"`
+}
+
+// DefaultPolicy only allows named volumes and bind mounts below
+// ${INTEGRATIONS_ROOT}.
+func DefaultPolicy() Policy {
+	return Policy{
+		RequiredVariables:   []string{"INTEGRATIONS_ROOT"},
+		DeniedVariables:     []string{"HOMENAVI_ROOT"},
+		AllowedBindPrefixes: []string{"${INTEGRATIONS_ROOT}/", "$INTEGRATIONS_ROOT/"},
+		AllowNamedVolumes:   true,
+	}
+}
+
+// LoadPolicy reads a YAML or JSON policy file. Keys missing from the file
+// keep their DefaultPolicy value.
+func LoadPolicy(path string) (Policy, error) {
+	policy := DefaultPolicy()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policy, err
+	}
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return policy, fmt.Errorf("compose policy %s invalid: %w", path, err)
+	}
+	return policy, nil
+}
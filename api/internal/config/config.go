@@ -1,8 +1,15 @@
 package config
 
 import (
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/compose"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/cosign"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/sbom"
 )
 
 type Config struct {
@@ -14,6 +21,84 @@ type Config struct {
 	OIDCVerifyWorkflow string
 	OIDCTagPrefix      string
 	GitHubAPIToken     string
+	PrereleaseLatest   bool
+	AdminTokens        []string
+	VerifyImages       bool
+
+	OIDCProviders []string
+	// ReleaseGates are the gates.Parse specs GitHub publishes must pass;
+	// defaults to "workflow:" + OIDCVerifyWorkflow.
+	ReleaseGates []string
+
+	// JWKSCacheTTL applies when a JWKS response carries no cache headers.
+	// Advertised lifetimes are clamped to [JWKSMinRefreshInterval, JWKSMaxTTL],
+	// and JWKSMinRefreshInterval also rate-limits refetches on an unknown kid.
+	JWKSCacheTTL           time.Duration
+	JWKSMaxTTL             time.Duration
+	JWKSMinRefreshInterval time.Duration
+
+	ComposePolicyFile string
+	// ComposePolicy is loaded from ComposePolicyFile at startup; nil means
+	// compose.DefaultPolicy.
+	ComposePolicy *compose.Policy
+	// PublishHTTP fetches manifest_url and compose_file on publish. Load
+	// leaves it nil, which means a client that only reaches public https URLs.
+	PublishHTTP *http.Client
+
+	CosignMode         cosign.Mode
+	ProvenanceMode     cosign.Mode
+	CosignRootsFile    string
+	RekorPublicKeyFile string
+	// Cosign is loaded from CosignRootsFile and RekorPublicKeyFile at startup
+	// when either mode is enabled.
+	Cosign *cosign.Verifier
+
+	// DownloadDedupWindow is how long repeat downloads of a release by one
+	// client (IP and install id) are ignored. Within it, at most
+	// DownloadInstallsPerIP install ids reporting from one IP are counted; 0
+	// removes the cap. DownloadRateLimit caps download reports per client per
+	// minute; 0 disables it.
+	DownloadDedupWindow       time.Duration
+	DownloadInstallsPerIP     int
+	DownloadRateLimit         int
+	DownloadHashSecret        string
+	DownloadRecomputeInterval time.Duration
+	// TrendingHalfLife is how quickly a download's weight in trending_score
+	// halves. Download events older than DownloadEventRetention are rolled up
+	// into daily totals.
+	TrendingHalfLife       time.Duration
+	DownloadEventRetention time.Duration
+	// PublishEventRetention is how long publish events and unauthenticated
+	// publish attempt counts are kept; zero keeps them forever.
+	PublishEventRetention time.Duration
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For.
+	TrustProxyHeaders bool
+
+	VulnDBFile string
+	// VulnDB is opened from VulnDBFile at startup; nil disables matching.
+	VulnDB *sbom.VulnDB
+
+	GitLabOIDCIssuer   string
+	GitLabOIDCAudience string
+	GitLabAPIToken     string
+	GitLabVerifyJob    string
+
+	GenericOIDCIssuer    string
+	GenericOIDCJWKSURL   string
+	GenericOIDCAudience  string
+	GenericOIDCRepoClaim string
+	GenericOIDCRefClaim  string
+	GenericOIDCSHAClaim  string
+	// GenericOIDCRefTypeClaim names the claim that says whether the ref is a
+	// tag or a branch. It is required; bare refs are never taken as tags.
+	GenericOIDCRefTypeClaim string
+	// GenericOIDCWorkflowClaim and GenericOIDCAllowedWorkflows gate generic
+	// publishes on the workflow that requested the token. With no allowed
+	// workflows every generic publish is refused.
+	GenericOIDCWorkflowClaim       string
+	GenericOIDCAllowedWorkflows    []string
+	GenericOIDCRepoURLBase         string
+	GenericOIDCManifestURLTemplate string
 }
 
 func Load() Config {
@@ -25,6 +110,9 @@ func Load() Config {
 	verifyWorkflow := getEnv("OIDC_VERIFY_WORKFLOW", "verify.yml")
 	tagPrefix := getEnv("OIDC_TAG_PREFIX", "v")
 	githubToken := os.Getenv("GITHUB_API_TOKEN")
+	prereleaseLatest := getEnvBool("LATEST_INCLUDE_PRERELEASE", false)
+	adminTokens := splitCSV(os.Getenv("ADMIN_TOKENS"))
+	providers := splitCSV(getEnv("OIDC_PROVIDERS", "github"))
 
 	return Config{
 		BindAddress:        bind,
@@ -35,6 +123,52 @@ func Load() Config {
 		OIDCVerifyWorkflow: verifyWorkflow,
 		OIDCTagPrefix:      tagPrefix,
 		GitHubAPIToken:     githubToken,
+		PrereleaseLatest:   prereleaseLatest,
+		AdminTokens:        adminTokens,
+		VerifyImages:       getEnvBool("VERIFY_IMAGES", true),
+
+		OIDCProviders: providers,
+		ReleaseGates:  splitCSV(getEnv("RELEASE_GATES", "workflow:"+verifyWorkflow)),
+
+		JWKSCacheTTL:           getEnvDuration("JWKS_CACHE_TTL", 30*time.Minute),
+		JWKSMaxTTL:             getEnvDuration("JWKS_MAX_TTL", 24*time.Hour),
+		JWKSMinRefreshInterval: getEnvDuration("JWKS_MIN_REFRESH_INTERVAL", time.Minute),
+
+		ComposePolicyFile: os.Getenv("COMPOSE_POLICY_FILE"),
+
+		CosignMode:         cosign.Mode(getEnv("COSIGN_MODE", string(cosign.ModeOff))),
+		ProvenanceMode:     cosign.Mode(getEnv("PROVENANCE_MODE", string(cosign.ModeOff))),
+		CosignRootsFile:    os.Getenv("COSIGN_FULCIO_ROOTS_FILE"),
+		RekorPublicKeyFile: os.Getenv("COSIGN_REKOR_PUBLIC_KEY_FILE"),
+
+		DownloadDedupWindow:       getEnvDuration("DOWNLOAD_DEDUP_WINDOW", 24*time.Hour),
+		DownloadInstallsPerIP:     getEnvInt("DOWNLOAD_INSTALLS_PER_IP", 5),
+		DownloadRateLimit:         getEnvInt("DOWNLOAD_RATE_LIMIT", 30),
+		DownloadHashSecret:        os.Getenv("DOWNLOAD_HASH_SECRET"),
+		DownloadRecomputeInterval: getEnvDuration("DOWNLOAD_RECOMPUTE_INTERVAL", 15*time.Minute),
+		TrendingHalfLife:          getEnvDuration("TRENDING_HALF_LIFE", 7*24*time.Hour),
+		DownloadEventRetention:    getEnvDuration("DOWNLOAD_EVENT_RETENTION", 30*24*time.Hour),
+		PublishEventRetention:     getEnvDuration("PUBLISH_EVENT_RETENTION", 90*24*time.Hour),
+		TrustProxyHeaders:         getEnvBool("TRUST_PROXY_HEADERS", false),
+
+		VulnDBFile: os.Getenv("VULN_DB_FILE"),
+
+		GitLabOIDCIssuer:   getEnv("GITLAB_OIDC_ISSUER", "https://gitlab.com"),
+		GitLabOIDCAudience: getEnv("GITLAB_OIDC_AUDIENCE", audience),
+		GitLabAPIToken:     os.Getenv("GITLAB_API_TOKEN"),
+		GitLabVerifyJob:    getEnv("GITLAB_VERIFY_JOB", "verify"),
+
+		GenericOIDCIssuer:              os.Getenv("GENERIC_OIDC_ISSUER"),
+		GenericOIDCJWKSURL:             os.Getenv("GENERIC_OIDC_JWKS_URL"),
+		GenericOIDCAudience:            getEnv("GENERIC_OIDC_AUDIENCE", audience),
+		GenericOIDCRepoClaim:           getEnv("GENERIC_OIDC_REPO_CLAIM", "repository"),
+		GenericOIDCRefClaim:            getEnv("GENERIC_OIDC_REF_CLAIM", "ref"),
+		GenericOIDCSHAClaim:            getEnv("GENERIC_OIDC_SHA_CLAIM", "sha"),
+		GenericOIDCRefTypeClaim:        os.Getenv("GENERIC_OIDC_REF_TYPE_CLAIM"),
+		GenericOIDCWorkflowClaim:       getEnv("GENERIC_OIDC_WORKFLOW_CLAIM", "workflow_ref"),
+		GenericOIDCAllowedWorkflows:    splitCSV(os.Getenv("GENERIC_OIDC_ALLOWED_WORKFLOWS")),
+		GenericOIDCRepoURLBase:         os.Getenv("GENERIC_OIDC_REPO_URL_BASE"),
+		GenericOIDCManifestURLTemplate: os.Getenv("GENERIC_OIDC_MANIFEST_URL_TEMPLATE"),
 	}
 }
 
@@ -45,6 +179,30 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getEnvBool(key string, fallback bool) bool {
+	v, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return fallback
+	}
+	return v
+}
+
+func getEnvInt(key string, fallback int) int {
+	v, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil || v < 0 {
+		return fallback
+	}
+	return v
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v, err := time.ParseDuration(strings.TrimSpace(os.Getenv(key)))
+	if err != nil || v <= 0 {
+		return fallback
+	}
+	return v
+}
+
 func splitCSV(value string) []string {
 	if strings.TrimSpace(value) == "" {
 		return nil
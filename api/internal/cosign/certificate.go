@@ -0,0 +1,145 @@
+package cosign
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"strings"
+)
+
+// Fulcio certificate extensions, see
+// https://github.com/sigstore/fulcio/blob/main/docs/oid-info.md.
+var (
+	oidIssuerV1         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+	oidBuildSignerURI   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 9}
+	oidSourceRepository = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 12}
+	oidSourceDigest     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 13}
+	oidSourceRef        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 14}
+)
+
+// verifyCertificate checks the signing certificate in annotations against
+// the Fulcio roots at the time Rekor logged the entry, then binds it to
+// identity.
+func (v *Verifier) verifyCertificate(annotations map[string]string, identity Identity) (*Signer, *x509.Certificate, error) {
+	certs, err := parseCertificates(annotations[annotationCertificate])
+	if err != nil || len(certs) == 0 {
+		return nil, nil, fmt.Errorf("%w: signing certificate missing", ErrVerification)
+	}
+	leaf := certs[0]
+	entry, err := v.verifyBundle(annotations[annotationBundle])
+	if err != nil {
+		return nil, nil, err
+	}
+	intermediates := x509.NewCertPool()
+	chain, err := parseCertificates(annotations[annotationChain])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: certificate chain invalid", ErrVerification)
+	}
+	for _, cert := range chain {
+		intermediates.AddCert(cert)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   entry.IntegratedTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, nil, fmt.Errorf("%w: certificate: %v", ErrVerification, err)
+	}
+
+	signer := signerFromCertificate(leaf)
+	signer.LogIndex = entry.LogIndex
+	signer.IntegratedTime = entry.IntegratedTime
+	signer.logEntry = entry.Body
+	if err := matchIdentity(signer, identity); err != nil {
+		return nil, nil, err
+	}
+	return signer, leaf, nil
+}
+
+func parseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return certs, nil
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+func signerFromCertificate(cert *x509.Certificate) *Signer {
+	signer := &Signer{}
+	if len(cert.URIs) > 0 {
+		signer.Subject = cert.URIs[0].String()
+	} else if len(cert.EmailAddresses) > 0 {
+		signer.Subject = cert.EmailAddresses[0]
+	}
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV1):
+			if signer.Issuer == "" {
+				signer.Issuer = string(ext.Value)
+			}
+		case ext.Id.Equal(oidIssuerV2):
+			signer.Issuer = extensionString(ext.Value)
+		case ext.Id.Equal(oidBuildSignerURI):
+			signer.BuildSignerURI = extensionString(ext.Value)
+		case ext.Id.Equal(oidSourceRepository):
+			signer.SourceRepository = extensionString(ext.Value)
+		case ext.Id.Equal(oidSourceDigest):
+			signer.SourceDigest = extensionString(ext.Value)
+		case ext.Id.Equal(oidSourceRef):
+			signer.SourceRef = extensionString(ext.Value)
+		}
+	}
+	return signer
+}
+
+// extensionString decodes the DER UTF8String used by the newer Fulcio
+// extensions.
+func extensionString(value []byte) string {
+	var out string
+	if _, err := asn1.UnmarshalWithParams(value, &out, "utf8"); err != nil {
+		return string(value)
+	}
+	return out
+}
+
+// matchIdentity binds the certificate to the publishing repository and,
+// when known, the workflow and commit. The SAN is used when the certificate
+// predates the source repository extension.
+func matchIdentity(signer *Signer, identity Identity) error {
+	if signer.Issuer != identity.Issuer {
+		return fmt.Errorf("%w: certificate issuer %q does not match %q", ErrVerification, signer.Issuer, identity.Issuer)
+	}
+	repository := strings.TrimSuffix(identity.RepositoryURL, "/")
+	if signer.SourceRepository != "" {
+		if !strings.EqualFold(signer.SourceRepository, repository) {
+			return fmt.Errorf("%w: signed by repository %s, expected %s", ErrVerification, signer.SourceRepository, repository)
+		}
+	} else if !strings.HasPrefix(strings.ToLower(signer.Subject), strings.ToLower(repository)+"/") {
+		return fmt.Errorf("%w: signed by %s, expected a workflow in %s", ErrVerification, signer.Subject, repository)
+	}
+	if identity.WorkflowURL != "" {
+		workflow := signer.BuildSignerURI
+		if workflow == "" {
+			workflow = signer.Subject
+		}
+		if !strings.EqualFold(workflow, identity.WorkflowURL) {
+			return fmt.Errorf("%w: signed by workflow %s, expected %s", ErrVerification, workflow, identity.WorkflowURL)
+		}
+	}
+	if identity.SHA != "" && signer.SourceDigest != "" && !strings.EqualFold(signer.SourceDigest, identity.SHA) {
+		return fmt.Errorf("%w: signed at commit %s, expected %s", ErrVerification, signer.SourceDigest, identity.SHA)
+	}
+	return nil
+}
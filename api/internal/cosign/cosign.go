@@ -0,0 +1,235 @@
+package cosign
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/oci"
+)
+
+const (
+	mediaTypeSimpleSigning = "application/vnd.dev.cosign.simplesigning.v1+json"
+	mediaTypeDSSE          = "application/vnd.dsse.envelope.v1+json"
+
+	annotationSignature   = "dev.cosignproject.cosign/signature"
+	annotationCertificate = "dev.sigstore.cosign/certificate"
+	annotationChain       = "dev.sigstore.cosign/chain"
+	annotationBundle      = "dev.sigstore.cosign/bundle"
+
+	maxBlobSize = 4 << 20
+)
+
+var (
+	// ErrNotFound means the image has no signature or attestation of the
+	// requested kind.
+	ErrNotFound = errors.New("not found")
+	// ErrVerification means a signature or attestation exists but does not
+	// verify or is not bound to the expected identity.
+	ErrVerification = errors.New("verification failed")
+)
+
+// Mode controls whether a check is skipped, run when evidence exists, or
+// required.
+type Mode string
+
+const (
+	ModeOff      Mode = "off"
+	ModeOptional Mode = "optional"
+	ModeRequired Mode = "required"
+)
+
+func (m Mode) Valid() bool {
+	return m == ModeOff || m == ModeOptional || m == ModeRequired
+}
+
+// Enabled reports whether the check runs; the zero value means off.
+func (m Mode) Enabled() bool {
+	return m == ModeOptional || m == ModeRequired
+}
+
+// Identity is the signer a keyless certificate must have been issued to.
+// WorkflowURL and SHA are only compared when set.
+type Identity struct {
+	Issuer        string
+	RepositoryURL string
+	WorkflowURL   string
+	SHA           string
+}
+
+// Signer describes a verified keyless certificate and its transparency log
+// entry.
+type Signer struct {
+	Issuer           string
+	Subject          string
+	SourceRepository string
+	SourceRef        string
+	SourceDigest     string
+	BuildSignerURI   string
+	LogIndex         int64
+	IntegratedTime   time.Time
+
+	// logEntry is the verified Rekor entry body.
+	logEntry []byte
+}
+
+// Verifier checks cosign keyless signatures and attestations stored next to
+// an image with cosign's tag scheme (sha256-<hex>.sig and .att). Certificates
+// must chain to Roots and carry a Rekor signed entry timestamp from RekorKey;
+// the certificate is checked at the time the entry was logged.
+type Verifier struct {
+	OCI      *oci.Client
+	Roots    *x509.CertPool
+	RekorKey crypto.PublicKey
+}
+
+func NewVerifier(roots *x509.CertPool, rekorKey crypto.PublicKey) *Verifier {
+	return &Verifier{OCI: oci.NewClient(), Roots: roots, RekorKey: rekorKey}
+}
+
+// LoadVerifier reads a PEM bundle of Fulcio root certificates and the PEM
+// Rekor public key.
+func LoadVerifier(rootsFile, rekorKeyFile string) (*Verifier, error) {
+	rootsPEM, err := os.ReadFile(rootsFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(rootsPEM) {
+		return nil, fmt.Errorf("%s: no certificates", rootsFile)
+	}
+	keyPEM, err := os.ReadFile(rekorKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM public key", rekorKeyFile)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", rekorKeyFile, err)
+	}
+	return NewVerifier(roots, key), nil
+}
+
+// VerifySignature checks that a cosign signature of image's digest was made
+// by identity. It returns ErrNotFound when the image is unsigned.
+func (v *Verifier) VerifySignature(ctx context.Context, image oci.Image, digest string, identity Identity) (*Signer, error) {
+	manifest, err := v.sidecar(ctx, image, digest, ".sig")
+	if err != nil {
+		return nil, err
+	}
+	var firstErr error
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != mediaTypeSimpleSigning {
+			continue
+		}
+		signer, err := v.verifySignatureLayer(ctx, image, digest, layer, identity)
+		if err == nil {
+			return signer, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		return nil, fmt.Errorf("signature %w", ErrNotFound)
+	}
+	return nil, firstErr
+}
+
+func (v *Verifier) verifySignatureLayer(ctx context.Context, image oci.Image, digest string, layer oci.Descriptor, identity Identity) (*Signer, error) {
+	payload, err := v.blob(ctx, image, layer)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(layer.Annotations[annotationSignature])
+	if err != nil || len(signature) == 0 {
+		return nil, fmt.Errorf("%w: signature annotation missing", ErrVerification)
+	}
+	var simple struct {
+		Critical struct {
+			Type  string `json:"type"`
+			Image struct {
+				Digest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &simple); err != nil {
+		return nil, fmt.Errorf("%w: signature payload invalid", ErrVerification)
+	}
+	if simple.Critical.Type != "cosign container image signature" || simple.Critical.Image.Digest != digest {
+		return nil, fmt.Errorf("%w: signature is not for %s", ErrVerification, digest)
+	}
+	signer, cert, err := v.verifyCertificate(layer.Annotations, identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyBlobSignature(cert.PublicKey, payload, signature); err != nil {
+		return nil, err
+	}
+	if err := checkHashedRekord(signer.logEntry, payload, signature, cert); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// sidecar fetches the cosign signature or attestation manifest for digest.
+func (v *Verifier) sidecar(ctx context.Context, image oci.Image, digest, suffix string) (*oci.Manifest, error) {
+	algorithm, hexDigest, ok := strings.Cut(digest, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid digest %q", digest)
+	}
+	manifest, _, err := v.OCI.Manifest(ctx, image.Registry, image.Repository, algorithm+"-"+hexDigest+suffix, oci.MediaTypeOCIManifest, oci.MediaTypeDockerManifest)
+	if errors.Is(err, oci.ErrNotFound) {
+		return nil, fmt.Errorf("%s %w", strings.TrimPrefix(suffix, "."), ErrNotFound)
+	}
+	return manifest, err
+}
+
+// blob downloads a layer and checks it against its digest, since the
+// signature covers the content rather than the registry's say-so.
+func (v *Verifier) blob(ctx context.Context, image oci.Image, layer oci.Descriptor) ([]byte, error) {
+	data, err := v.OCI.Blob(ctx, image.Registry, image.Repository, layer.Digest, maxBlobSize)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != layer.Digest {
+		return nil, fmt.Errorf("%w: layer %s content does not match its digest", ErrVerification, layer.Digest)
+	}
+	return data, nil
+}
+
+func verifyBlobSignature(key crypto.PublicKey, data, signature []byte) error {
+	sum := sha256.Sum256(data)
+	var ok bool
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, sum[:], signature)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], signature) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, data, signature)
+	default:
+		return fmt.Errorf("%w: unsupported key type %T", ErrVerification, key)
+	}
+	if !ok {
+		return fmt.Errorf("%w: signature does not match", ErrVerification)
+	}
+	return nil
+}
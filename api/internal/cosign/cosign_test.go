@@ -0,0 +1,353 @@
+package cosign
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/oci"
+)
+
+const (
+	testIssuer   = "https://token.actions.githubusercontent.com"
+	testRepo     = "https://github.com/petoadam/homenavi-spotify"
+	testWorkflow = "https://github.com/petoadam/homenavi-spotify/.github/workflows/release.yml@refs/tags/v1.0.0"
+)
+
+type fixture struct {
+	t         *testing.T
+	issuer    string
+	caKey     *ecdsa.PrivateKey
+	caCert    *x509.Certificate
+	rekorKey  *ecdsa.PrivateKey
+	digest    string
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	logIndex  int64
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test fulcio"},
+		NotBefore:             time.Now().Add(-24 * time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("ca cert: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(der)
+	rekorKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return &fixture{
+		t:         t,
+		issuer:    testIssuer,
+		caKey:     caKey,
+		caCert:    caCert,
+		rekorKey:  rekorKey,
+		digest:    "sha256:" + strings.Repeat("a", 64),
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+	}
+}
+
+// leaf issues a short-lived keyless certificate like Fulcio does for a CI
+// workflow of f.issuer.
+func (f *fixture) leaf(repository, workflow string, signedAt time.Time) (*ecdsa.PrivateKey, string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	san, _ := url.Parse(workflow)
+	ext := func(oid asn1.ObjectIdentifier, value string) pkix.Extension {
+		der, _ := asn1.MarshalWithParams(value, "utf8")
+		return pkix.Extension{Id: oid, Value: der}
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(signedAt.UnixNano()),
+		NotBefore:    signedAt.Add(-time.Minute),
+		NotAfter:     signedAt.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:         []*url.URL{san},
+		ExtraExtensions: []pkix.Extension{
+			ext(oidIssuerV2, f.issuer),
+			ext(oidBuildSignerURI, workflow),
+			ext(oidSourceRepository, repository),
+			ext(oidSourceRef, "refs/tags/v1.0.0"),
+		},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, f.caCert, &key.PublicKey, f.caKey)
+	if err != nil {
+		f.t.Fatalf("leaf cert: %v", err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func (f *fixture) bundle(body []byte, signedAt time.Time) string {
+	keyDER, _ := x509.MarshalPKIXPublicKey(&f.rekorKey.PublicKey)
+	logID := sha256.Sum256(keyDER)
+	f.logIndex++
+	payload := map[string]any{
+		"body":           base64.StdEncoding.EncodeToString(body),
+		"integratedTime": signedAt.Unix(),
+		"logIndex":       f.logIndex,
+		"logID":          hex.EncodeToString(logID[:]),
+	}
+	canonical, _ := json.Marshal(payload)
+	sum := sha256.Sum256(canonical)
+	set, _ := ecdsa.SignASN1(rand.Reader, f.rekorKey, sum[:])
+	out, _ := json.Marshal(map[string]any{"SignedEntryTimestamp": set, "Payload": payload})
+	return string(out)
+}
+
+func (f *fixture) addBlob(data []byte) string {
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	f.blobs[digest] = data
+	return digest
+}
+
+func (f *fixture) sign(repository, workflow string) {
+	signedAt := time.Now().Add(-time.Hour)
+	key, cert := f.leaf(repository, workflow, signedAt)
+	payload := []byte(`{"critical":{"identity":{"docker-reference":"registry/petoadam/homenavi-spotify"},"image":{"docker-manifest-digest":"` + f.digest + `"},"type":"cosign container image signature"},"optional":null}`)
+	sum := sha256.Sum256(payload)
+	signature, _ := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	body, _ := json.Marshal(map[string]any{
+		"kind": "hashedrekord",
+		"spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])}},
+			"signature": map[string]any{"content": signature, "publicKey": map[string]any{"content": []byte(cert)}},
+		},
+	})
+	f.setSidecar(".sig", oci.Descriptor{
+		MediaType: mediaTypeSimpleSigning,
+		Digest:    f.addBlob(payload),
+		Annotations: map[string]string{
+			annotationSignature:   base64.StdEncoding.EncodeToString(signature),
+			annotationCertificate: cert,
+			annotationBundle:      f.bundle(body, signedAt),
+		},
+	})
+}
+
+func (f *fixture) attest(predicateType, predicate string) {
+	f.attestLogged(predicateType, predicate, nil)
+}
+
+// attestLogged attests like cosign, logging an intoto v0.0.2 entry. The
+// entry records logged as the statement when it is set.
+func (f *fixture) attestLogged(predicateType, predicate string, logged []byte) {
+	signedAt := time.Now().Add(-time.Hour)
+	key, cert := f.leaf(testRepo, testWorkflow, signedAt)
+	statement := []byte(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"` + predicateType + `","subject":[{"name":"image","digest":{"sha256":"` + strings.TrimPrefix(f.digest, "sha256:") + `"}}],"predicate":` + predicate + `}`)
+	sum := sha256.Sum256(pae(payloadTypeInToto, statement))
+	signature, _ := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	envelope, _ := json.Marshal(map[string]any{
+		"payloadType": payloadTypeInToto,
+		"payload":     statement,
+		"signatures":  []map[string]any{{"sig": signature}},
+	})
+	if logged == nil {
+		logged = statement
+	}
+	payloadHash := sha256.Sum256(logged)
+	body, _ := json.Marshal(map[string]any{
+		"kind": "intoto",
+		"spec": map[string]any{
+			"content": map[string]any{
+				"envelope": map[string]any{
+					"payloadType": payloadTypeInToto,
+					"signatures":  []map[string]any{{"sig": []byte(base64.StdEncoding.EncodeToString(signature)), "publicKey": []byte(cert)}},
+				},
+				"payloadHash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(payloadHash[:])},
+			},
+		},
+	})
+	f.setSidecar(".att", oci.Descriptor{
+		MediaType: mediaTypeDSSE,
+		Digest:    f.addBlob(envelope),
+		Annotations: map[string]string{
+			annotationCertificate: cert,
+			annotationBundle:      f.bundle(body, signedAt),
+		},
+	})
+}
+
+func (f *fixture) setSidecar(suffix string, layer oci.Descriptor) {
+	manifest, _ := json.Marshal(oci.Manifest{MediaType: oci.MediaTypeOCIManifest, Layers: []oci.Descriptor{layer}})
+	f.manifests["sha256-"+strings.TrimPrefix(f.digest, "sha256:")+suffix] = manifest
+}
+
+func (f *fixture) serve() (*Verifier, oci.Image) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v2/petoadam/homenavi-spotify/")
+		if tag, ok := strings.CutPrefix(path, "manifests/"); ok && f.manifests[tag] != nil {
+			_, _ = w.Write(f.manifests[tag])
+			return
+		}
+		if digest, ok := strings.CutPrefix(path, "blobs/"); ok && f.blobs[digest] != nil {
+			_, _ = w.Write(f.blobs[digest])
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	f.t.Cleanup(srv.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(f.caCert)
+	verifier := NewVerifier(roots, &f.rekorKey.PublicKey)
+	verifier.OCI.HTTP = srv.Client()
+	return verifier, oci.Image{Registry: strings.TrimPrefix(srv.URL, "https://"), Repository: "petoadam/homenavi-spotify"}
+}
+
+var testIdentity = Identity{Issuer: testIssuer, RepositoryURL: "https://github.com/PetoAdam/homenavi-spotify", WorkflowURL: testWorkflow}
+
+func TestVerifySignature(t *testing.T) {
+	f := newFixture(t)
+	f.sign(testRepo, testWorkflow)
+	verifier, image := f.serve()
+
+	signer, err := verifier.VerifySignature(context.Background(), image, f.digest, testIdentity)
+	if err != nil {
+		t.Fatalf("verify signature: %v", err)
+	}
+	if signer.SourceRepository != testRepo || signer.Subject != testWorkflow || signer.LogIndex != 1 {
+		t.Fatalf("unexpected signer %+v", signer)
+	}
+
+	other := testIdentity
+	other.WorkflowURL = "https://github.com/petoadam/homenavi-spotify/.github/workflows/other.yml@refs/tags/v1.0.0"
+	if _, err := verifier.VerifySignature(context.Background(), image, f.digest, other); !errors.Is(err, ErrVerification) {
+		t.Fatalf("expected workflow mismatch, got %v", err)
+	}
+
+	if _, err := verifier.VerifySignature(context.Background(), image, "sha256:"+strings.Repeat("b", 64), testIdentity); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected unsigned digest, got %v", err)
+	}
+}
+
+func TestVerifySignatureGitLab(t *testing.T) {
+	// Fulcio certifies GitLab pipelines with the build signer URI
+	// "https://" + ci_config_ref_uri, which already names the host.
+	const (
+		gitLabRepo     = "https://gitlab.com/homenavi/contrib/hue"
+		gitLabWorkflow = "https://gitlab.com/homenavi/contrib/hue//.gitlab-ci.yml@refs/tags/v1.0.0"
+	)
+	f := newFixture(t)
+	f.issuer = "https://gitlab.com"
+	f.sign(gitLabRepo, gitLabWorkflow)
+	verifier, image := f.serve()
+
+	identity := Identity{Issuer: "https://gitlab.com", RepositoryURL: gitLabRepo, WorkflowURL: gitLabWorkflow}
+	if _, err := verifier.VerifySignature(context.Background(), image, f.digest, identity); err != nil {
+		t.Fatalf("verify gitlab signature: %v", err)
+	}
+	identity.WorkflowURL = "https://gitlab.com/gitlab.com/homenavi/contrib/hue//.gitlab-ci.yml@refs/tags/v1.0.0"
+	if _, err := verifier.VerifySignature(context.Background(), image, f.digest, identity); !errors.Is(err, ErrVerification) {
+		t.Fatalf("expected a host-doubled workflow url to mismatch, got %v", err)
+	}
+}
+
+func TestVerifySignatureRejectsOtherRepository(t *testing.T) {
+	f := newFixture(t)
+	f.sign("https://github.com/someone/else", "https://github.com/someone/else/.github/workflows/release.yml@refs/tags/v1.0.0")
+	verifier, image := f.serve()
+	if _, err := verifier.VerifySignature(context.Background(), image, f.digest, testIdentity); !errors.Is(err, ErrVerification) {
+		t.Fatalf("expected repository mismatch, got %v", err)
+	}
+}
+
+func TestVerifySignatureRejectsUntrustedRekor(t *testing.T) {
+	f := newFixture(t)
+	f.sign(testRepo, testWorkflow)
+	verifier, image := f.serve()
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	verifier.RekorKey = &otherKey.PublicKey
+	if _, err := verifier.VerifySignature(context.Background(), image, f.digest, testIdentity); !errors.Is(err, ErrVerification) {
+		t.Fatalf("expected untrusted log, got %v", err)
+	}
+}
+
+func TestVerifyProvenance(t *testing.T) {
+	f := newFixture(t)
+	f.attest("https://slsa.dev/provenance/v1", `{"buildDefinition":{"externalParameters":{"workflow":{"repository":"`+testRepo+`"}}},"runDetails":{"builder":{"id":"https://github.com/actions/runner"}}}`)
+	verifier, image := f.serve()
+
+	provenance, err := verifier.VerifyProvenance(context.Background(), image, f.digest, testIdentity)
+	if err != nil {
+		t.Fatalf("verify provenance: %v", err)
+	}
+	if provenance.BuilderID != "https://github.com/actions/runner" || provenance.SourceRepository != testRepo {
+		t.Fatalf("unexpected provenance %+v", provenance)
+	}
+}
+
+func TestVerifyProvenanceRejectsEntryForOtherStatement(t *testing.T) {
+	f := newFixture(t)
+	f.attestLogged("https://slsa.dev/provenance/v1", `{}`, []byte(`{"predicateType":"https://example.com/other"}`))
+	verifier, image := f.serve()
+	if _, err := verifier.VerifyProvenance(context.Background(), image, f.digest, testIdentity); !errors.Is(err, ErrVerification) {
+		t.Fatalf("expected a log entry for another statement to be rejected, got %v", err)
+	}
+}
+
+func TestCheckRekorEntriesRejectOtherKey(t *testing.T) {
+	f := newFixture(t)
+	signedAt := time.Now()
+	_, logged := f.leaf(testRepo, testWorkflow, signedAt)
+	_, other := f.leaf(testRepo, testWorkflow, signedAt.Add(time.Second))
+	leaf, err := parseCertificates(other)
+	if err != nil || len(leaf) != 1 {
+		t.Fatalf("parse leaf: %v", err)
+	}
+	payload, signature := []byte("payload"), []byte("signature")
+	sum := sha256.Sum256(payload)
+	hashedRekord, _ := json.Marshal(map[string]any{
+		"kind": "hashedrekord",
+		"spec": map[string]any{
+			"data":      map[string]any{"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])}},
+			"signature": map[string]any{"content": signature, "publicKey": map[string]any{"content": []byte(logged)}},
+		},
+	})
+	if err := checkHashedRekord(hashedRekord, payload, signature, leaf[0]); !errors.Is(err, ErrVerification) {
+		t.Fatalf("expected a hashedrekord entry from another key to be rejected, got %v", err)
+	}
+
+	envelope := []byte(`{"payloadType":"` + payloadTypeInToto + `"}`)
+	envelopeSum := sha256.Sum256(envelope)
+	dsse, _ := json.Marshal(map[string]any{
+		"kind": "dsse",
+		"spec": map[string]any{
+			"envelopeHash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(envelopeSum[:])},
+			"payloadHash":  map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])},
+			"signatures":   []map[string]any{{"signature": signature, "verifier": []byte(logged)}},
+		},
+	})
+	if err := checkAttestationEntry(dsse, envelope, payload, signature, leaf[0]); !errors.Is(err, ErrVerification) {
+		t.Fatalf("expected a dsse entry from another key to be rejected, got %v", err)
+	}
+	logLeaf, _ := parseCertificates(logged)
+	if err := checkAttestationEntry(dsse, envelope, payload, signature, logLeaf[0]); err != nil {
+		t.Fatalf("expected the dsse entry to match its own key, got %v", err)
+	}
+}
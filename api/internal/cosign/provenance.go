@@ -0,0 +1,171 @@
+package cosign
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/oci"
+)
+
+const payloadTypeInToto = "application/vnd.in-toto+json"
+
+// Statement is a verified in-toto statement about an image.
+type Statement struct {
+	PredicateType string
+	Predicate     json.RawMessage
+	Signer        *Signer
+}
+
+// Provenance summarises a verified SLSA provenance statement.
+type Provenance struct {
+	PredicateType    string
+	BuilderID        string
+	SourceRepository string
+	Signer           *Signer
+}
+
+// Attestations returns every attestation of digest that verifies and was
+// made by identity. Attestations that fail verification are skipped; if none
+// verify, the first failure is returned. It returns ErrNotFound when the
+// image has no attestations.
+func (v *Verifier) Attestations(ctx context.Context, image oci.Image, digest string, identity Identity) ([]Statement, error) {
+	manifest, err := v.sidecar(ctx, image, digest, ".att")
+	if err != nil {
+		return nil, err
+	}
+	var statements []Statement
+	var firstErr error
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != mediaTypeDSSE {
+			continue
+		}
+		statement, err := v.verifyAttestationLayer(ctx, image, digest, layer, identity)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		statements = append(statements, *statement)
+	}
+	if len(statements) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return statements, nil
+}
+
+// VerifyProvenance returns the first verified SLSA provenance attestation of
+// digest. It returns ErrNotFound when there is none.
+func (v *Verifier) VerifyProvenance(ctx context.Context, image oci.Image, digest string, identity Identity) (*Provenance, error) {
+	statements, err := v.Attestations(ctx, image, digest, identity)
+	if err != nil {
+		return nil, err
+	}
+	for _, statement := range statements {
+		if strings.HasPrefix(statement.PredicateType, "https://slsa.dev/provenance/") {
+			return parseProvenance(statement), nil
+		}
+	}
+	return nil, fmt.Errorf("provenance %w", ErrNotFound)
+}
+
+func (v *Verifier) verifyAttestationLayer(ctx context.Context, image oci.Image, digest string, layer oci.Descriptor, identity Identity) (*Statement, error) {
+	data, err := v.blob(ctx, image, layer)
+	if err != nil {
+		return nil, err
+	}
+	var envelope struct {
+		PayloadType string `json:"payloadType"`
+		Payload     []byte `json:"payload"`
+		Signatures  []struct {
+			Sig []byte `json:"sig"`
+		} `json:"signatures"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.PayloadType != payloadTypeInToto || len(envelope.Signatures) == 0 {
+		return nil, fmt.Errorf("%w: attestation is not an in-toto DSSE envelope", ErrVerification)
+	}
+	signer, cert, err := v.verifyCertificate(layer.Annotations, identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyBlobSignature(cert.PublicKey, pae(envelope.PayloadType, envelope.Payload), envelope.Signatures[0].Sig); err != nil {
+		return nil, err
+	}
+	if err := checkAttestationEntry(signer.logEntry, data, envelope.Payload, envelope.Signatures[0].Sig, cert); err != nil {
+		return nil, err
+	}
+	var statement struct {
+		PredicateType string `json:"predicateType"`
+		Subject       []struct {
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+		Predicate json.RawMessage `json:"predicate"`
+	}
+	if err := json.Unmarshal(envelope.Payload, &statement); err != nil {
+		return nil, fmt.Errorf("%w: attestation statement invalid", ErrVerification)
+	}
+	_, hexDigest, _ := strings.Cut(digest, ":")
+	for _, subject := range statement.Subject {
+		if subject.Digest["sha256"] == hexDigest {
+			return &Statement{PredicateType: statement.PredicateType, Predicate: statement.Predicate, Signer: signer}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: attestation subject is not %s", ErrVerification, digest)
+}
+
+// pae is the DSSE pre-authentication encoding that the signature covers.
+func pae(payloadType string, payload []byte) []byte {
+	header := "DSSEv1 " + strconv.Itoa(len(payloadType)) + " " + payloadType + " " + strconv.Itoa(len(payload)) + " "
+	return append([]byte(header), payload...)
+}
+
+// parseProvenance reads the builder and source from SLSA v0.2 and v1
+// predicates.
+func parseProvenance(statement Statement) *Provenance {
+	var predicate struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Invocation struct {
+			ConfigSource struct {
+				URI string `json:"uri"`
+			} `json:"configSource"`
+		} `json:"invocation"`
+		BuildDefinition struct {
+			ExternalParameters struct {
+				Workflow struct {
+					Repository string `json:"repository"`
+				} `json:"workflow"`
+			} `json:"externalParameters"`
+		} `json:"buildDefinition"`
+		RunDetails struct {
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+		} `json:"runDetails"`
+	}
+	_ = json.Unmarshal(statement.Predicate, &predicate)
+	out := &Provenance{
+		PredicateType:    statement.PredicateType,
+		BuilderID:        firstNonEmpty(predicate.RunDetails.Builder.ID, predicate.Builder.ID),
+		SourceRepository: predicate.BuildDefinition.ExternalParameters.Workflow.Repository,
+		Signer:           statement.Signer,
+	}
+	if out.SourceRepository == "" {
+		source, _, _ := strings.Cut(strings.TrimPrefix(predicate.Invocation.ConfigSource.URI, "git+"), "@")
+		out.SourceRepository = source
+	}
+	return out
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,195 @@
+package cosign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+type rekorEntry struct {
+	Body           []byte
+	LogIndex       int64
+	IntegratedTime time.Time
+}
+
+// verifyBundle checks the Rekor signed entry timestamp cosign attaches to
+// each signature. The SET is Rekor's signature over the canonical JSON of
+// the entry payload.
+func (v *Verifier) verifyBundle(raw string) (*rekorEntry, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("%w: transparency log bundle missing", ErrVerification)
+	}
+	var bundle struct {
+		SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+		Payload              struct {
+			Body           string `json:"body"`
+			IntegratedTime int64  `json:"integratedTime"`
+			LogIndex       int64  `json:"logIndex"`
+			LogID          string `json:"logID"`
+		} `json:"Payload"`
+	}
+	if err := json.Unmarshal([]byte(raw), &bundle); err != nil {
+		return nil, fmt.Errorf("%w: transparency log bundle invalid", ErrVerification)
+	}
+	keyDER, err := x509.MarshalPKIXPublicKey(v.RekorKey)
+	if err != nil {
+		return nil, err
+	}
+	keyID := sha256.Sum256(keyDER)
+	if bundle.Payload.LogID != hex.EncodeToString(keyID[:]) {
+		return nil, fmt.Errorf("%w: entry was not logged by the trusted rekor instance", ErrVerification)
+	}
+	// Marshalling a map sorts the keys, which is the canonical form Rekor signs.
+	canonical, err := json.Marshal(map[string]any{
+		"body":           bundle.Payload.Body,
+		"integratedTime": bundle.Payload.IntegratedTime,
+		"logIndex":       bundle.Payload.LogIndex,
+		"logID":          bundle.Payload.LogID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyBlobSignature(v.RekorKey, canonical, bundle.SignedEntryTimestamp); err != nil {
+		return nil, fmt.Errorf("%w: transparency log timestamp does not verify", ErrVerification)
+	}
+	body, err := base64.StdEncoding.DecodeString(bundle.Payload.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: transparency log body invalid", ErrVerification)
+	}
+	return &rekorEntry{
+		Body:           body,
+		LogIndex:       bundle.Payload.LogIndex,
+		IntegratedTime: time.Unix(bundle.Payload.IntegratedTime, 0).UTC(),
+	}, nil
+}
+
+// checkHashedRekord ties the logged hashedrekord entry to this payload,
+// signature and signing certificate so a bundle cannot be borrowed from
+// another signature.
+func checkHashedRekord(body, payload, signature []byte, leaf *x509.Certificate) error {
+	var entry struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Data struct {
+				Hash rekorHash `json:"hash"`
+			} `json:"data"`
+			Signature struct {
+				Content   []byte `json:"content"`
+				PublicKey struct {
+					Content []byte `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil || entry.Kind != "hashedrekord" {
+		return fmt.Errorf("%w: transparency log entry is not a hashedrekord", ErrVerification)
+	}
+	if !entry.Spec.Data.Hash.matches(payload) || !bytes.Equal(entry.Spec.Signature.Content, signature) {
+		return fmt.Errorf("%w: transparency log entry is for a different signature", ErrVerification)
+	}
+	if !loggedKeyMatches(entry.Spec.Signature.PublicKey.Content, leaf) {
+		return fmt.Errorf("%w: transparency log entry was signed by a different key", ErrVerification)
+	}
+	return nil
+}
+
+// checkAttestationEntry ties the logged intoto or dsse entry to this DSSE
+// envelope, its signature and the signing certificate.
+func checkAttestationEntry(body, envelope, payload, signature []byte, leaf *x509.Certificate) error {
+	var entry struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			// intoto v0.0.1 and v0.0.2.
+			Content struct {
+				PayloadHash rekorHash `json:"payloadHash"`
+				Envelope    struct {
+					Signatures []rekorDSSESignature `json:"signatures"`
+				} `json:"envelope"`
+			} `json:"content"`
+			PublicKey []byte `json:"publicKey"`
+			// dsse v0.0.1.
+			EnvelopeHash rekorHash `json:"envelopeHash"`
+			PayloadHash  rekorHash `json:"payloadHash"`
+			Signatures   []struct {
+				Signature []byte `json:"signature"`
+				Verifier  []byte `json:"verifier"`
+			} `json:"signatures"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return fmt.Errorf("%w: transparency log entry invalid", ErrVerification)
+	}
+	var signatures []rekorDSSESignature
+	switch entry.Kind {
+	case "intoto":
+		if !entry.Spec.Content.PayloadHash.matches(payload) {
+			return fmt.Errorf("%w: transparency log entry is for a different attestation", ErrVerification)
+		}
+		signatures = entry.Spec.Content.Envelope.Signatures
+		if len(entry.Spec.PublicKey) > 0 {
+			// v0.0.1 logs the key once for the whole entry.
+			signatures = []rekorDSSESignature{{PublicKey: entry.Spec.PublicKey}}
+		}
+	case "dsse":
+		if !entry.Spec.PayloadHash.matches(payload) || !entry.Spec.EnvelopeHash.matches(envelope) {
+			return fmt.Errorf("%w: transparency log entry is for a different attestation", ErrVerification)
+		}
+		for _, sig := range entry.Spec.Signatures {
+			signatures = append(signatures, rekorDSSESignature{Sig: sig.Signature, PublicKey: sig.Verifier})
+		}
+	default:
+		return fmt.Errorf("%w: transparency log entry is not an intoto or dsse entry", ErrVerification)
+	}
+	for _, sig := range signatures {
+		if sig.Sig != nil && !sig.matches(signature) {
+			continue
+		}
+		if loggedKeyMatches(sig.PublicKey, leaf) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: transparency log entry was signed by a different key", ErrVerification)
+}
+
+type rekorHash struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+}
+
+func (h rekorHash) matches(data []byte) bool {
+	sum := sha256.Sum256(data)
+	return h.Algorithm == "sha256" && h.Value == hex.EncodeToString(sum[:])
+}
+
+type rekorDSSESignature struct {
+	Sig       []byte `json:"sig"`
+	PublicKey []byte `json:"publicKey"`
+}
+
+// matches compares the logged signature with signature. intoto v0.0.2
+// entries log the envelope's base64 signature base64-encoded once more.
+func (s rekorDSSESignature) matches(signature []byte) bool {
+	return bytes.Equal(s.Sig, signature) || string(s.Sig) == base64.StdEncoding.EncodeToString(signature)
+}
+
+// loggedKeyMatches reports whether the PEM certificate or public key in a
+// Rekor entry is the signing certificate leaf or its key.
+func loggedKeyMatches(data []byte, leaf *x509.Certificate) bool {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		return bytes.Equal(block.Bytes, leaf.Raw)
+	case "PUBLIC KEY":
+		return bytes.Equal(block.Bytes, leaf.RawSubjectPublicKeyInfo)
+	}
+	return false
+}
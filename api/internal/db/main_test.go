@@ -0,0 +1,11 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestMain(m *testing.M) {
+	testutil.Main(m)
+}
@@ -2,35 +2,140 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus reports whether a known migration has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// LatestVersion is the schema version this binary migrates up to.
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrate applies every pending migration.
 func Migrate(ctx context.Context, db *gorm.DB) error {
-	if err := db.WithContext(ctx).AutoMigrate(
-		&Integration{},
-		&IntegrationDownloadEvent{},
-	); err != nil {
-		return err
+	return MigrateUp(ctx, db, LatestVersion())
+}
+
+// MigrateUp applies pending migrations up to and including target.
+func MigrateUp(ctx context.Context, db *gorm.DB, target int) error {
+	return inMigration(ctx, db, func(tx *gorm.DB, current int) error {
+		for _, m := range migrations {
+			if m.Version <= current || m.Version > target {
+				continue
+			}
+			if err := m.Up(tx); err != nil {
+				return fmt.Errorf("migration %d %s up: %w", m.Version, m.Name, err)
+			}
+			if err := tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown reverts the last steps applied migrations.
+func MigrateDown(ctx context.Context, db *gorm.DB, steps int) error {
+	return inMigration(ctx, db, func(tx *gorm.DB, current int) error {
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if m.Version > current {
+				continue
+			}
+			if err := m.Down(tx); err != nil {
+				return fmt.Errorf("migration %d %s down: %w", m.Version, m.Name, err)
+			}
+			if err := tx.Delete(&SchemaMigration{}, m.Version).Error; err != nil {
+				return err
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// Status lists every known migration and the current schema version.
+func Status(ctx context.Context, db *gorm.DB) ([]MigrationStatus, int, error) {
+	if err := db.WithContext(ctx).AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, 0, err
+	}
+	applied := []SchemaMigration{}
+	if err := db.WithContext(ctx).Order("version").Find(&applied).Error; err != nil {
+		return nil, 0, err
+	}
+	byVersion := map[int]SchemaMigration{}
+	current := 0
+	for _, m := range applied {
+		byVersion[m.Version] = m
+		current = max(current, m.Version)
 	}
+	out := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if row, ok := byVersion[m.Version]; ok {
+			status.AppliedAt = &row.AppliedAt
+		}
+		out = append(out, status)
+	}
+	return out, current, nil
+}
 
-	// GORM does not support partial unique indexes; use raw SQL for latest-only uniqueness.
-	if err := db.WithContext(ctx).Exec(`
-CREATE UNIQUE INDEX IF NOT EXISTS integrations_listen_path_latest_unique
-  ON integrations (listen_path)
-  WHERE latest = TRUE
-`).Error; err != nil {
+// inMigration runs fn in one transaction holding an advisory lock, so
+// concurrent instances migrate one at a time, with the current schema
+// version. It refuses schemas newer than this binary.
+func inMigration(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB, current int) error) error {
+	if err := db.WithContext(ctx).AutoMigrate(&SchemaMigration{}); err != nil {
 		return err
 	}
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
 
-	// Enforce name uniqueness for latest integrations (partial unique index).
-	if err := db.WithContext(ctx).Exec(`
-CREATE UNIQUE INDEX IF NOT EXISTS integrations_name_latest_unique
-  ON integrations (name)
-  WHERE latest = TRUE
-`).Error; err != nil {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))").Error; err != nil {
+		tx.Rollback()
 		return err
 	}
-
-	return nil
+	var current int
+	if err := tx.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&current).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if current > LatestVersion() {
+		tx.Rollback()
+		return fmt.Errorf("%w: schema version %d, binary knows up to %d", ErrSchemaTooNew, current, LatestVersion())
+	}
+	if err := fn(tx, current); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
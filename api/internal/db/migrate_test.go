@@ -0,0 +1,272 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestMigrateUpDownAndTooNew(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	statuses, current, err := db.Status(ctx, pool)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if current != db.LatestVersion() || len(statuses) != db.LatestVersion() {
+		t.Fatalf("expected every migration applied, got version %d", current)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			t.Fatalf("migration %d not applied", s.Version)
+		}
+	}
+
+	if err := db.MigrateDown(ctx, pool, db.LatestVersion()); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if pool.Migrator().HasTable(&db.Integration{}) {
+		t.Fatalf("expected integrations dropped")
+	}
+	if err := db.Migrate(ctx, pool); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if err := db.Migrate(ctx, pool); err != nil {
+		t.Fatalf("up is not idempotent: %v", err)
+	}
+	if !pool.Migrator().HasTable(&db.Release{}) || !pool.Migrator().HasTable(&db.IntegrationVersion{}) {
+		t.Fatalf("expected releases and the integration_versions view recreated")
+	}
+
+	if err := pool.Create(&db.SchemaMigration{Version: db.LatestVersion() + 1, Name: "from the future"}).Error; err != nil {
+		t.Fatalf("record future migration: %v", err)
+	}
+	if err := db.Migrate(ctx, pool); !errors.Is(err, db.ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+	if err := db.MigrateDown(ctx, pool, 1); !errors.Is(err, db.ErrSchemaTooNew) {
+		t.Fatalf("expected down to refuse a newer schema, got %v", err)
+	}
+}
+
+func TestSplitReleasesKeepsData(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	for _, version := range []string{"v0.1.0", "v0.2.0"} {
+		req.Version = version
+		if _, err := store.PublishIntegration(ctx, pool, req, store.PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+	if _, err := store.IncrementDownloads(ctx, pool, "spotify", store.DownloadOptions{Version: "v0.1.0"}); err != nil {
+		t.Fatalf("increment downloads: %v", err)
+	}
+	if err := store.SetFeatured(ctx, pool, "spotify", true); err != nil {
+		t.Fatalf("feature: %v", err)
+	}
+	before, _, err := store.ListVersions(ctx, pool, "spotify", store.Page{})
+	if err != nil {
+		t.Fatalf("versions: %v", err)
+	}
+
+	// Back to the baseline, before split_releases.
+	if err := db.MigrateDown(ctx, pool, db.LatestVersion()-1); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	var rows []struct {
+		Version   string
+		Name      string
+		Latest    bool
+		Downloads int64
+		Featured  bool
+	}
+	if err := pool.Raw("SELECT version, name, latest, downloads, featured FROM integrations WHERE id = ? ORDER BY version", "spotify").
+		Scan(&rows).Error; err != nil {
+		t.Fatalf("read flat rows: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Latest || !rows[1].Latest || rows[1].Name != "Spotify" || rows[1].Downloads != 1 || !rows[1].Featured {
+		t.Fatalf("unexpected rows after down: %+v", rows)
+	}
+
+	if err := db.Migrate(ctx, pool); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	after, _, err := store.ListVersions(ctx, pool, "spotify", store.Page{})
+	if err != nil {
+		t.Fatalf("versions: %v", err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("expected %d versions, got %d", len(before), len(after))
+	}
+	for i := range before {
+		b, a := before[i], after[i]
+		if a.Version != b.Version || a.Name != b.Name || a.Latest != b.Latest || a.Downloads != b.Downloads ||
+			a.VersionDownloads != b.VersionDownloads || a.Featured != b.Featured || a.ListenPath != b.ListenPath {
+			t.Fatalf("version %s changed across down/up: %+v != %+v", b.Version, a, b)
+		}
+	}
+}
+
+func TestReleaseFlagsBackfilled(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := store.PublishIntegration(ctx, pool, req, store.PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	// Back to before release_flags_not_null, with a release stored before
+	// the yank and deprecate columns existed.
+	if err := db.MigrateDown(ctx, pool, db.LatestVersion()-4); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if err := pool.Exec("UPDATE integration_releases SET yanked = NULL, deprecated = NULL").Error; err != nil {
+		t.Fatalf("unset flags: %v", err)
+	}
+	if err := db.Migrate(ctx, pool); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	items, _, err := store.ListIntegrations(ctx, pool, store.ListOptions{LatestOnly: true})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(items) != 1 || items[0].Yanked || items[0].Deprecated {
+		t.Fatalf("expected the old release listed as not yanked, got %+v", items)
+	}
+	if err := pool.Exec("INSERT INTO integration_releases (integration_id, version) VALUES ('spotify', 'v0.2.0')").Error; err != nil {
+		t.Fatalf("insert release: %v", err)
+	}
+	var yanked []bool
+	if err := pool.Raw("SELECT yanked FROM integration_releases WHERE version = 'v0.2.0'").Scan(&yanked).Error; err != nil || len(yanked) != 1 || yanked[0] {
+		t.Fatalf("expected new releases to default to not yanked, got %v %v", yanked, err)
+	}
+}
+
+func TestReleaseSearchVectorStored(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := store.PublishIntegration(ctx, pool, req, store.PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	var indexes int64
+	if err := pool.Raw("SELECT COUNT(*) FROM pg_indexes WHERE tablename = 'integration_releases' AND indexname = 'integration_releases_search_vector_idx'").
+		Scan(&indexes).Error; err != nil || indexes != 1 {
+		t.Fatalf("expected the search vector index, got %d err=%v", indexes, err)
+	}
+	search := func(query string) int {
+		items, _, err := store.ListIntegrations(ctx, pool, store.ListOptions{LatestOnly: true, Query: query})
+		if err != nil {
+			t.Fatalf("search %q: %v", query, err)
+		}
+		return len(items)
+	}
+	if search("spotify") != 1 {
+		t.Fatalf("expected the release found by name")
+	}
+
+	// The stored document follows renames and reassigned ids.
+	if err := pool.Exec("UPDATE integrations SET name = 'Tidal' WHERE id = 'spotify'").Error; err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	if search("tidal") != 1 {
+		t.Fatalf("expected the release found by its new name")
+	}
+	if err := store.ReassignIntegration(ctx, pool, "spotify", "deezer"); err != nil {
+		t.Fatalf("reassign: %v", err)
+	}
+	if search("deezer") != 1 {
+		t.Fatalf("expected the release found by its new id")
+	}
+}
+
+func TestBackfillMigrations(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+		RepoURL:     "https://github.com/PetoAdam/homenavi-spotify.git",
+	}
+	for _, version := range []string{"v0.9.0", "v0.10.0-rc.1"} {
+		req.Version = version
+		if _, err := store.PublishIntegration(ctx, pool, req, store.PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+	// Back to server_secrets, with releases stored before versions were
+	// parsed and an id published before ownership existed.
+	if err := db.MigrateDown(ctx, pool, db.LatestVersion()-11); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	for _, stmt := range []string{
+		"UPDATE integration_releases SET version_key = '', prerelease = FALSE",
+		"DELETE FROM integration_owners",
+	} {
+		if err := pool.Exec(stmt).Error; err != nil {
+			t.Fatalf("reset: %v", err)
+		}
+	}
+	if err := db.Migrate(ctx, pool); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	var rows []struct {
+		Version    string
+		VersionKey string
+		Prerelease bool
+	}
+	if err := pool.Raw("SELECT version, version_key, prerelease FROM integration_releases ORDER BY version_key").Scan(&rows).Error; err != nil {
+		t.Fatalf("read releases: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Version != "v0.9.0" || rows[0].Prerelease || !rows[1].Prerelease || rows[0].VersionKey == "" {
+		t.Fatalf("expected version keys backfilled, got %+v", rows)
+	}
+	owner, err := store.GetOwnership(ctx, pool, "spotify")
+	if err != nil || owner.Repository != "github.com/petoadam/homenavi-spotify" {
+		t.Fatalf("expected the id bound to its repository, got %+v %v", owner, err)
+	}
+}
@@ -0,0 +1,757 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
+	"gorm.io/gorm"
+)
+
+// Migration is one versioned schema change. Up and Down run inside the
+// transaction that records the version in schema_migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// migrations are applied in order. Append new ones; never edit or renumber
+// a migration that has been released.
+var migrations = []Migration{
+	{Version: 1, Name: "baseline", Up: baselineUp, Down: baselineDown},
+	{Version: 2, Name: "split_releases", Up: splitReleasesUp, Down: splitReleasesDown},
+	{Version: 3, Name: "download_rankings", Up: downloadRankingsUp, Down: downloadRankingsDown},
+	{Version: 4, Name: "prerelease_latest", Up: prereleaseLatestUp, Down: noDown},
+	{Version: 5, Name: "release_flags_not_null", Up: releaseFlagsNotNullUp, Down: releaseFlagsNotNullDown},
+	{Version: 6, Name: "yanked_latest", Up: yankedLatestUp, Down: noDown},
+	{Version: 7, Name: "publisher_owners", Up: publisherOwnersUp, Down: publisherOwnersDown},
+	{Version: 8, Name: "unauthenticated_publish_attempts", Up: unauthenticatedPublishAttemptsUp, Down: unauthenticatedPublishAttemptsDown},
+	{Version: 9, Name: "download_ip_hash", Up: downloadIPHashUp, Down: downloadIPHashDown},
+	{Version: 10, Name: "release_search_vector", Up: releaseSearchVectorUp, Down: releaseSearchVectorDown},
+	{Version: 11, Name: "server_secrets", Up: serverSecretsUp, Down: serverSecretsDown},
+	{Version: 12, Name: "release_version_keys", Up: releaseVersionKeysUp, Down: noDown},
+	{Version: 13, Name: "repository_owners", Up: repositoryOwnersUp, Down: noDown},
+}
+
+// baselineTable is a table as it was last created by AutoMigrate. The table
+// is created with its primary key only and every other column is added if
+// missing, so databases migrated by any earlier AutoMigrate are adopted.
+type baselineTable struct {
+	name    string
+	key     []string
+	columns []string
+}
+
+var baselineTables = []baselineTable{
+	{
+		name: "integrations",
+		key:  []string{"id text", "version text"},
+		columns: []string{
+			`version_key text COLLATE "C"`,
+			"prerelease boolean",
+			"name text",
+			"description text",
+			"manifest_url text",
+			"manifest jsonb",
+			"image text",
+			"image_digest text",
+			"images jsonb",
+			"assets jsonb",
+			"listen_path text",
+			"compose_file text",
+			"deployment jsonb",
+			"attestations jsonb",
+			"repo_url text",
+			"release_tag text",
+			"publisher text",
+			"verified boolean",
+			"latest boolean",
+			"yanked boolean",
+			"yank_reason text",
+			"yanked_at timestamptz",
+			"deprecated boolean",
+			"deprecation_message text",
+			"downloads bigint",
+			"version_downloads bigint",
+			"trending_score decimal",
+			"featured boolean",
+			"created_at timestamptz",
+			"updated_at timestamptz",
+		},
+	},
+	{
+		name: "integration_download_events",
+		key:  []string{"id bigserial"},
+		columns: []string{
+			"integration_id text",
+			"version text",
+			"method text",
+			"client_hash text",
+			"created_at timestamptz",
+		},
+	},
+	{
+		name: "integration_download_daily",
+		key:  []string{"integration_id text", "version text", "method text", "day timestamptz"},
+		columns: []string{
+			"downloads bigint",
+		},
+	},
+	{
+		name: "admin_audit_events",
+		key:  []string{"id bigserial"},
+		columns: []string{
+			"actor text",
+			"action text",
+			"integration_id text",
+			"version text",
+			"details jsonb",
+			"created_at timestamptz",
+		},
+	},
+	{
+		name: "publisher_api_keys",
+		key:  []string{"id bigserial"},
+		columns: []string{
+			"publisher text",
+			"key_hash text",
+			"prefix text",
+			"created_by text",
+			"created_at timestamptz",
+			"last_used_at timestamptz",
+			"revoked_at timestamptz",
+		},
+	},
+	{
+		name: "integration_owners",
+		key:  []string{"integration_id text"},
+		columns: []string{
+			"repository text",
+			"created_at timestamptz",
+			"updated_at timestamptz",
+		},
+	},
+	{
+		name: "ownership_transfers",
+		key:  []string{"id bigserial"},
+		columns: []string{
+			"integration_id text",
+			"from_repository text",
+			"to_repository text",
+			"created_at timestamptz",
+			"completed_at timestamptz",
+			"cancelled_at timestamptz",
+		},
+	},
+	{
+		name: "integration_sboms",
+		key:  []string{"integration_id text", "version text"},
+		columns: []string{
+			"format text",
+			"spec_version text",
+			"document jsonb",
+			"summary jsonb",
+			"created_at timestamptz",
+		},
+	},
+	{
+		name: "oidc_token_uses",
+		key:  []string{"issuer text", "token_id text"},
+		columns: []string{
+			"expires_at timestamptz",
+			"created_at timestamptz",
+		},
+	},
+	{
+		name: "publish_events",
+		key:  []string{"id bigserial"},
+		columns: []string{
+			"endpoint text",
+			"outcome text",
+			"status bigint",
+			"error text",
+			"integration_id text",
+			"version text",
+			"publisher text",
+			"issuer text",
+			"subject text",
+			"repository text",
+			"actor text",
+			"run_id bigint",
+			"run_attempt bigint",
+			"token_id text",
+			"claims jsonb",
+			"request jsonb",
+			"response jsonb",
+			"created_at timestamptz",
+		},
+	},
+}
+
+// baselineIndexes keep the names AutoMigrate gave them.
+var baselineIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_integrations_version_key ON integrations (version_key)",
+	"CREATE INDEX IF NOT EXISTS idx_integrations_listen_path ON integrations (listen_path)",
+	"CREATE INDEX IF NOT EXISTS idx_integrations_latest ON integrations (latest)",
+	"CREATE INDEX IF NOT EXISTS idx_integration_download_events_integration_id ON integration_download_events (integration_id)",
+	"CREATE INDEX IF NOT EXISTS idx_integration_download_events_client_hash ON integration_download_events (client_hash)",
+	"CREATE INDEX IF NOT EXISTS idx_integration_download_events_created_at ON integration_download_events (created_at)",
+	"CREATE INDEX IF NOT EXISTS idx_admin_audit_events_actor ON admin_audit_events (actor)",
+	"CREATE INDEX IF NOT EXISTS idx_admin_audit_events_integration_id ON admin_audit_events (integration_id)",
+	"CREATE INDEX IF NOT EXISTS idx_publisher_api_keys_publisher ON publisher_api_keys (publisher)",
+	"CREATE UNIQUE INDEX IF NOT EXISTS idx_publisher_api_keys_key_hash ON publisher_api_keys (key_hash)",
+	"CREATE INDEX IF NOT EXISTS idx_integration_owners_repository ON integration_owners (repository)",
+	"CREATE INDEX IF NOT EXISTS idx_ownership_transfers_integration_id ON ownership_transfers (integration_id)",
+	"CREATE INDEX IF NOT EXISTS idx_oidc_token_uses_expires_at ON oidc_token_uses (expires_at)",
+	"CREATE INDEX IF NOT EXISTS idx_publish_events_outcome ON publish_events (outcome)",
+	"CREATE INDEX IF NOT EXISTS idx_publish_events_integration_id ON publish_events (integration_id)",
+	"CREATE INDEX IF NOT EXISTS idx_publish_events_repository ON publish_events (repository)",
+
+	// Latest-only uniqueness of listen paths and names.
+	`CREATE UNIQUE INDEX IF NOT EXISTS integrations_listen_path_latest_unique
+  ON integrations (listen_path)
+  WHERE latest = TRUE`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS integrations_name_latest_unique
+  ON integrations (name)
+  WHERE latest = TRUE`,
+
+	// Full-text search document over name, description and manifest string values.
+	`ALTER TABLE integrations ADD COLUMN IF NOT EXISTS search_vector tsvector
+  GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(id, '') || ' ' || coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+    setweight(jsonb_to_tsvector('english', coalesce(manifest, '{}'::jsonb), '["string"]'), 'C')
+  ) STORED`,
+	`CREATE INDEX IF NOT EXISTS integrations_search_vector_idx
+  ON integrations USING GIN (search_vector)`,
+}
+
+func baselineUp(tx *gorm.DB) error {
+	for _, table := range baselineTables {
+		names := make([]string, 0, len(table.key))
+		for _, key := range table.key {
+			names = append(names, strings.Fields(key)[0])
+		}
+		if err := tx.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s, PRIMARY KEY (%s))",
+			table.name, strings.Join(table.key, ", "), strings.Join(names, ", "))).Error; err != nil {
+			return err
+		}
+		for _, column := range table.columns {
+			if err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s", table.name, column)).Error; err != nil {
+				return err
+			}
+		}
+	}
+	for _, stmt := range baselineIndexes {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func baselineDown(tx *gorm.DB) error {
+	for i := len(baselineTables) - 1; i >= 0; i-- {
+		if err := tx.Exec("DROP TABLE IF EXISTS " + baselineTables[i].name).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// integrationVersionsView serves the per-release rows of the pre-split
+// integrations table, with searchVector as the search_vector column.
+func integrationVersionsView(searchVector string) string {
+	return `
+CREATE OR REPLACE VIEW integration_versions AS
+SELECT
+  r.integration_id AS id,
+  r.version,
+  r.version_key,
+  r.prerelease,
+  i.name,
+  r.description,
+  r.manifest_url,
+  r.manifest,
+  r.image,
+  r.image_digest,
+  r.images,
+  r.assets,
+  r.listen_path,
+  r.compose_file,
+  r.deployment,
+  r.attestations,
+  r.repo_url,
+  r.release_tag,
+  r.publisher,
+  r.verified,
+  COALESCE(i.latest_version = r.version, FALSE) AS latest,
+  r.yanked,
+  r.yank_reason,
+  r.yanked_at,
+  r.deprecated,
+  r.deprecation_message,
+  i.downloads,
+  r.version_downloads,
+  i.trending_score,
+  i.featured,
+  r.created_at,
+  r.updated_at,
+  ` + searchVector + ` AS search_vector
+FROM integration_releases AS r
+JOIN integrations AS i ON i.id = r.integration_id`
+}
+
+// computedSearchVector builds the search document of a release in the view
+// itself, which no index can serve.
+const computedSearchVector = `setweight(to_tsvector('english', coalesce(r.integration_id, '') || ' ' || coalesce(i.name, '')), 'A') ||
+  setweight(to_tsvector('english', coalesce(r.description, '')), 'B') ||
+  setweight(jsonb_to_tsvector('english', coalesce(r.manifest, '{}'::jsonb), '["string"]'), 'C')`
+
+// splitReleasesUp moves per-release columns of integrations into
+// integration_releases and keeps one integrations row per id with the
+// integration-wide name, counters and a pointer to the latest release.
+func splitReleasesUp(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"ALTER TABLE integrations RENAME TO integration_releases",
+		"ALTER INDEX integrations_pkey RENAME TO integration_releases_pkey",
+		"ALTER TABLE integration_releases RENAME COLUMN id TO integration_id",
+		"ALTER INDEX idx_integrations_version_key RENAME TO idx_integration_releases_version_key",
+		"ALTER INDEX idx_integrations_listen_path RENAME TO idx_integration_releases_listen_path",
+		"DROP INDEX integrations_listen_path_latest_unique",
+		"DROP INDEX integrations_name_latest_unique",
+		"ALTER TABLE integration_releases DROP COLUMN search_vector",
+		`CREATE TABLE integrations (
+  id text PRIMARY KEY,
+  name text,
+  latest_version text,
+  listen_path text,
+  downloads bigint,
+  trending_score decimal,
+  featured boolean,
+  created_at timestamptz,
+  updated_at timestamptz
+)`,
+		// The latest row carries the integration-wide state; ids without one
+		// (every release yanked) take their newest release.
+		`INSERT INTO integrations (id, name, latest_version, listen_path, downloads, trending_score, featured, created_at, updated_at)
+SELECT DISTINCT ON (integration_id)
+  integration_id,
+  name,
+  CASE WHEN latest THEN version END,
+  listen_path,
+  COALESCE(downloads, 0),
+  COALESCE(trending_score, 0),
+  COALESCE(featured, FALSE),
+  MIN(created_at) OVER (PARTITION BY integration_id),
+  MAX(updated_at) OVER (PARTITION BY integration_id)
+FROM integration_releases
+ORDER BY integration_id, latest DESC NULLS LAST, version_key DESC, version DESC`,
+		`ALTER TABLE integration_releases
+  DROP COLUMN name,
+  DROP COLUMN latest,
+  DROP COLUMN downloads,
+  DROP COLUMN trending_score,
+  DROP COLUMN featured`,
+		`ALTER TABLE integration_releases ADD CONSTRAINT integration_releases_integration_id_fkey
+  FOREIGN KEY (integration_id) REFERENCES integrations (id) ON UPDATE CASCADE ON DELETE CASCADE`,
+		`CREATE UNIQUE INDEX integrations_listen_path_latest_unique
+  ON integrations (listen_path)
+  WHERE latest_version IS NOT NULL`,
+		`CREATE UNIQUE INDEX integrations_name_latest_unique
+  ON integrations (name)
+  WHERE latest_version IS NOT NULL`,
+		integrationVersionsView(computedSearchVector),
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitReleasesDown(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"DROP VIEW integration_versions",
+		"ALTER TABLE integration_releases DROP CONSTRAINT integration_releases_integration_id_fkey",
+		`ALTER TABLE integration_releases
+  ADD COLUMN name text,
+  ADD COLUMN latest boolean,
+  ADD COLUMN downloads bigint,
+  ADD COLUMN trending_score decimal,
+  ADD COLUMN featured boolean`,
+		`UPDATE integration_releases AS r
+SET name = i.name,
+  latest = COALESCE(i.latest_version = r.version, FALSE),
+  downloads = i.downloads,
+  trending_score = i.trending_score,
+  featured = i.featured
+FROM integrations AS i
+WHERE i.id = r.integration_id`,
+		"DROP TABLE integrations",
+		"ALTER TABLE integration_releases RENAME TO integrations",
+		"ALTER INDEX integration_releases_pkey RENAME TO integrations_pkey",
+		"ALTER TABLE integrations RENAME COLUMN integration_id TO id",
+		"ALTER INDEX idx_integration_releases_version_key RENAME TO idx_integrations_version_key",
+		"ALTER INDEX idx_integration_releases_listen_path RENAME TO idx_integrations_listen_path",
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	// Recreates the latest index, the latest-only unique indexes and the
+	// search vector dropped on the way up.
+	return baselineUp(tx)
+}
+
+// downloadRankingsUp adds the snapshots of download and trending counters
+// that the downloads and trending sort modes page against.
+func downloadRankingsUp(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		`CREATE TABLE download_ranking_snapshots (
+  id bigserial PRIMARY KEY,
+  created_at timestamptz
+)`,
+		`CREATE TABLE download_rankings (
+  snapshot_id bigint REFERENCES download_ranking_snapshots (id) ON DELETE CASCADE,
+  integration_id text,
+  downloads bigint,
+  trending_score decimal,
+  PRIMARY KEY (snapshot_id, integration_id)
+)`,
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func downloadRankingsDown(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"DROP TABLE download_rankings",
+		"DROP TABLE download_ranking_snapshots",
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// noDown reverts a data-only migration, which leaves nothing to undo.
+func noDown(*gorm.DB) error {
+	return nil
+}
+
+// prereleaseLatestUp points integrations that only have prereleases, and so
+// were left without a latest release, at their highest prerelease. Ids whose
+// listen path or name has since been taken stay unlinked.
+func prereleaseLatestUp(tx *gorm.DB) error {
+	return tx.Exec(`
+UPDATE integrations AS i
+SET latest_version = r.version, listen_path = r.listen_path
+FROM (
+  SELECT DISTINCT ON (integration_id) integration_id, version, listen_path
+  FROM integration_releases
+  WHERE yanked IS NOT TRUE
+  ORDER BY integration_id, prerelease ASC, version_key DESC, version DESC
+) AS r
+WHERE i.id = r.integration_id
+  AND i.latest_version IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM integrations AS o
+    WHERE o.id <> i.id AND o.latest_version IS NOT NULL AND (o.listen_path = r.listen_path OR o.name = i.name)
+  )`).Error
+}
+
+// releaseFlagsNotNullUp clears the yanked and deprecated flags of releases
+// stored before the columns existed, which no "yanked = false" filter
+// matches, and keeps new rows from leaving them unset.
+func releaseFlagsNotNullUp(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"UPDATE integration_releases SET yanked = FALSE WHERE yanked IS NULL",
+		"UPDATE integration_releases SET deprecated = FALSE WHERE deprecated IS NULL",
+		`ALTER TABLE integration_releases
+  ALTER COLUMN yanked SET DEFAULT FALSE,
+  ALTER COLUMN yanked SET NOT NULL,
+  ALTER COLUMN deprecated SET DEFAULT FALSE,
+  ALTER COLUMN deprecated SET NOT NULL`,
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func releaseFlagsNotNullDown(tx *gorm.DB) error {
+	return tx.Exec(`ALTER TABLE integration_releases
+  ALTER COLUMN yanked DROP NOT NULL,
+  ALTER COLUMN yanked DROP DEFAULT,
+  ALTER COLUMN deprecated DROP NOT NULL,
+  ALTER COLUMN deprecated DROP DEFAULT`).Error
+}
+
+// yankedLatestUp points integrations whose every release is yanked at their
+// highest release, so they keep their listen path and name. Ids whose
+// listen path or name has since been taken stay unlinked.
+func yankedLatestUp(tx *gorm.DB) error {
+	return tx.Exec(`
+UPDATE integrations AS i
+SET latest_version = r.version, listen_path = r.listen_path
+FROM (
+  SELECT DISTINCT ON (integration_id) integration_id, version, listen_path
+  FROM integration_releases
+  ORDER BY integration_id, prerelease ASC, version_key DESC, version DESC
+) AS r
+WHERE i.id = r.integration_id
+  AND i.latest_version IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM integrations AS o
+    WHERE o.id <> i.id AND o.latest_version IS NOT NULL AND (o.listen_path = r.listen_path OR o.name = i.name)
+  )`).Error
+}
+
+// publisherOwnersUp lets an integration id be owned by a publisher account
+// instead of a repository, and binds ids published only with API keys to
+// the account whose key published every one of their releases.
+func publisherOwnersUp(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"ALTER TABLE integration_owners ADD COLUMN publisher text NOT NULL DEFAULT ''",
+		"CREATE INDEX idx_integration_owners_publisher ON integration_owners (publisher)",
+		`INSERT INTO integration_owners (integration_id, repository, publisher, created_at, updated_at)
+SELECT r.integration_id, '', MIN(r.publisher), now(), now()
+FROM integration_releases AS r
+WHERE NOT EXISTS (SELECT 1 FROM integration_owners AS o WHERE o.integration_id = r.integration_id)
+GROUP BY r.integration_id
+HAVING COUNT(DISTINCT r.publisher) = 1
+  AND bool_or(r.verified) IS NOT TRUE
+  AND MIN(r.publisher) IN (SELECT publisher FROM publisher_api_keys)`,
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func publisherOwnersDown(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"DELETE FROM integration_owners WHERE publisher <> ''",
+		"ALTER TABLE integration_owners DROP COLUMN publisher",
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unauthenticatedPublishAttemptsUp adds daily counts of publish attempts
+// without a valid credential, which are no longer kept in publish_events,
+// and indexes publish_events by age for retention pruning.
+func unauthenticatedPublishAttemptsUp(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		`CREATE TABLE unauthenticated_publish_attempts (
+  endpoint text,
+  day timestamptz,
+  status bigint,
+  attempts bigint,
+  PRIMARY KEY (endpoint, day, status)
+)`,
+		"CREATE INDEX idx_publish_events_created_at ON publish_events (created_at)",
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unauthenticatedPublishAttemptsDown(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"DROP INDEX idx_publish_events_created_at",
+		"DROP TABLE unauthenticated_publish_attempts",
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadIPHashUp records the client address of download events apart from
+// the client hash, which now covers the install id as well, so install ids
+// rotated from one address can be capped.
+func downloadIPHashUp(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"ALTER TABLE integration_download_events ADD COLUMN ip_hash text NOT NULL DEFAULT ''",
+		"CREATE INDEX idx_integration_download_events_ip_hash ON integration_download_events (ip_hash)",
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func downloadIPHashDown(tx *gorm.DB) error {
+	return tx.Exec("ALTER TABLE integration_download_events DROP COLUMN ip_hash").Error
+}
+
+// releaseSearchVectorUp stores the search document of each release in a
+// GIN-indexed column again, as the integrations table had before
+// split_releases. The document covers the integration name, which lives on
+// integrations, so triggers rather than a generated column keep it current.
+func releaseSearchVectorUp(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		"ALTER TABLE integration_releases ADD COLUMN search_vector tsvector",
+		`CREATE FUNCTION integration_release_search_vector(id text, name text, description text, manifest jsonb)
+RETURNS tsvector LANGUAGE sql IMMUTABLE AS $$
+  SELECT setweight(to_tsvector('english', coalesce(id, '') || ' ' || coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+    setweight(jsonb_to_tsvector('english', coalesce(manifest, '{}'::jsonb), '["string"]'), 'C')
+$$`,
+		`CREATE FUNCTION integration_releases_search_vector_update() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  NEW.search_vector := integration_release_search_vector(
+    NEW.integration_id,
+    (SELECT name FROM integrations WHERE id = NEW.integration_id),
+    NEW.description,
+    NEW.manifest);
+  RETURN NEW;
+END
+$$`,
+		`CREATE TRIGGER integration_releases_search_vector
+BEFORE INSERT OR UPDATE OF integration_id, description, manifest ON integration_releases
+FOR EACH ROW EXECUTE FUNCTION integration_releases_search_vector_update()`,
+		`CREATE FUNCTION integrations_search_vector_update() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+  UPDATE integration_releases
+  SET search_vector = integration_release_search_vector(integration_id, NEW.name, description, manifest)
+  WHERE integration_id = NEW.id;
+  RETURN NULL;
+END
+$$`,
+		`CREATE TRIGGER integrations_search_vector
+AFTER UPDATE OF name ON integrations
+FOR EACH ROW WHEN (OLD.name IS DISTINCT FROM NEW.name)
+EXECUTE FUNCTION integrations_search_vector_update()`,
+		`UPDATE integration_releases AS r
+SET search_vector = integration_release_search_vector(r.integration_id, i.name, r.description, r.manifest)
+FROM integrations AS i
+WHERE i.id = r.integration_id`,
+		"CREATE INDEX integration_releases_search_vector_idx ON integration_releases USING GIN (search_vector)",
+		integrationVersionsView("r.search_vector"),
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func releaseSearchVectorDown(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		integrationVersionsView(computedSearchVector),
+		"DROP TRIGGER integrations_search_vector ON integrations",
+		"DROP TRIGGER integration_releases_search_vector ON integration_releases",
+		"DROP FUNCTION integrations_search_vector_update()",
+		"DROP FUNCTION integration_releases_search_vector_update()",
+		"DROP FUNCTION integration_release_search_vector(text, text, text, jsonb)",
+		"ALTER TABLE integration_releases DROP COLUMN search_vector",
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serverSecretsUp adds secrets the server generates once and shares between
+// replicas, such as the download hash key when none is configured.
+func serverSecretsUp(tx *gorm.DB) error {
+	return tx.Exec(`CREATE TABLE server_secrets (
+  name text PRIMARY KEY,
+  value text NOT NULL,
+  created_at timestamptz
+)`).Error
+}
+
+func serverSecretsDown(tx *gorm.DB) error {
+	return tx.Exec("DROP TABLE server_secrets").Error
+}
+
+// releaseVersionKeysUp fills version_key and prerelease for releases stored
+// before versions were parsed as semver. Stored versions keep the tag prefix
+// they were published with, which a migration cannot know, so everything
+// before the first digit is dropped. Versions that still do not parse keep
+// an empty key and sort below every valid version.
+func releaseVersionKeysUp(tx *gorm.DB) error {
+	rows := []Release{}
+	if err := tx.Model(&Release{}).
+		Select("integration_id", "version").
+		Where("version_key = ? OR version_key IS NULL", "").
+		Find(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		raw := row.Version
+		if idx := strings.IndexFunc(raw, unicode.IsDigit); idx > 0 {
+			raw = raw[idx:]
+		}
+		version, err := semver.Parse(raw, "")
+		if err != nil {
+			log.Printf("db migration skipped non-semver version id=%q version=%q", row.IntegrationID, row.Version)
+			continue
+		}
+		if err := tx.Model(&Release{}).
+			Where("integration_id = ? AND version = ?", row.IntegrationID, row.Version).
+			Updates(map[string]any{
+				"version_key": version.Key(),
+				"prerelease":  version.IsPrerelease(),
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repositoryOwnersUp qualifies bare "owner/name" repository owners with
+// github.com, and binds ids published over OIDC before ownership existed to
+// the repository of their newest verified release. The repository is derived
+// from repo_url the way store.NormalizeRepository does; ids whose repo_url is
+// not a repository URL stay unowned.
+func repositoryOwnersUp(tx *gorm.DB) error {
+	for _, stmt := range []string{
+		`UPDATE integration_owners SET repository = 'github.com/' || repository
+WHERE repository <> '' AND split_part(repository, '/', 1) NOT LIKE '%.%'`,
+		`UPDATE ownership_transfers SET from_repository = 'github.com/' || from_repository
+WHERE from_repository <> '' AND split_part(from_repository, '/', 1) NOT LIKE '%.%'`,
+		`UPDATE ownership_transfers SET to_repository = 'github.com/' || to_repository
+WHERE to_repository <> '' AND split_part(to_repository, '/', 1) NOT LIKE '%.%'`,
+		`INSERT INTO integration_owners (integration_id, repository, created_at, updated_at)
+SELECT id, repository, now(), now()
+FROM (
+  SELECT DISTINCT ON (integration_id) integration_id AS id, repo_url,
+    regexp_replace(regexp_replace(regexp_replace(lower(btrim(repo_url)), '^[^/]*://', ''), '/$', ''), '\.git$', '') AS repository
+  FROM integration_releases
+  WHERE verified
+  ORDER BY integration_id, version_key DESC
+) AS latest
+WHERE repo_url LIKE '%://%'
+  AND repository ~ '^[^/]+(/[^/]+){2,}$'
+  AND id NOT IN (SELECT integration_id FROM integration_owners)
+ON CONFLICT DO NOTHING`,
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
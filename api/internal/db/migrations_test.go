@@ -0,0 +1,48 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrationsOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration %q: expected version %d, got %d", m.Name, i+1, m.Version)
+		}
+		if m.Name == "" || m.Up == nil || m.Down == nil {
+			t.Fatalf("migration %d needs a name, up and down", m.Version)
+		}
+	}
+}
+
+func TestBaselineCoversModels(t *testing.T) {
+	tables := map[string]bool{}
+	for _, table := range baselineTables {
+		if len(table.key) == 0 {
+			t.Fatalf("table %s has no primary key", table.name)
+		}
+		tables[table.name] = true
+	}
+	for _, name := range []string{
+		"integrations",
+		IntegrationDownloadEvent{}.TableName(),
+		IntegrationDownloadDaily{}.TableName(),
+		AdminAuditEvent{}.TableName(),
+		PublisherAPIKey{}.TableName(),
+		IntegrationOwner{}.TableName(),
+		OwnershipTransfer{}.TableName(),
+		IntegrationSBOM{}.TableName(),
+		OIDCTokenUse{}.TableName(),
+		PublishEvent{}.TableName(),
+	} {
+		if !tables[name] {
+			t.Fatalf("baseline does not create %s", name)
+		}
+	}
+	for _, stmt := range baselineIndexes {
+		if !strings.Contains(stmt, "IF NOT EXISTS") {
+			t.Fatalf("baseline statement is not idempotent: %s", stmt)
+		}
+	}
+}
@@ -6,24 +6,14 @@ import (
 	"gorm.io/datatypes"
 )
 
+// Integration holds the state shared by every release of an integration.
+// LatestVersion points at the release served by default; ListenPath is
+// copied from it so listen paths of latest releases can be kept unique.
 type Integration struct {
 	ID            string `gorm:"primaryKey"`
-	Version       string `gorm:"primaryKey"`
 	Name          string
-	Description   string
-	ManifestURL   string
-	Manifest      datatypes.JSON
-	Image         string
-	Images        datatypes.JSON
-	Assets        datatypes.JSON
-	ListenPath    string `gorm:"index"`
-	ComposeFile   string
-	Deployment    datatypes.JSON
-	RepoURL       string
-	ReleaseTag    string
-	Publisher     string
-	Verified      bool
-	Latest        bool `gorm:"index"`
+	LatestVersion *string
+	ListenPath    string
 	Downloads     int64
 	TrendingScore float64
 	Featured      bool
@@ -35,12 +25,267 @@ func (Integration) TableName() string {
 	return "integrations"
 }
 
+// Release is one published (id, version) of an integration.
+type Release struct {
+	IntegrationID      string `gorm:"primaryKey"`
+	Version            string `gorm:"primaryKey"`
+	VersionKey         string `gorm:"type:text COLLATE \"C\";index"`
+	Prerelease         bool
+	Description        string
+	ManifestURL        string
+	Manifest           datatypes.JSON
+	Image              string
+	ImageDigest        string
+	Images             datatypes.JSON
+	Assets             datatypes.JSON
+	ListenPath         string `gorm:"index"`
+	ComposeFile        string
+	Deployment         datatypes.JSON
+	Attestations       datatypes.JSON
+	RepoURL            string
+	ReleaseTag         string
+	Publisher          string
+	Verified           bool
+	Yanked             bool
+	YankReason         string
+	YankedAt           *time.Time
+	Deprecated         bool
+	DeprecationMessage string
+	VersionDownloads   int64
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+func (Release) TableName() string {
+	return "integration_releases"
+}
+
+// IntegrationVersion is a release joined with its integration, as served by
+// the read-only integration_versions view.
+type IntegrationVersion struct {
+	ID                 string `gorm:"primaryKey"`
+	Version            string `gorm:"primaryKey"`
+	VersionKey         string
+	Prerelease         bool
+	Name               string
+	Description        string
+	ManifestURL        string
+	Manifest           datatypes.JSON
+	Image              string
+	ImageDigest        string
+	Images             datatypes.JSON
+	Assets             datatypes.JSON
+	ListenPath         string
+	ComposeFile        string
+	Deployment         datatypes.JSON
+	Attestations       datatypes.JSON
+	RepoURL            string
+	ReleaseTag         string
+	Publisher          string
+	Verified           bool
+	Latest             bool
+	Yanked             bool
+	YankReason         string
+	YankedAt           *time.Time
+	Deprecated         bool
+	DeprecationMessage string
+	Downloads          int64
+	VersionDownloads   int64
+	TrendingScore      float64
+	Featured           bool
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+func (IntegrationVersion) TableName() string {
+	return "integration_versions"
+}
+
 type IntegrationDownloadEvent struct {
 	ID            uint   `gorm:"primaryKey"`
 	IntegrationID string `gorm:"index"`
-	CreatedAt     time.Time
+	Version       string
+	Method        string
+	// ClientHash is a keyed hash of the client IP and install id, IPHash of
+	// the client IP alone.
+	ClientHash string    `gorm:"index"`
+	IPHash     string    `gorm:"index"`
+	CreatedAt  time.Time `gorm:"index"`
 }
 
 func (IntegrationDownloadEvent) TableName() string {
 	return "integration_download_events"
 }
+
+// IntegrationDownloadDaily holds download events rolled up per UTC day once
+// they are older than the event retention.
+type IntegrationDownloadDaily struct {
+	IntegrationID string    `gorm:"primaryKey"`
+	Version       string    `gorm:"primaryKey"`
+	Method        string    `gorm:"primaryKey"`
+	Day           time.Time `gorm:"primaryKey"`
+	Downloads     int64
+}
+
+func (IntegrationDownloadDaily) TableName() string {
+	return "integration_download_daily"
+}
+
+// DownloadRankingSnapshot is one recompute of the download counters. Listings
+// sorted by downloads or trending page against a snapshot so rows do not move
+// between pages.
+type DownloadRankingSnapshot struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+func (DownloadRankingSnapshot) TableName() string {
+	return "download_ranking_snapshots"
+}
+
+// DownloadRanking holds the counters of one integration in a snapshot.
+type DownloadRanking struct {
+	SnapshotID    uint   `gorm:"primaryKey"`
+	IntegrationID string `gorm:"primaryKey"`
+	Downloads     int64
+	TrendingScore float64
+}
+
+func (DownloadRanking) TableName() string {
+	return "download_rankings"
+}
+
+type AdminAuditEvent struct {
+	ID            uint   `gorm:"primaryKey"`
+	Actor         string `gorm:"index"`
+	Action        string
+	IntegrationID string `gorm:"index"`
+	Version       string
+	Details       datatypes.JSON
+	CreatedAt     time.Time
+}
+
+func (AdminAuditEvent) TableName() string {
+	return "admin_audit_events"
+}
+
+type PublisherAPIKey struct {
+	ID         uint   `gorm:"primaryKey"`
+	Publisher  string `gorm:"index"`
+	KeyHash    string `gorm:"uniqueIndex"`
+	Prefix     string
+	CreatedBy  string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+func (PublisherAPIKey) TableName() string {
+	return "publisher_api_keys"
+}
+
+type IntegrationOwner struct {
+	IntegrationID string `gorm:"primaryKey"`
+	Repository    string `gorm:"index"`
+	// Publisher is set instead of Repository for ids owned by the publisher
+	// account of an API key.
+	Publisher string `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (IntegrationOwner) TableName() string {
+	return "integration_owners"
+}
+
+type OwnershipTransfer struct {
+	ID             uint   `gorm:"primaryKey"`
+	IntegrationID  string `gorm:"index"`
+	FromRepository string
+	ToRepository   string
+	CreatedAt      time.Time
+	CompletedAt    *time.Time
+	CancelledAt    *time.Time
+}
+
+func (OwnershipTransfer) TableName() string {
+	return "ownership_transfers"
+}
+
+// IntegrationSBOM is the SBOM of one (id, version) release.
+type IntegrationSBOM struct {
+	IntegrationID string `gorm:"primaryKey"`
+	Version       string `gorm:"primaryKey"`
+	Format        string
+	SpecVersion   string
+	Document      datatypes.JSON
+	Summary       datatypes.JSON
+	CreatedAt     time.Time
+}
+
+func (IntegrationSBOM) TableName() string {
+	return "integration_sboms"
+}
+
+// OIDCTokenUse marks an OIDC token as spent until it expires.
+type OIDCTokenUse struct {
+	Issuer    string    `gorm:"primaryKey"`
+	TokenID   string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (OIDCTokenUse) TableName() string {
+	return "oidc_token_uses"
+}
+
+type PublishEvent struct {
+	ID            uint `gorm:"primaryKey"`
+	Endpoint      string
+	Outcome       string `gorm:"index"`
+	Status        int
+	Error         string
+	IntegrationID string `gorm:"index"`
+	Version       string
+	Publisher     string
+	Issuer        string
+	Subject       string
+	Repository    string `gorm:"index"`
+	Actor         string
+	RunID         int64
+	RunAttempt    int64
+	TokenID       string
+	Claims        datatypes.JSON
+	Request       datatypes.JSON
+	Response      datatypes.JSON
+	CreatedAt     time.Time
+}
+
+func (PublishEvent) TableName() string {
+	return "publish_events"
+}
+
+// UnauthenticatedPublishAttempt counts the publish attempts of a UTC day
+// that were rejected before a credential verified.
+type UnauthenticatedPublishAttempt struct {
+	Endpoint string    `gorm:"primaryKey"`
+	Day      time.Time `gorm:"primaryKey"`
+	Status   int       `gorm:"primaryKey"`
+	Attempts int64
+}
+
+func (UnauthenticatedPublishAttempt) TableName() string {
+	return "unauthenticated_publish_attempts"
+}
+
+// ServerSecret is a secret generated by the first server to need it, so every
+// replica and restart uses the same value.
+type ServerSecret struct {
+	Name      string `gorm:"primaryKey"`
+	Value     string
+	CreatedAt time.Time
+}
+
+func (ServerSecret) TableName() string {
+	return "server_secrets"
+}
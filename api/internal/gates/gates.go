@@ -0,0 +1,123 @@
+package gates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Release is the commit a publish was requested for.
+type Release struct {
+	// Repository is "owner/name" on the forge the gate talks to.
+	Repository string
+	Ref        string
+	SHA        string
+}
+
+// Gate is a check a release has to pass before it is published.
+type Gate interface {
+	Name() string
+	Check(ctx context.Context, release Release) error
+}
+
+type Result struct {
+	Gate   string `json:"gate"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Error reports every gate that was run when at least one failed.
+type Error struct {
+	Results []Result
+}
+
+func (e *Error) Error() string {
+	failed := []string{}
+	for _, r := range e.Results {
+		if !r.Passed {
+			failed = append(failed, r.Gate+": "+r.Error)
+		}
+	}
+	return "release gates failed: " + strings.Join(failed, "; ")
+}
+
+var ErrNoGates = errors.New("no release gates configured")
+
+// Run checks release against every gate, so the caller learns about all
+// failures at once, and returns an *Error if any failed.
+func Run(ctx context.Context, gates []Gate, release Release) ([]Result, error) {
+	if len(gates) == 0 {
+		return nil, ErrNoGates
+	}
+	results := make([]Result, 0, len(gates))
+	failed := false
+	for _, gate := range gates {
+		result := Result{Gate: gate.Name(), Passed: true}
+		if err := gate.Check(ctx, release); err != nil {
+			result.Passed = false
+			result.Error = err.Error()
+			failed = true
+		}
+		results = append(results, result)
+	}
+	if failed {
+		return results, &Error{Results: results}
+	}
+	return results, nil
+}
+
+// Parse builds gates from specs of the form "kind:argument":
+//
+//	workflow:verify.yml      the workflow file succeeded for the commit
+//	check:lint               a check run with this name succeeded for the commit
+//	branch-protection[:main] the commit is on a protected branch (default branch if omitted)
+//	repo-age:30d             the repository is at least this old
+func Parse(specs []string, gh *GitHub) ([]Gate, error) {
+	out := make([]Gate, 0, len(specs))
+	for _, spec := range specs {
+		kind, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+		arg = strings.TrimSpace(arg)
+		switch kind {
+		case "workflow":
+			if arg == "" {
+				return nil, fmt.Errorf("release gate %q needs a workflow file", spec)
+			}
+			out = append(out, WorkflowGate{GitHub: gh, Workflow: arg})
+		case "check":
+			if arg == "" {
+				return nil, fmt.Errorf("release gate %q needs a check run name", spec)
+			}
+			out = append(out, CheckRunGate{GitHub: gh, CheckName: arg})
+		case "branch-protection":
+			out = append(out, BranchProtectionGate{GitHub: gh, Branch: arg})
+		case "repo-age":
+			age, err := parseAge(arg)
+			if err != nil {
+				return nil, fmt.Errorf("release gate %q: %w", spec, err)
+			}
+			out = append(out, RepoAgeGate{GitHub: gh, MinAge: age})
+		default:
+			return nil, fmt.Errorf("release gate %q unknown", spec)
+		}
+	}
+	return out, nil
+}
+
+// parseAge accepts Go durations and whole days such as "30d".
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
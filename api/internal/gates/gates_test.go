@@ -0,0 +1,113 @@
+package gates
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestGitHub(t *testing.T, routes map[string]any) *GitHub {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, ok := routes[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(payload)
+	}))
+	t.Cleanup(srv.Close)
+	return &GitHub{BaseURL: srv.URL, HTTP: srv.Client()}
+}
+
+func TestParse(t *testing.T) {
+	gates, err := Parse([]string{"workflow:verify.yml", "check:lint", "branch-protection", "branch-protection:main", "repo-age:30d", "repo-age:36h"}, nil)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []string{"workflow:verify.yml", "check:lint", "branch-protection", "branch-protection:main", "repo-age:30d", "repo-age:36h0m0s"}
+	for i, gate := range gates {
+		if gate.Name() != want[i] {
+			t.Fatalf("gate %d: expected %q, got %q", i, want[i], gate.Name())
+		}
+	}
+	for _, spec := range []string{"workflow", "check:", "repo-age:soon", "repo-age:-1d", "signed-commits"} {
+		if _, err := Parse([]string{spec}, nil); err == nil {
+			t.Fatalf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestRunReportsEveryGate(t *testing.T) {
+	gh := newTestGitHub(t, map[string]any{
+		"/repos/acme/hue": map[string]any{"default_branch": "main", "created_at": time.Now().Add(-48 * time.Hour)},
+		"/repos/acme/hue/actions/workflows/verify.yml/runs": map[string]any{"total_count": 1},
+		"/repos/acme/hue/actions/workflows/e2e.yml/runs":    map[string]any{"total_count": 0},
+		"/repos/acme/hue/commits/abc123/check-runs": map[string]any{"check_runs": []map[string]string{
+			{"status": "completed", "conclusion": "failure"},
+		}},
+		"/repos/acme/hue/branches/main":         map[string]any{"protected": true},
+		"/repos/acme/hue/compare/main...abc123": map[string]any{"status": "behind"},
+		"/repos/acme/hue/branches/feature":      map[string]any{"protected": false},
+	})
+	gates, err := Parse([]string{
+		"workflow:verify.yml",
+		"workflow:e2e.yml",
+		"check:lint",
+		"branch-protection",
+		"branch-protection:feature",
+		"repo-age:1d",
+		"repo-age:30d",
+	}, gh)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	results, err := Run(context.Background(), gates, Release{Repository: "acme/hue", Ref: "refs/tags/v1.0.0", SHA: "abc123"})
+	var gateErr *Error
+	if !errors.As(err, &gateErr) {
+		t.Fatalf("expected gate error, got %v", err)
+	}
+	want := map[string]bool{
+		"workflow:verify.yml":       true,
+		"workflow:e2e.yml":          false,
+		"check:lint":                false,
+		"branch-protection":         true,
+		"branch-protection:feature": false,
+		"repo-age:1d":               true,
+		"repo-age:30d":              false,
+	}
+	if len(results) != len(want) || len(gateErr.Results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), results)
+	}
+	for _, r := range results {
+		if r.Passed != want[r.Gate] {
+			t.Fatalf("gate %s: expected passed=%t, got %+v", r.Gate, want[r.Gate], r)
+		}
+		if !r.Passed && r.Error == "" {
+			t.Fatalf("gate %s failed without a reason", r.Gate)
+		}
+	}
+
+	if _, err := Run(context.Background(), gates[:1], Release{Repository: "acme/hue", SHA: "abc123"}); err != nil {
+		t.Fatalf("expected passing gate, got %v", err)
+	}
+	if _, err := Run(context.Background(), nil, Release{}); !errors.Is(err, ErrNoGates) {
+		t.Fatalf("expected ErrNoGates, got %v", err)
+	}
+}
+
+func TestBranchProtectionRejectsCommitOffBranch(t *testing.T) {
+	gh := newTestGitHub(t, map[string]any{
+		"/repos/acme/hue/branches/main":         map[string]any{"protected": true},
+		"/repos/acme/hue/compare/main...def456": map[string]any{"status": "diverged"},
+	})
+	err := BranchProtectionGate{GitHub: gh, Branch: "main"}.Check(context.Background(), Release{Repository: "acme/hue", SHA: "def456"})
+	if err == nil {
+		t.Fatalf("expected commit off the protected branch to be rejected")
+	}
+}
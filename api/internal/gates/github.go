@@ -0,0 +1,196 @@
+package gates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GitHub is a minimal GitHub REST API client for the gates.
+type GitHub struct {
+	BaseURL string
+	Token   string
+	HTTP    *http.Client
+}
+
+func NewGitHub(token string) *GitHub {
+	return &GitHub{
+		BaseURL: "https://api.github.com",
+		Token:   strings.TrimSpace(token),
+		HTTP:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (g *GitHub) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(g.BaseURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "homenavi-marketplace")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	resp, err := g.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("github api error: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type repository struct {
+	DefaultBranch string    `json:"default_branch"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (g *GitHub) repository(ctx context.Context, repo string) (repository, error) {
+	var out repository
+	err := g.get(ctx, "/repos/"+repo, &out)
+	return out, err
+}
+
+// WorkflowGate requires a successful run of Workflow for the commit.
+type WorkflowGate struct {
+	GitHub   *GitHub
+	Workflow string
+}
+
+func (g WorkflowGate) Name() string {
+	return "workflow:" + g.Workflow
+}
+
+func (g WorkflowGate) Check(ctx context.Context, release Release) error {
+	var payload struct {
+		TotalCount int `json:"total_count"`
+	}
+	path := fmt.Sprintf("/repos/%s/actions/workflows/%s/runs?per_page=1&status=success&head_sha=%s",
+		release.Repository, url.PathEscape(g.Workflow), url.QueryEscape(release.SHA))
+	if err := g.GitHub.get(ctx, path, &payload); err != nil {
+		return err
+	}
+	if payload.TotalCount < 1 {
+		return fmt.Errorf("workflow %s did not pass", g.Workflow)
+	}
+	return nil
+}
+
+// CheckRunGate requires the latest check run named CheckName on the commit
+// to have succeeded.
+type CheckRunGate struct {
+	GitHub    *GitHub
+	CheckName string
+}
+
+func (g CheckRunGate) Name() string {
+	return "check:" + g.CheckName
+}
+
+func (g CheckRunGate) Check(ctx context.Context, release Release) error {
+	var payload struct {
+		CheckRuns []struct {
+			Status     string `json:"status"`
+			Conclusion string `json:"conclusion"`
+		} `json:"check_runs"`
+	}
+	path := fmt.Sprintf("/repos/%s/commits/%s/check-runs?filter=latest&per_page=100&check_name=%s",
+		release.Repository, url.PathEscape(release.SHA), url.QueryEscape(g.CheckName))
+	if err := g.GitHub.get(ctx, path, &payload); err != nil {
+		return err
+	}
+	if len(payload.CheckRuns) == 0 {
+		return fmt.Errorf("check run %s not found", g.CheckName)
+	}
+	for _, run := range payload.CheckRuns {
+		if run.Conclusion == "success" {
+			return nil
+		}
+	}
+	run := payload.CheckRuns[0]
+	if run.Status != "completed" {
+		return fmt.Errorf("check run %s is %s", g.CheckName, run.Status)
+	}
+	return fmt.Errorf("check run %s concluded %s", g.CheckName, run.Conclusion)
+}
+
+// BranchProtectionGate requires the commit to be on a protected branch, so
+// a tag cannot be cut from an unreviewed commit. Branch defaults to the
+// repository's default branch.
+type BranchProtectionGate struct {
+	GitHub *GitHub
+	Branch string
+}
+
+func (g BranchProtectionGate) Name() string {
+	if g.Branch == "" {
+		return "branch-protection"
+	}
+	return "branch-protection:" + g.Branch
+}
+
+func (g BranchProtectionGate) Check(ctx context.Context, release Release) error {
+	branch := g.Branch
+	if branch == "" {
+		repo, err := g.GitHub.repository(ctx, release.Repository)
+		if err != nil {
+			return err
+		}
+		branch = repo.DefaultBranch
+	}
+	var info struct {
+		Protected bool `json:"protected"`
+	}
+	if err := g.GitHub.get(ctx, fmt.Sprintf("/repos/%s/branches/%s", release.Repository, url.PathEscape(branch)), &info); err != nil {
+		return err
+	}
+	if !info.Protected {
+		return fmt.Errorf("branch %s is not protected", branch)
+	}
+	// Comparing branch...sha reports "behind" or "identical" when the commit
+	// is an ancestor of the branch head.
+	var compare struct {
+		Status string `json:"status"`
+	}
+	path := fmt.Sprintf("/repos/%s/compare/%s...%s", release.Repository, url.PathEscape(branch), url.PathEscape(release.SHA))
+	if err := g.GitHub.get(ctx, path, &compare); err != nil {
+		return err
+	}
+	if compare.Status != "behind" && compare.Status != "identical" {
+		return fmt.Errorf("commit %s is not on protected branch %s", release.SHA, branch)
+	}
+	return nil
+}
+
+// RepoAgeGate requires the repository to be at least MinAge old.
+type RepoAgeGate struct {
+	GitHub *GitHub
+	MinAge time.Duration
+}
+
+func (g RepoAgeGate) Name() string {
+	if g.MinAge%(24*time.Hour) == 0 {
+		return fmt.Sprintf("repo-age:%dd", g.MinAge/(24*time.Hour))
+	}
+	return "repo-age:" + g.MinAge.String()
+}
+
+func (g RepoAgeGate) Check(ctx context.Context, release Release) error {
+	repo, err := g.GitHub.repository(ctx, release.Repository)
+	if err != nil {
+		return err
+	}
+	if repo.CreatedAt.IsZero() {
+		return fmt.Errorf("repository %s has no creation date", release.Repository)
+	}
+	if age := time.Since(repo.CreatedAt); age < g.MinAge {
+		return fmt.Errorf("repository is %s old, %s required", age.Truncate(time.Hour), g.MinAge)
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/netguard"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/oci"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	mediaTypeHelmConfig = "application/vnd.cncf.helm.config.v1+json"
+	mediaTypeHelmChart  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	maxDownloadSize     = 10 << 20
+)
+
+var (
+	ErrInvalidRef      = errors.New("chart_ref must be oci://registry/repository/chart or an http(s) chart repository url ending in the chart name")
+	ErrVersionNotFound = errors.New("chart version not found")
+)
+
+// Ref is a parsed chart reference. OCI refs name the chart repository in a
+// registry; HTTP refs are a chart repository URL followed by the chart name.
+type Ref struct {
+	Raw        string
+	OCI        bool
+	Registry   string
+	Repository string
+	RepoURL    string
+	Chart      string
+}
+
+func ParseRef(raw string) (Ref, error) {
+	ref := Ref{Raw: strings.TrimSpace(raw)}
+	switch {
+	case strings.HasPrefix(ref.Raw, "oci://"):
+		registry, repository, ok := strings.Cut(strings.TrimPrefix(ref.Raw, "oci://"), "/")
+		if !ok || registry == "" {
+			return ref, ErrInvalidRef
+		}
+		if strings.ContainsAny(repository, ":@") {
+			return ref, fmt.Errorf("%w: pass the chart version separately instead of a tag or digest", ErrInvalidRef)
+		}
+		if err := oci.ValidateRepository(repository); err != nil {
+			return ref, ErrInvalidRef
+		}
+		ref.OCI = true
+		ref.Registry = registry
+		ref.Repository = repository
+		ref.Chart = path.Base(repository)
+	case strings.HasPrefix(ref.Raw, "https://"):
+		parsed, err := url.Parse(strings.TrimSuffix(ref.Raw, "/"))
+		if err != nil || parsed.Host == "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+			return ref, ErrInvalidRef
+		}
+		chart := path.Base(parsed.Path)
+		if chart == "" || chart == "/" || chart == "." || strings.HasSuffix(chart, ".tgz") || strings.HasSuffix(chart, ".yaml") {
+			return ref, ErrInvalidRef
+		}
+		parsed.Path = path.Dir(parsed.Path)
+		ref.RepoURL = strings.TrimSuffix(parsed.String(), "/")
+		ref.Chart = chart
+	default:
+		return ref, ErrInvalidRef
+	}
+	return ref, nil
+}
+
+type Chart struct {
+	Name       string
+	Version    string
+	AppVersion string
+	Values     map[string]any
+}
+
+// ValidationError lists every inconsistency between a chart and the release.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "helm chart inconsistent with image: " + strings.Join(e.Problems, "; ")
+}
+
+type Checker struct {
+	OCI  *oci.Client
+	HTTP *http.Client
+}
+
+// NewChecker returns a checker whose chart repository client only fetches
+// over https from public addresses, since chart refs come from publishers.
+func NewChecker() *Checker {
+	return &Checker{
+		OCI:  oci.NewClient(),
+		HTTP: netguard.NewClient(15 * time.Second),
+	}
+}
+
+// Validate checks that chartRef is well formed, that version exists and that
+// the chart deploys image.
+func (c *Checker) Validate(ctx context.Context, chartRef, version, image string) error {
+	ref, err := ParseRef(chartRef)
+	if err != nil {
+		return err
+	}
+	chart, err := c.Fetch(ctx, ref, version)
+	if err != nil {
+		return err
+	}
+	if problems := CheckImage(chart, image); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Fetch downloads version of the chart. A leading "v" on version is ignored
+// when the exact version does not exist.
+func (c *Checker) Fetch(ctx context.Context, ref Ref, version string) (*Chart, error) {
+	if ref.OCI {
+		return c.fetchOCI(ctx, ref, version)
+	}
+	return c.fetchHTTP(ctx, ref, version)
+}
+
+func (c *Checker) fetchOCI(ctx context.Context, ref Ref, version string) (*Chart, error) {
+	var manifest *oci.Manifest
+	for _, tag := range candidateVersions(version) {
+		// OCI tags cannot contain '+', so helm push stores build metadata as '_'.
+		found, _, err := c.OCI.Manifest(ctx, ref.Registry, ref.Repository, strings.ReplaceAll(tag, "+", "_"), oci.MediaTypeOCIManifest)
+		if errors.Is(err, oci.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifest = found
+		break
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrVersionNotFound, ref.Raw, version)
+	}
+	if manifest.Config.MediaType != mediaTypeHelmConfig {
+		return nil, fmt.Errorf("%s is not a helm chart (config %s)", ref.Raw, manifest.Config.MediaType)
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType != mediaTypeHelmChart {
+			continue
+		}
+		data, err := c.OCI.Blob(ctx, ref.Registry, ref.Repository, layer.Digest, maxDownloadSize)
+		if err != nil {
+			return nil, err
+		}
+		// The chart is checked against the digest the manifest names rather
+		// than trusted as whatever the registry served.
+		sum := sha256.Sum256(data)
+		if "sha256:"+hex.EncodeToString(sum[:]) != layer.Digest {
+			return nil, fmt.Errorf("%s %s chart layer does not match its digest %s", ref.Raw, version, layer.Digest)
+		}
+		return readArchive(data)
+	}
+	return nil, fmt.Errorf("%s %s has no chart content layer", ref.Raw, version)
+}
+
+func (c *Checker) fetchHTTP(ctx context.Context, ref Ref, version string) (*Chart, error) {
+	data, err := c.download(ctx, ref.RepoURL+"/index.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("chart repository index: %w", err)
+	}
+	var index struct {
+		Entries map[string][]struct {
+			Version string   `yaml:"version"`
+			URLs    []string `yaml:"urls"`
+		} `yaml:"entries"`
+	}
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("chart repository index invalid: %w", err)
+	}
+	entries, ok := index.Entries[ref.Chart]
+	if !ok {
+		return nil, fmt.Errorf("chart %s not found in %s", ref.Chart, ref.RepoURL)
+	}
+	for _, entry := range entries {
+		if !sameVersion(entry.Version, version) || len(entry.URLs) == 0 {
+			continue
+		}
+		chartURL, err := url.Parse(ref.RepoURL + "/")
+		if err != nil {
+			return nil, err
+		}
+		target, err := chartURL.Parse(entry.URLs[0])
+		if err != nil {
+			return nil, err
+		}
+		archive, err := c.download(ctx, target.String())
+		if err != nil {
+			return nil, fmt.Errorf("chart archive: %w", err)
+		}
+		return readArchive(archive)
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrVersionNotFound, ref.Raw, version)
+}
+
+func (c *Checker) download(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "homenavi-marketplace")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", target, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxDownloadSize {
+		return nil, fmt.Errorf("GET %s: larger than %d bytes", target, maxDownloadSize)
+	}
+	return body, nil
+}
+
+// readArchive reads Chart.yaml and values.yaml from the top-level directory
+// of a packaged chart; subcharts are ignored.
+func readArchive(data []byte) (*Chart, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("chart archive invalid: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var chart *Chart
+	values := map[string]any{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("chart archive invalid: %w", err)
+		}
+		parts := strings.Split(strings.TrimPrefix(header.Name, "./"), "/")
+		if len(parts) != 2 {
+			continue
+		}
+		content, err := io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+		if err != nil {
+			return nil, err
+		}
+		switch parts[1] {
+		case "Chart.yaml":
+			var meta struct {
+				Name       string `yaml:"name"`
+				Version    string `yaml:"version"`
+				AppVersion string `yaml:"appVersion"`
+			}
+			if err := yaml.Unmarshal(content, &meta); err != nil {
+				return nil, fmt.Errorf("Chart.yaml invalid: %w", err)
+			}
+			chart = &Chart{Name: meta.Name, Version: meta.Version, AppVersion: meta.AppVersion}
+		case "values.yaml":
+			if err := yaml.Unmarshal(content, &values); err != nil {
+				return nil, fmt.Errorf("values.yaml invalid: %w", err)
+			}
+		}
+	}
+	if chart == nil {
+		return nil, errors.New("chart archive has no Chart.yaml")
+	}
+	chart.Values = values
+	return chart, nil
+}
+
+// CheckImage compares the chart's default image with the published image.
+// The repository must match; the tag the chart deploys (image.tag, falling
+// back to appVersion as helm create charts do) must match the image tag
+// unless the image is pinned by digest or tagged "latest".
+func CheckImage(chart *Chart, image string) []string {
+	published, err := oci.ParseImage(image)
+	if err != nil {
+		return []string{"image is not a valid reference"}
+	}
+	problems := []string{}
+	repository, tag := chartImage(chart.Values)
+	source := "values.yaml image.tag"
+	if repository != "" {
+		parsed, err := oci.ParseImage(repository)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("values.yaml image %q is not a valid reference", repository))
+		} else {
+			if parsed.Name() != published.Name() {
+				problems = append(problems, fmt.Sprintf("values.yaml image %s does not match image %s", parsed.Name(), published.Name()))
+			}
+			if tag == "" && parsed.Tag != "" {
+				tag, source = parsed.Tag, "values.yaml image"
+			}
+		}
+	}
+	if tag == "" {
+		tag, source = chart.AppVersion, "appVersion"
+	}
+	if tag != "" && published.Digest == "" && published.Tag != "" && published.Tag != "latest" && !sameVersion(tag, published.Tag) {
+		problems = append(problems, fmt.Sprintf("%s %s does not match image tag %s", source, tag, published.Tag))
+	}
+	return problems
+}
+
+// chartImage reads image.repository (with optional image.registry) and
+// image.tag, or a plain "image: repo:tag" string.
+func chartImage(values map[string]any) (string, string) {
+	switch image := values["image"].(type) {
+	case string:
+		return image, ""
+	case map[string]any:
+		repository := fmt.Sprint(valueOr(image["repository"], ""))
+		if registry := fmt.Sprint(valueOr(image["registry"], "")); registry != "" && repository != "" {
+			repository = registry + "/" + repository
+		}
+		return repository, fmt.Sprint(valueOr(image["tag"], ""))
+	}
+	return "", ""
+}
+
+func valueOr(value, fallback any) any {
+	if value == nil {
+		return fallback
+	}
+	return value
+}
+
+func candidateVersions(version string) []string {
+	trimmed := strings.TrimPrefix(version, "v")
+	if trimmed == version {
+		return []string{version}
+	}
+	return []string{version, trimmed}
+}
+
+func sameVersion(a, b string) bool {
+	va, errA := semver.Parse(a, "")
+	vb, errB := semver.Parse(b, "")
+	if errA == nil && errB == nil {
+		return va.Compare(vb) == 0
+	}
+	return strings.TrimPrefix(a, "v") == strings.TrimPrefix(b, "v")
+}
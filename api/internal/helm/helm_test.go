@@ -0,0 +1,176 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/netguard"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/oci"
+)
+
+func TestParseRef(t *testing.T) {
+	cases := []struct {
+		raw     string
+		wantErr bool
+		chart   string
+	}{
+		{raw: "oci://ghcr.io/petoadam/charts/homenavi-spotify", chart: "homenavi-spotify"},
+		{raw: "https://charts.example.com/stable/homenavi-hue", chart: "homenavi-hue"},
+		{raw: "oci://ghcr.io/petoadam/homenavi-spotify:1.0.0", wantErr: true},
+		{raw: "oci://ghcr.io/PetoAdam/homenavi-spotify", wantErr: true},
+		{raw: "oci://ghcr.io", wantErr: true},
+		{raw: "ghcr.io/petoadam/homenavi-spotify", wantErr: true},
+		{raw: "https://charts.example.com/homenavi-hue-1.0.0.tgz", wantErr: true},
+		{raw: "http://charts.example.com/stable/homenavi-hue", wantErr: true},
+	}
+	for _, tc := range cases {
+		ref, err := ParseRef(tc.raw)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseRef(%q) expected error", tc.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRef(%q): %v", tc.raw, err)
+			continue
+		}
+		if ref.Chart != tc.chart {
+			t.Errorf("ParseRef(%q) chart = %q, want %q", tc.raw, ref.Chart, tc.chart)
+		}
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	chart := &Chart{
+		AppVersion: "1.2.0",
+		Values: map[string]any{
+			"image": map[string]any{"repository": "ghcr.io/petoadam/homenavi-spotify", "tag": ""},
+		},
+	}
+	if problems := CheckImage(chart, "ghcr.io/petoadam/homenavi-spotify:v1.2.0"); len(problems) != 0 {
+		t.Fatalf("expected consistent chart, got %v", problems)
+	}
+	if problems := CheckImage(chart, "ghcr.io/petoadam/homenavi-spotify:1.3.0"); len(problems) != 1 {
+		t.Fatalf("expected appVersion mismatch, got %v", problems)
+	}
+	if problems := CheckImage(chart, "ghcr.io/petoadam/homenavi-spotify@sha256:"+strings.Repeat("a", 64)); len(problems) != 0 {
+		t.Fatalf("expected digest-pinned image to skip the tag check, got %v", problems)
+	}
+	problems := CheckImage(chart, "ghcr.io/example/other:1.3.0")
+	if len(problems) != 2 {
+		t.Fatalf("expected repository and tag problems, got %v", problems)
+	}
+}
+
+func TestValidateHTTPRepository(t *testing.T) {
+	archive := chartArchive(t, "homenavi-hue", "0.3.0", "1.0.0", "image:\n  repository: ghcr.io/example/homenavi-hue\n")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stable/index.yaml", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("apiVersion: v1\nentries:\n  homenavi-hue:\n    - version: 0.3.0\n      urls: [homenavi-hue-0.3.0.tgz]\n"))
+	})
+	mux.HandleFunc("/stable/homenavi-hue-0.3.0.tgz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	checker := NewChecker()
+	ref := srv.URL + "/stable/homenavi-hue"
+	if err := checker.Validate(context.Background(), ref, "0.3.0", "ghcr.io/example/homenavi-hue:1.0.0"); !errors.Is(err, netguard.ErrNotPublic) {
+		t.Fatalf("expected the default client to refuse a loopback repository, got %v", err)
+	}
+	checker.HTTP = srv.Client()
+	if err := checker.Validate(context.Background(), ref, "0.3.0", "ghcr.io/example/homenavi-hue:1.0.0"); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := checker.Validate(context.Background(), ref, "0.4.0", "ghcr.io/example/homenavi-hue:1.0.0"); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("expected ErrVersionNotFound, got %v", err)
+	}
+	var validationErr *ValidationError
+	if err := checker.Validate(context.Background(), ref, "0.3.0", "ghcr.io/example/homenavi-hue:2.0.0"); !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+}
+
+func TestValidateOCIRegistry(t *testing.T) {
+	archive := chartArchive(t, "homenavi-spotify", "1.0.0", "1.0.0", "image:\n  repository: ghcr.io/petoadam/homenavi-spotify\n")
+	sum := sha256.Sum256(archive)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	manifest, _ := json.Marshal(oci.Manifest{
+		MediaType: oci.MediaTypeOCIManifest,
+		Config:    oci.Descriptor{MediaType: mediaTypeHelmConfig, Digest: "sha256:" + strings.Repeat("c", 64)},
+		Layers:    []oci.Descriptor{{MediaType: mediaTypeHelmChart, Digest: digest}},
+	})
+	// 1.2.0 names a layer digest that the served archive does not match.
+	tampered, _ := json.Marshal(oci.Manifest{
+		MediaType: oci.MediaTypeOCIManifest,
+		Config:    oci.Descriptor{MediaType: mediaTypeHelmConfig, Digest: "sha256:" + strings.Repeat("c", 64)},
+		Layers:    []oci.Descriptor{{MediaType: mediaTypeHelmChart, Digest: "sha256:" + strings.Repeat("d", 64)}},
+	})
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/petoadam/charts/homenavi-spotify/manifests/1.0.0":
+			w.Header().Set("Content-Type", oci.MediaTypeOCIManifest)
+			_, _ = w.Write(manifest)
+		case "/v2/petoadam/charts/homenavi-spotify/manifests/1.2.0":
+			w.Header().Set("Content-Type", oci.MediaTypeOCIManifest)
+			_, _ = w.Write(tampered)
+		case "/v2/petoadam/charts/homenavi-spotify/blobs/" + digest,
+			"/v2/petoadam/charts/homenavi-spotify/blobs/sha256:" + strings.Repeat("d", 64):
+			_, _ = w.Write(archive)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	checker := NewChecker()
+	checker.OCI.HTTP = srv.Client()
+	ref := "oci://" + strings.TrimPrefix(srv.URL, "https://") + "/petoadam/charts/homenavi-spotify"
+	if err := checker.Validate(context.Background(), ref, "v1.0.0", "ghcr.io/petoadam/homenavi-spotify:v1.0.0"); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if err := checker.Validate(context.Background(), ref, "1.1.0", "ghcr.io/petoadam/homenavi-spotify:v1.1.0"); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("expected ErrVersionNotFound, got %v", err)
+	}
+	if err := checker.Validate(context.Background(), ref, "1.2.0", "ghcr.io/petoadam/homenavi-spotify:v1.0.0"); err == nil || !strings.Contains(err.Error(), "does not match its digest") {
+		t.Fatalf("expected a chart that does not match its digest to be rejected, got %v", err)
+	}
+}
+
+func chartArchive(t *testing.T, name, version, appVersion, values string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := map[string]string{
+		name + "/Chart.yaml":  "apiVersion: v2\nname: " + name + "\nversion: " + version + "\nappVersion: \"" + appVersion + "\"\n",
+		name + "/values.yaml": values,
+	}
+	for path, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: path, Mode: 0o644, Size: int64(len(content))}); err != nil {
+			t.Fatalf("tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("tar write: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
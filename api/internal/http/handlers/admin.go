@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/http/middleware"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	DB               *gorm.DB
+	PrereleaseLatest bool
+}
+
+func (h AdminHandler) SetFeatured(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req models.FeaturedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if err := h.audited(r, "set_featured", id, "", func(tx *gorm.DB) (map[string]any, error) {
+		return map[string]any{"featured": req.Featured}, store.SetFeatured(r.Context(), tx, id, req.Featured)
+	}); err != nil {
+		writeStoreError(w, err, "failed to update featured")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "featured": req.Featured})
+}
+
+func (h AdminHandler) SetVerified(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	version := chi.URLParam(r, "version")
+	var req models.VerifiedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	var item *models.Integration
+	if err := h.audited(r, "set_verified", id, version, func(tx *gorm.DB) (map[string]any, error) {
+		var err error
+		item, err = store.SetVerified(r.Context(), tx, id, version, req.Verified)
+		return map[string]any{"verified": req.Verified}, err
+	}); err != nil {
+		writeStoreError(w, err, "failed to update verified")
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (h AdminHandler) Yank(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	version := chi.URLParam(r, "version")
+	var req models.YankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		writeError(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+	var item *models.Integration
+	if err := h.audited(r, "yank", id, version, func(tx *gorm.DB) (map[string]any, error) {
+		var err error
+		item, err = store.YankRelease(r.Context(), tx, id, version, req.Reason, h.PrereleaseLatest)
+		return map[string]any{"reason": req.Reason}, err
+	}); err != nil {
+		writeStoreError(w, err, "failed to yank release")
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (h AdminHandler) Unyank(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	version := chi.URLParam(r, "version")
+	var item *models.Integration
+	if err := h.audited(r, "unyank", id, version, func(tx *gorm.DB) (map[string]any, error) {
+		var err error
+		item, err = store.UnyankRelease(r.Context(), tx, id, version, h.PrereleaseLatest)
+		return nil, err
+	}); err != nil {
+		writeStoreError(w, err, "failed to unyank release")
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (h AdminHandler) DeleteRelease(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	version := chi.URLParam(r, "version")
+	if err := h.audited(r, "delete_release", id, version, func(tx *gorm.DB) (map[string]any, error) {
+		return nil, store.DeleteRelease(r.Context(), tx, id, version, h.PrereleaseLatest)
+	}); err != nil {
+		writeStoreError(w, err, "failed to delete release")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h AdminHandler) Reassign(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req models.ReassignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	req.NewID = strings.TrimSpace(req.NewID)
+	if req.NewID == "" || req.NewID == id {
+		writeError(w, http.StatusBadRequest, "new_id must be set and differ from the current id")
+		return
+	}
+	if err := h.audited(r, "reassign_id", req.NewID, "", func(tx *gorm.DB) (map[string]any, error) {
+		return map[string]any{"old_id": id, "new_id": req.NewID}, store.ReassignIntegration(r.Context(), tx, id, req.NewID)
+	}); err != nil {
+		if errors.Is(err, store.ErrIDInUse) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeStoreError(w, err, "failed to reassign integration")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"id": req.NewID, "old_id": id})
+}
+
+func (h AdminHandler) SetOwner(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var req models.OwnerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	var owner *models.Ownership
+	if err := h.audited(r, "set_owner", id, "", func(tx *gorm.DB) (map[string]any, error) {
+		previous := ""
+		if current, err := store.GetOwnership(r.Context(), tx, id); err == nil {
+			previous = current.Repository
+		}
+		var err error
+		if owner, err = store.SetOwner(r.Context(), tx, id, req.Repository); err != nil {
+			return nil, err
+		}
+		return map[string]any{"from": previous, "to": owner.Repository}, nil
+	}); err != nil {
+		writeOwnershipError(w, err, "failed to set owner")
+		return
+	}
+	writeJSON(w, http.StatusOK, owner)
+}
+
+func (h AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	publisher := strings.TrimSpace(chi.URLParam(r, "publisher"))
+	if publisher == "" {
+		writeError(w, http.StatusBadRequest, "publisher is required")
+		return
+	}
+	var key *models.APIKey
+	if err := h.audited(r, "create_api_key", "", "", func(tx *gorm.DB) (map[string]any, error) {
+		var err error
+		if key, err = store.CreateAPIKey(r.Context(), tx, publisher, middleware.AdminActor(r.Context())); err != nil {
+			return nil, err
+		}
+		return map[string]any{"publisher": publisher, "key_id": key.ID, "prefix": key.Prefix}, nil
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create api key")
+		return
+	}
+	writeJSON(w, http.StatusCreated, key)
+}
+
+func (h AdminHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	publisher := strings.TrimSpace(chi.URLParam(r, "publisher"))
+	keys, err := store.ListAPIKeys(r.Context(), h.DB, publisher)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list api keys")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+func (h AdminHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.ParseUint(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid key id")
+		return
+	}
+	var key *models.APIKey
+	if err := h.audited(r, "revoke_api_key", "", "", func(tx *gorm.DB) (map[string]any, error) {
+		var err error
+		if key, err = store.RevokeAPIKey(r.Context(), tx, uint(keyID)); err != nil {
+			return nil, err
+		}
+		return map[string]any{"publisher": key.Publisher, "key_id": key.ID, "prefix": key.Prefix}, nil
+	}); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "api key not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to revoke api key")
+		return
+	}
+	writeJSON(w, http.StatusOK, key)
+}
+
+func (h AdminHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	page, err := pageFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter := store.AuditFilter{
+		IntegrationID: strings.TrimSpace(r.URL.Query().Get("integration_id")),
+		Actor:         strings.TrimSpace(r.URL.Query().Get("actor")),
+	}
+	events, nextCursor, err := store.ListAuditEvents(r.Context(), h.DB, filter, page)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to list audit events")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events, "next_cursor": nullableString(nextCursor)})
+}
+
+// PublishEvents lists publish attempts, newest first, filtered by
+// integration_id, repository or outcome (published, rejected, error).
+func (h AdminHandler) PublishEvents(w http.ResponseWriter, r *http.Request) {
+	page, err := pageFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter := store.PublishEventFilter{
+		IntegrationID: strings.TrimSpace(r.URL.Query().Get("integration_id")),
+		Repository:    store.NormalizeRepository(r.URL.Query().Get("repository")),
+		Outcome:       strings.TrimSpace(r.URL.Query().Get("outcome")),
+	}
+	events, nextCursor, err := store.ListPublishEvents(r.Context(), h.DB, filter, page)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to list publish events")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": events, "next_cursor": nullableString(nextCursor)})
+}
+
+// UnauthenticatedPublishAttempts returns the daily counts of publish
+// attempts rejected before their credential verified, for the last days
+// (default 30).
+func (h AdminHandler) UnauthenticatedPublishAttempts(w http.ResponseWriter, r *http.Request) {
+	days := 30
+	if raw := strings.TrimSpace(r.URL.Query().Get("days")); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			writeError(w, http.StatusBadRequest, "days must be a positive integer")
+			return
+		}
+		days = parsed
+	}
+	attempts, err := store.ListUnauthenticatedPublishAttempts(r.Context(), h.DB, time.Now().AddDate(0, 0, -(days-1)))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list publish attempts")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"attempts": attempts})
+}
+
+// audited applies an admin action and records its audit event in one
+// transaction, so no action lands without an audit trail. apply must only use
+// the transaction it is given and returns the event details.
+func (h AdminHandler) audited(r *http.Request, action, id, version string, apply func(tx *gorm.DB) (map[string]any, error)) error {
+	actor := middleware.AdminActor(r.Context())
+	err := h.DB.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		details, err := apply(tx)
+		if err != nil {
+			return err
+		}
+		event := models.AuditEvent{Actor: actor, Action: action, IntegrationID: id, Version: version, Details: details}
+		return store.RecordAuditEvent(r.Context(), tx, event)
+	})
+	if err != nil {
+		log.Printf("admin %s failed actor=%q id=%q version=%q: %v", action, actor, id, version, err)
+		return err
+	}
+	log.Printf("admin %s actor=%q id=%q version=%q", action, actor, id, version)
+	return nil
+}
+
+func writeStoreError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(w, http.StatusNotFound, "integration not found")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,55 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/http/server"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestAdminActionFailsWithoutAuditTrail(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := testRelease()
+	if _, err := store.PublishIntegration(ctx, pool, req, store.PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	h := server.NewWithVerifier(config.Config{AdminTokens: []string{"alice:secret"}}, pool, stubOIDCVerifier{})
+	feature := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/api/admin/integrations/spotify/featured", bytes.NewReader([]byte(`{"featured":true}`)))
+		r.Header.Set("X-Marketplace-Token", "secret")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, r)
+		return res.Code
+	}
+
+	if err := pool.Exec("ALTER TABLE admin_audit_events RENAME TO admin_audit_events_off").Error; err != nil {
+		t.Fatalf("disable audit log: %v", err)
+	}
+	if code := feature(); code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when the audit event cannot be written, got %d", code)
+	}
+	item, err := store.GetIntegration(ctx, pool, "spotify", "")
+	if err != nil || item.Featured {
+		t.Fatalf("expected the unaudited action rolled back, got %+v %v", item, err)
+	}
+
+	if err := pool.Exec("ALTER TABLE admin_audit_events_off RENAME TO admin_audit_events").Error; err != nil {
+		t.Fatalf("enable audit log: %v", err)
+	}
+	if code := feature(); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	events, _, err := store.ListAuditEvents(ctx, pool, store.AuditFilter{IntegrationID: "spotify"}, store.Page{})
+	if err != nil || len(events) != 1 || events[0].Actor != "alice" || events[0].Action != "set_featured" {
+		t.Fatalf("expected one set_featured event by alice, got %+v %v", events, err)
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/http/middleware"
+)
+
+const maxInstallIDLength = 128
+
+// downloadClientHashes identify the client reporting a download. The client
+// hash covers its IP and the X-Install-ID header a host sends, so rotating
+// install ids from one address never escapes the per-IP cap keyed by the IP
+// hash. Only the keyed hashes are stored.
+func (h IntegrationsHandler) downloadClientHashes(r *http.Request) (client, ip string) {
+	addr := "ip:" + middleware.ClientIP(r, h.TrustProxyHeaders)
+	client = addr
+	if installID := strings.TrimSpace(r.Header.Get("X-Install-ID")); installID != "" && len(installID) <= maxInstallIDLength {
+		client = addr + "|install:" + installID
+	}
+	return h.downloadHash(client), h.downloadHash(addr)
+}
+
+func (h IntegrationsHandler) downloadHash(value string) string {
+	mac := hmac.New(sha256.New, h.DownloadHashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDownloadClientHash(t *testing.T) {
+	h := IntegrationsHandler{DownloadHashKey: []byte("secret")}
+	request := func(remote, installID string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/integrations/spotify/downloads", nil)
+		req.RemoteAddr = remote
+		if installID != "" {
+			req.Header.Set("X-Install-ID", installID)
+		}
+		return req
+	}
+
+	byIP, ip := h.downloadClientHashes(request("192.0.2.1:1000", ""))
+	if again, _ := h.downloadClientHashes(request("192.0.2.1:2000", "")); again != byIP {
+		t.Fatalf("expected the same client hash for one IP")
+	}
+	if other, _ := h.downloadClientHashes(request("192.0.2.2:1000", "")); other == byIP {
+		t.Fatalf("expected different IPs to hash differently")
+	}
+	byInstall, installIP := h.downloadClientHashes(request("192.0.2.1:1000", "install-1"))
+	if byInstall == byIP || installIP != ip {
+		t.Fatalf("expected the install id to split clients behind one IP and keep the IP hash")
+	}
+	if moved, _ := h.downloadClientHashes(request("198.51.100.1:1000", "install-1")); moved == byInstall {
+		t.Fatalf("expected the client hash to cover the IP as well as the install id")
+	}
+	other := IntegrationsHandler{DownloadHashKey: []byte("other")}
+	if keyed, _ := other.downloadClientHashes(request("192.0.2.1:1000", "")); keyed == byIP {
+		t.Fatalf("expected the hash to depend on the key")
+	}
+}
+
+func TestDownloadClientHashesRotatingInstallIDs(t *testing.T) {
+	h := IntegrationsHandler{DownloadHashKey: []byte("secret")}
+	clients := map[string]bool{}
+	ips := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/integrations/spotify/downloads", nil)
+		req.RemoteAddr = "192.0.2.1:1000"
+		req.Header.Set("X-Install-ID", fmt.Sprintf("install-%d", i))
+		client, ip := h.downloadClientHashes(req)
+		clients[client] = true
+		ips[ip] = true
+	}
+	// The store caps the clients counted per IP hash, so every rotated id
+	// must still carry the one address.
+	if len(clients) != 10 || len(ips) != 1 {
+		t.Fatalf("expected 10 clients behind one IP hash, got %d clients and %d IP hashes", len(clients), len(ips))
+	}
+}
@@ -14,3 +14,10 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, map[string]string{"error": message})
 }
+
+func nullableString(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
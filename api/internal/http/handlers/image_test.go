@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/oci"
+)
+
+func TestResolveImage(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("e", 64)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/petoadam/homenavi-spotify/manifests/v0.2.0", "/v2/petoadam/homenavi-spotify/manifests/" + digest:
+			w.Header().Set("Content-Type", oci.MediaTypeOCIManifest)
+			w.Header().Set("Docker-Content-Digest", digest)
+			_, _ = w.Write([]byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	registry := oci.NewClient()
+	registry.HTTP = srv.Client()
+	h := IntegrationsHandler{OIDCTagPrefix: "v", VerifyImages: true, Registry: registry}
+	host := strings.TrimPrefix(srv.URL, "https://")
+	req := testPublishRequest(t)
+	req.Version = "0.2.0"
+
+	req.Image = host + "/petoadam/homenavi-spotify:v0.2.0"
+	got, err := h.resolveImage(context.Background(), req)
+	if err != nil || got != digest {
+		t.Fatalf("expected digest %s, got %q (%v)", digest, got, err)
+	}
+
+	req.Image = host + "/petoadam/homenavi-spotify@" + digest
+	if got, err := h.resolveImage(context.Background(), req); err != nil || got != digest {
+		t.Fatalf("expected digest-pinned image to resolve, got %q (%v)", got, err)
+	}
+
+	var fieldErr errField
+	req.Image = host + "/petoadam/homenavi-spotify:v0.3.0"
+	if _, err := h.resolveImage(context.Background(), req); !errors.As(err, &fieldErr) || !strings.Contains(err.Error(), "tag must match") {
+		t.Fatalf("expected tag mismatch, got %v", err)
+	}
+
+	req.Image = host + "/petoadam/missing:v0.2.0"
+	if _, err := h.resolveImage(context.Background(), req); !errors.As(err, &fieldErr) || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected missing image, got %v", err)
+	}
+
+	h.Registry = oci.NewClient()
+	req.Image = host + "/petoadam/homenavi-spotify:v0.2.0"
+	if _, err := h.resolveImage(context.Background(), req); !errors.As(err, &fieldErr) || !strings.Contains(err.Error(), "public address") {
+		t.Fatalf("expected the default registry client to refuse a loopback registry, got %v", err)
+	}
+
+	h.VerifyImages = false
+	if got, err := h.resolveImage(context.Background(), req); err != nil || got != "" {
+		t.Fatalf("expected verification to be skipped, got %q (%v)", got, err)
+	}
+}
@@ -1,39 +1,133 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/compose"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/cosign"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/gates"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/helm"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/manifest"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/netguard"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/oci"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/sbom"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
 	"github.com/go-chi/chi/v5"
-	"gopkg.in/yaml.v3"
 	"gorm.io/gorm"
 )
 
+var publishHTTPClient = netguard.NewClient(6 * time.Second)
+
 type IntegrationsHandler struct {
-	DB            *gorm.DB
-	OIDCVerifier  OIDCVerifier
-	OIDCTagPrefix string
+	DB               *gorm.DB
+	OIDCVerifier     OIDCVerifier
+	OIDCTagPrefix    string
+	PrereleaseLatest bool
+	// ComposePolicy restricts compose files; nil means compose.DefaultPolicy.
+	ComposePolicy *compose.Policy
+	// PublishHTTP fetches manifest_url and compose_file on publish; nil means
+	// netguard.NewClient, which only reaches public https URLs.
+	PublishHTTP *http.Client
+	// ChartChecker fetches chart refs on publish; nil means helm.NewChecker.
+	ChartChecker *helm.Checker
+	// VerifyImages resolves image to a registry digest on publish.
+	VerifyImages bool
+	// Registry is used by VerifyImages; nil means oci.NewClient.
+	Registry *oci.Client
+	// Cosign verifies signatures and provenance on OIDC publishes according
+	// to SignatureMode and ProvenanceMode.
+	Cosign         *cosign.Verifier
+	SignatureMode  cosign.Mode
+	ProvenanceMode cosign.Mode
+	// VulnDB matches release SBOMs against known advisories on Get; nil
+	// disables matching.
+	VulnDB *sbom.VulnDB
+	// Downloads by one client are keyed by an HMAC of its IP and install id
+	// under DownloadHashKey and counted once per DownloadDedupWindow. At most
+	// DownloadInstallsPerIP install ids per IP are counted in that window.
+	DownloadHashKey       []byte
+	DownloadDedupWindow   time.Duration
+	DownloadInstallsPerIP int
+	TrustProxyHeaders     bool
 }
 
 func (h IntegrationsHandler) List(w http.ResponseWriter, r *http.Request) {
-	latestOnly := true
-	if strings.EqualFold(r.URL.Query().Get("latest"), "false") {
-		latestOnly = false
+	opts, err := listOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-	featuredOnly := strings.EqualFold(r.URL.Query().Get("featured"), "true")
-	sortBy := r.URL.Query().Get("sort")
-	items, err := store.ListIntegrations(r.Context(), h.DB, latestOnly, sortBy, featuredOnly)
+	items, nextCursor, err := store.ListIntegrations(r.Context(), h.DB, opts)
 	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to list integrations")
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"integrations": items})
+	writeJSON(w, http.StatusOK, map[string]any{"integrations": items, "next_cursor": nullableString(nextCursor)})
+}
+
+func pageFromQuery(values url.Values) (store.Page, error) {
+	page := store.Page{Cursor: strings.TrimSpace(values.Get("cursor"))}
+	if raw := strings.TrimSpace(values.Get("limit")); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return page, errField("limit must be a positive integer")
+		}
+		page.Limit = limit
+	}
+	return page, nil
+}
+
+func listOptionsFromQuery(values url.Values) (store.ListOptions, error) {
+	page, err := pageFromQuery(values)
+	if err != nil {
+		return store.ListOptions{}, err
+	}
+	opts := store.ListOptions{
+		Page:          page,
+		LatestOnly:    !strings.EqualFold(values.Get("latest"), "false"),
+		FeaturedOnly:  strings.EqualFold(values.Get("featured"), "true"),
+		IncludeYanked: strings.EqualFold(values.Get("include_yanked"), "true"),
+		SortBy:        values.Get("sort"),
+		Query:         strings.TrimSpace(values.Get("q")),
+		Publisher:     strings.TrimSpace(values.Get("publisher")),
+	}
+	if raw := strings.TrimSpace(values.Get("verified")); raw != "" {
+		verified, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, errField("verified must be true or false")
+		}
+		opts.Verified = &verified
+	}
+	if kind := strings.ToLower(strings.TrimSpace(values.Get("deployment"))); kind != "" {
+		if !store.IsDeploymentKind(kind) {
+			return opts, errField("deployment must be one of: compose, helm, k8s_generated")
+		}
+		opts.Deployment = kind
+	}
+	for _, raw := range values["tag"] {
+		for _, tag := range strings.Split(raw, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				opts.Tags = append(opts.Tags, tag)
+			}
+		}
+	}
+	return opts, nil
 }
 
 func (h IntegrationsHandler) Get(w http.ResponseWriter, r *http.Request) {
@@ -48,6 +142,7 @@ func (h IntegrationsHandler) Get(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "integration not found")
 		return
 	}
+	item.SBOM = h.sbomSummary(r.Context(), item.ID, item.Version)
 	writeJSON(w, http.StatusOK, item)
 }
 
@@ -57,12 +152,21 @@ func (h IntegrationsHandler) Versions(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "missing id")
 		return
 	}
-	items, err := store.ListVersions(r.Context(), h.DB, id)
+	page, err := pageFromQuery(r.URL.Query())
 	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	items, nextCursor, err := store.ListVersions(r.Context(), h.DB, id, page)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to list versions")
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"versions": items})
+	writeJSON(w, http.StatusOK, map[string]any{"versions": items, "next_cursor": nullableString(nextCursor)})
 }
 
 func (h IntegrationsHandler) IncrementDownloads(w http.ResponseWriter, r *http.Request) {
@@ -71,42 +175,122 @@ func (h IntegrationsHandler) IncrementDownloads(w http.ResponseWriter, r *http.R
 		writeError(w, http.StatusBadRequest, "missing id")
 		return
 	}
-	item, err := store.IncrementDownloads(r.Context(), h.DB, id)
+	// The body is optional; clients that predate it post nothing.
+	var req models.DownloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	req.Version = strings.TrimSpace(req.Version)
+	req.Method = strings.ToLower(strings.TrimSpace(req.Method))
+	if req.Method != "" && !store.IsInstallMethod(req.Method) {
+		writeError(w, http.StatusBadRequest, "method must be compose, helm or k8s")
+		return
+	}
+	clientHash, ipHash := h.downloadClientHashes(r)
+	item, err := store.IncrementDownloads(r.Context(), h.DB, id, store.DownloadOptions{
+		Version:      req.Version,
+		Method:       req.Method,
+		ClientHash:   clientHash,
+		IPHash:       ipHash,
+		DedupWindow:  h.DownloadDedupWindow,
+		ClientsPerIP: h.DownloadInstallsPerIP,
+	})
 	if err != nil {
-		writeError(w, http.StatusNotFound, "integration not found")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "integration not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to record download")
 		return
 	}
 	writeJSON(w, http.StatusOK, item)
 }
 
+// Publish stores a release submitted with a publisher API key. Such releases
+// are not backed by an OIDC identity, so they are stored unverified, cannot
+// overwrite an existing version and cannot take over another publisher's id.
 func (h IntegrationsHandler) Publish(w http.ResponseWriter, r *http.Request) {
+	attempt := &publishAttempt{endpoint: "publish"}
+	rec := &publishRecorder{ResponseWriter: w}
+	w = rec
+	defer h.recordPublish(r, rec, attempt)
+
+	key, err := bearerToken(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	publisher, err := store.AuthenticateAPIKey(r.Context(), h.DB, key)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidAPIKey) {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to authenticate api key")
+		return
+	}
+	attempt.publisher = publisher
+
 	var req models.PublishRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid json")
 		return
 	}
-	if err := validatePublishRequest(req); err != nil {
+	req.Publisher = publisher
+	attempt.request = &req
+	// Ownership is checked before anything the request points at is fetched.
+	if err := store.CheckOwnership(r.Context(), h.DB, req.ID, store.PublishOptions{RequirePublisher: publisher}); err != nil {
+		writePublishError(w, err)
+		return
+	}
+	if err := validatePublishRequest(req, h.composePolicy(), h.publishHTTP()); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := resolveManifest(r.Context(), h.publishHTTP(), &req, h.OIDCTagPrefix); err != nil {
+		log.Printf("publish manifest rejected id=%q: %v", req.ID, err)
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	item, err := store.PublishIntegration(r.Context(), h.DB, req, true)
+	if err := h.validateCharts(r.Context(), req); err != nil {
+		log.Printf("publish chart rejected id=%q: %v", req.ID, err)
+		writeChartError(w, err)
+		return
+	}
+	digest, err := h.resolveImage(r.Context(), req)
 	if err != nil {
-		if err == store.ErrListenPathInUse {
-			writeError(w, http.StatusConflict, "listen_path already used")
-			return
-		}
-		if err == store.ErrNameInUse {
-			writeError(w, http.StatusConflict, "name already used")
-			return
-		}
-		writeError(w, http.StatusInternalServerError, "failed to publish integration")
+		log.Printf("publish image rejected id=%q: %v", req.ID, err)
+		writeImageError(w, err)
+		return
+	}
+	document, err := h.resolveSBOM(r.Context(), req, digest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := h.publishOptions(false)
+	opts.ImageDigest = digest
+	opts.SBOM = document
+	opts.RejectExisting = true
+	opts.RequirePublisher = publisher
+	item, err := store.PublishIntegration(r.Context(), h.DB, req, opts)
+	if err != nil {
+		writePublishError(w, err)
 		return
 	}
-	log.Printf("publish stored integration id=%q version=%q latest=%t verified=%t", item.ID, item.Version, item.Latest, item.Verified)
+	log.Printf("publish stored integration id=%q version=%q publisher=%q latest=%t verified=%t", item.ID, item.Version, publisher, item.Latest, item.Verified)
 	writeJSON(w, http.StatusOK, item)
 }
 
+// PublishOIDC stores a release from a CI OIDC token. Each token is accepted
+// once, and every attempt with a verified token is recorded in publish_events.
 func (h IntegrationsHandler) PublishOIDC(w http.ResponseWriter, r *http.Request) {
+	attempt := &publishAttempt{endpoint: "publish-oidc"}
+	rec := &publishRecorder{ResponseWriter: w}
+	w = rec
+	defer h.recordPublish(r, rec, attempt)
+
 	if h.OIDCVerifier == nil {
 		writeError(w, http.StatusServiceUnavailable, "oidc verifier not configured")
 		return
@@ -125,10 +309,17 @@ func (h IntegrationsHandler) PublishOIDC(w http.ResponseWriter, r *http.Request)
 		writeError(w, http.StatusUnauthorized, "invalid oidc token")
 		return
 	}
+	attempt.claims = &claims
+	attempt.tokenID = oidcTokenID(claims, token)
+	if err := h.consumeOIDCToken(r.Context(), claims, attempt.tokenID); err != nil {
+		log.Printf("publish-oidc token rejected token_id=%q: %v", attempt.tokenID, err)
+		writeReplayError(w, err)
+		return
+	}
 
 	if err := h.OIDCVerifier.VerifyWorkflow(r.Context(), claims); err != nil {
 		log.Printf("publish-oidc verify workflow failed: %v", err)
-		writeError(w, http.StatusForbidden, err.Error())
+		writeGateError(w, err)
 		return
 	}
 
@@ -144,6 +335,7 @@ func (h IntegrationsHandler) PublishOIDC(w http.ResponseWriter, r *http.Request)
 		writeError(w, http.StatusBadRequest, "invalid json")
 		return
 	}
+	attempt.request = &req
 	log.Printf(
 		"publish-oidc request fields id=%q version=%q release_tag=%q listen_path=%q repo_url=%q manifest_url=%q image=%q",
 		req.ID,
@@ -154,9 +346,14 @@ func (h IntegrationsHandler) PublishOIDC(w http.ResponseWriter, r *http.Request)
 		req.ManifestURL,
 		req.Image,
 	)
-	if err := validatePublishRequest(req); err != nil {
+	if err := store.CheckOwnership(r.Context(), h.DB, req.ID, store.PublishOptions{OwnerRepository: claims.RepoURL()}); err != nil {
+		log.Printf("publish-oidc ownership rejected id=%q: %v", req.ID, err)
+		writePublishError(w, err)
+		return
+	}
+	if err := validatePublishRequest(req, h.composePolicy(), h.publishHTTP()); err != nil {
 		log.Printf("publish-oidc request validation failed: %v", err)
-		writeError(w, http.StatusBadRequest, err.Error())
+		writeValidationError(w, err)
 		return
 	}
 	if err := validateOIDCRequest(req, claims, tag); err != nil {
@@ -164,25 +361,287 @@ func (h IntegrationsHandler) PublishOIDC(w http.ResponseWriter, r *http.Request)
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if err := resolveManifest(r.Context(), h.publishHTTP(), &req, h.OIDCTagPrefix); err != nil {
+		log.Printf("publish-oidc manifest rejected: %v", err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.validateCharts(r.Context(), req); err != nil {
+		log.Printf("publish-oidc chart rejected: %v", err)
+		writeChartError(w, err)
+		return
+	}
 
-	item, err := store.PublishIntegration(r.Context(), h.DB, req, true)
+	digest, err := h.resolveImage(r.Context(), req)
 	if err != nil {
-		if err == store.ErrListenPathInUse {
-			writeError(w, http.StatusConflict, "listen_path already used")
-			return
-		}
-		if err == store.ErrNameInUse {
-			writeError(w, http.StatusConflict, "name already used")
-			return
-		}
-		writeError(w, http.StatusInternalServerError, "failed to publish integration")
+		log.Printf("publish-oidc image rejected: %v", err)
+		writeImageError(w, err)
+		return
+	}
+	attestations, err := h.verifyAttestations(r.Context(), req, digest, claims)
+	if err != nil {
+		log.Printf("publish-oidc attestation rejected: %v", err)
+		writeAttestationError(w, err)
+		return
+	}
+	document, err := h.resolveSBOM(r.Context(), req, digest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := h.publishOptions(true)
+	opts.ImageDigest = digest
+	opts.SBOM = document
+	opts.Attestations = attestations
+	opts.OwnerRepository = claims.RepoURL()
+	item, err := store.PublishIntegration(r.Context(), h.DB, req, opts)
+	if err != nil {
+		writePublishError(w, err)
 		return
 	}
 	log.Printf("publish-oidc stored integration id=%q version=%q latest=%t verified=%t", item.ID, item.Version, item.Latest, item.Verified)
 	writeJSON(w, http.StatusOK, item)
 }
 
-func validatePublishRequest(req models.PublishRequest) error {
+func writePublishError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrInvalidVersion):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, store.ErrListenPathInUse):
+		writeError(w, http.StatusConflict, "listen_path already used")
+	case errors.Is(err, store.ErrNameInUse):
+		writeError(w, http.StatusConflict, "name already used")
+	case errors.Is(err, store.ErrVersionExists):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, store.ErrPublisherMismatch), errors.Is(err, store.ErrNotOwner):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, store.ErrInvalidRepository):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to publish integration")
+	}
+}
+
+func (h IntegrationsHandler) publishOptions(verified bool) store.PublishOptions {
+	return store.PublishOptions{
+		Verified:         verified,
+		TagPrefix:        h.OIDCTagPrefix,
+		PrereleaseLatest: h.PrereleaseLatest,
+	}
+}
+
+func (h IntegrationsHandler) composePolicy() compose.Policy {
+	if h.ComposePolicy == nil {
+		return compose.DefaultPolicy()
+	}
+	return *h.ComposePolicy
+}
+
+func (h IntegrationsHandler) publishHTTP() *http.Client {
+	if h.PublishHTTP == nil {
+		return publishHTTPClient
+	}
+	return h.PublishHTTP
+}
+
+func (h IntegrationsHandler) chartChecker() *helm.Checker {
+	if h.ChartChecker == nil {
+		return helm.NewChecker()
+	}
+	return h.ChartChecker
+}
+
+// validateCharts checks that every chart ref resolves to an existing chart
+// version that deploys the published image. An empty chart version means the
+// release version.
+func (h IntegrationsHandler) validateCharts(ctx context.Context, req models.PublishRequest) error {
+	charts := []struct{ field, ref, version string }{
+		{"helm", req.Deployment.Helm.ChartRef, req.Deployment.Helm.Version},
+		{"k8s_generated", req.Deployment.K8sGenerated.ChartRef, req.Deployment.K8sGenerated.Version},
+	}
+	checker := h.chartChecker()
+	for _, chart := range charts {
+		ref := strings.TrimSpace(chart.ref)
+		if ref == "" {
+			continue
+		}
+		version := firstNonEmpty(chart.version, req.Version)
+		if err := checker.Validate(ctx, ref, strings.TrimSpace(version), strings.TrimSpace(req.Image)); err != nil {
+			return fmt.Errorf("%s.chart_ref: %w", chart.field, err)
+		}
+	}
+	return nil
+}
+
+// writeChartError reports chart consistency problems individually; any other
+// failure to resolve the chart is a bad request as well.
+func writeChartError(w http.ResponseWriter, err error) {
+	var chartErr *helm.ValidationError
+	if errors.As(err, &chartErr) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error(), "problems": chartErr.Problems})
+		return
+	}
+	if errors.Is(err, netguard.ErrNotPublic) || errors.Is(err, netguard.ErrInsecureURL) {
+		writeError(w, http.StatusBadRequest, "chart repository must be served over https from a public address")
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
+
+// resolveImage checks that image exists in its registry and, when tagged,
+// that the tag is the release version. It returns the manifest digest, or ""
+// when VerifyImages is off.
+func (h IntegrationsHandler) resolveImage(ctx context.Context, req models.PublishRequest) (string, error) {
+	if !h.VerifyImages {
+		return "", nil
+	}
+	image, err := oci.ParseImage(req.Image)
+	if err != nil {
+		return "", errField("image must be a valid image reference")
+	}
+	if image.Tag != "" {
+		tagVersion, err := semver.Parse(image.Tag, h.OIDCTagPrefix)
+		version, versionErr := semver.Parse(req.Version, h.OIDCTagPrefix)
+		if err != nil || versionErr != nil || tagVersion.Compare(version) != 0 {
+			return "", errField("image tag must match version")
+		}
+	}
+	_, digest, err := h.registry().Manifest(ctx, image.Registry, image.Repository, image.Reference())
+	if errors.Is(err, oci.ErrNotFound) {
+		return "", errField("image " + image.String() + " not found in registry")
+	}
+	if errors.Is(err, netguard.ErrNotPublic) || errors.Is(err, netguard.ErrInsecureURL) {
+		return "", errField("image registry must be served over https from a public address")
+	}
+	if err != nil {
+		return "", err
+	}
+	if image.Digest != "" && digest != image.Digest {
+		return "", errField("image digest does not match the registry")
+	}
+	return digest, nil
+}
+
+func (h IntegrationsHandler) registry() *oci.Client {
+	if h.Registry == nil {
+		return oci.NewClient()
+	}
+	return h.Registry
+}
+
+// verifyAttestations checks the image's cosign signature and SLSA provenance
+// against the repository and workflow of the OIDC token. Missing evidence is
+// only an error in required mode; evidence that fails to verify always is.
+func (h IntegrationsHandler) verifyAttestations(ctx context.Context, req models.PublishRequest, digest string, claims OIDCClaims) (models.Attestations, error) {
+	var out models.Attestations
+	if !h.SignatureMode.Enabled() && !h.ProvenanceMode.Enabled() {
+		return out, nil
+	}
+	if h.Cosign == nil {
+		return out, errors.New("cosign verifier not configured")
+	}
+	image, err := oci.ParseImage(req.Image)
+	if err != nil {
+		return out, errField("image must be a valid image reference")
+	}
+	if digest == "" {
+		if _, digest, err = h.registry().Manifest(ctx, image.Registry, image.Repository, image.Reference()); err != nil {
+			return out, err
+		}
+	}
+	identity := cosign.Identity{
+		Issuer:        claims.Issuer,
+		RepositoryURL: claims.RepoURL(),
+		SHA:           claims.SHA,
+		WorkflowURL:   claims.SignerWorkflowURL(),
+	}
+
+	if h.SignatureMode.Enabled() {
+		signer, err := h.Cosign.VerifySignature(ctx, image, digest, identity)
+		switch {
+		case err == nil:
+			out.Signature = &models.SignatureAttestation{
+				Issuer:           signer.Issuer,
+				Identity:         signer.Subject,
+				SourceRepository: signer.SourceRepository,
+				SourceRef:        signer.SourceRef,
+				SourceDigest:     signer.SourceDigest,
+				LogIndex:         signer.LogIndex,
+				SignedAt:         signer.IntegratedTime,
+			}
+		case errors.Is(err, cosign.ErrNotFound) && h.SignatureMode != cosign.ModeRequired:
+		default:
+			return out, err
+		}
+	}
+	if h.ProvenanceMode.Enabled() {
+		provenance, err := h.Cosign.VerifyProvenance(ctx, image, digest, identity)
+		switch {
+		case err == nil:
+			out.Provenance = &models.ProvenanceAttestation{
+				PredicateType:    provenance.PredicateType,
+				BuilderID:        provenance.BuilderID,
+				SourceRepository: provenance.SourceRepository,
+				Identity:         provenance.Signer.Subject,
+				LogIndex:         provenance.Signer.LogIndex,
+				SignedAt:         provenance.Signer.IntegratedTime,
+			}
+		case errors.Is(err, cosign.ErrNotFound) && h.ProvenanceMode != cosign.ModeRequired:
+		default:
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// writeAttestationError reports missing or invalid evidence as a rejected
+// publish and anything else as a registry failure.
+func writeAttestationError(w http.ResponseWriter, err error) {
+	var fieldErr errField
+	switch {
+	case errors.Is(err, cosign.ErrNotFound):
+		writeError(w, http.StatusBadRequest, "image "+err.Error()+" (required by marketplace policy)")
+	case errors.Is(err, cosign.ErrVerification):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.As(err, &fieldErr):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusBadGateway, "failed to verify image attestations")
+	}
+}
+
+// writeImageError separates rejected images from registries that could not
+// be reached.
+func writeImageError(w http.ResponseWriter, err error) {
+	var fieldErr errField
+	if errors.As(err, &fieldErr) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadGateway, "failed to resolve image")
+}
+
+// writeGateError reports the result of every release gate when any failed.
+func writeGateError(w http.ResponseWriter, err error) {
+	var gateErr *gates.Error
+	if errors.As(err, &gateErr) {
+		writeJSON(w, http.StatusForbidden, map[string]any{"error": err.Error(), "gates": gateErr.Results})
+		return
+	}
+	writeError(w, http.StatusForbidden, err.Error())
+}
+
+// writeValidationError reports compose policy errors with every violation.
+func writeValidationError(w http.ResponseWriter, err error) {
+	var policyErr *compose.PolicyError
+	if errors.As(err, &policyErr) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error(), "violations": policyErr.Violations})
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
+
+func validatePublishRequest(req models.PublishRequest, policy compose.Policy, client *http.Client) error {
 	req.ID = strings.TrimSpace(req.ID)
 	req.Name = strings.TrimSpace(req.Name)
 	req.Version = strings.TrimSpace(req.Version)
@@ -229,27 +688,58 @@ func validatePublishRequest(req models.PublishRequest) error {
 		if !isIntegrationComposeFile(composeFile) {
 			return errField("compose_file must point to docker-compose.integration.yml")
 		}
-		if err := validateComposeFileURL(composeFile); err != nil {
+		if err := validateComposeFileURL(client, composeFile, policy); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func validateComposeFileURL(composeFile string) error {
+// resolveManifest fetches manifest_url, checks it against the submitted
+// manifest and its schema, and replaces req.Manifest with the fetched copy.
+// An omitted manifest is taken from manifest_url as is.
+func resolveManifest(ctx context.Context, client *http.Client, req *models.PublishRequest, tagPrefix string) error {
+	fetched, err := manifest.Fetch(ctx, client, req.ManifestURL)
+	if err != nil {
+		return errField(err.Error())
+	}
+	if len(req.Manifest) > 0 && !manifest.Equal(req.Manifest, fetched) {
+		return errField(manifest.ErrMismatch.Error())
+	}
+	if err := manifest.Validate(fetched); err != nil {
+		return errField(err.Error())
+	}
+	if id, _ := fetched["id"].(string); id != req.ID {
+		return errField("manifest id must match id")
+	}
+	manifestVersion, err := semver.Parse(fmt.Sprint(fetched["version"]), tagPrefix)
+	if err != nil {
+		return errField("manifest version must be a semantic version")
+	}
+	version, err := semver.Parse(req.Version, tagPrefix)
+	if err != nil || manifestVersion.Compare(version) != 0 {
+		return errField("manifest version must match version")
+	}
+	req.Manifest = fetched
+	return nil
+}
+
+func validateComposeFileURL(client *http.Client, composeFile string, policy compose.Policy) error {
 	composeFile = strings.TrimSpace(composeFile)
 	if composeFile == "" {
 		return errField("compose_file is required")
 	}
-	if !strings.HasPrefix(composeFile, "http://") && !strings.HasPrefix(composeFile, "https://") {
-		return errField("compose_file must be a URL")
+	if netguard.CheckURL(composeFile) != nil {
+		return errField("compose_file must be an https URL")
 	}
 	if !isIntegrationComposeFile(composeFile) {
 		return errField("compose_file must point to docker-compose.integration.yml")
 	}
-	client := &http.Client{Timeout: 6 * time.Second}
 	resp, err := client.Get(composeFile)
 	if err != nil {
+		if errors.Is(err, netguard.ErrNotPublic) {
+			return errField("compose_file must resolve to a public address")
+		}
 		return errField("failed to fetch compose_file")
 	}
 	defer resp.Body.Close()
@@ -265,37 +755,7 @@ func validateComposeFileURL(composeFile string) error {
 	if content == "" {
 		return errField("compose_file returned empty content")
 	}
-	return validateComposeFileContent(content)
-}
-
-func validateComposeFileContent(composeYAML string) error {
-	if !strings.Contains(composeYAML, "INTEGRATIONS_ROOT") {
-		return errField("compose_file must reference INTEGRATIONS_ROOT")
-	}
-	if strings.Contains(composeYAML, "HOMENAVI_ROOT") {
-		return errField("compose_file must not reference HOMENAVI_ROOT")
-	}
-
-	type composeService struct {
-		Image string `yaml:"image"`
-	}
-	type composeFile struct {
-		Services map[string]composeService `yaml:"services"`
-	}
-
-	var cfg composeFile
-	if err := yaml.Unmarshal([]byte(composeYAML), &cfg); err != nil {
-		return errField("compose_file invalid")
-	}
-	if len(cfg.Services) == 0 {
-		return errField("compose_file must define services")
-	}
-	for name, svc := range cfg.Services {
-		if strings.TrimSpace(svc.Image) == "" {
-			return errField("compose_file missing image for service: " + name)
-		}
-	}
-	return nil
+	return compose.Check(content, policy)
 }
 
 func isIntegrationComposeFile(path string) bool {
@@ -377,21 +837,40 @@ func validateOIDCRequest(req models.PublishRequest, claims OIDCClaims, tag strin
 	}
 
 	repoURL := normalizeRepoURL(req.RepoURL)
-	expectedRepoURL := normalizeRepoURL("https://github.com/" + repo)
+	expectedRepoURL := normalizeRepoURL(claims.RepoURL())
 	if repoURL == "" || repoURL != expectedRepoURL {
 		log.Printf("publish-oidc repo_url mismatch: repo_url=%q expected=%q", repoURL, expectedRepoURL)
-		return errField("repo_url must match the GitHub repository")
+		return errField("repo_url must match the oidc repository")
 	}
 
-	rawBase := "https://raw.githubusercontent.com/" + repo + "/" + tag + "/"
-	if !strings.HasPrefix(req.ManifestURL, rawBase) {
+	if claims.repoRules().ManifestURLTemplate == "" {
+		log.Printf("publish-oidc provider has no manifest url template repo=%q", claims.Repository)
+		return errField("oidc provider has no manifest_url template")
+	}
+	rawBase := claims.ManifestURLPrefix(tag)
+	if !strings.HasPrefix(req.ManifestURL, rawBase) || hasDotSegment(req.ManifestURL) {
 		log.Printf("publish-oidc manifest_url mismatch: manifest_url=%q expected_prefix=%q", req.ManifestURL, rawBase)
-		return errField("manifest_url must point to the tag in the GitHub repo")
+		return errField("manifest_url must point to the tag in the oidc repository")
 	}
 
 	return nil
 }
 
+// hasDotSegment reports whether raw has a ".." path segment, which could
+// step out of the tag prefix once the host cleans the path.
+func hasDotSegment(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return true
+	}
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
 func normalizeRepoURL(value string) string {
 	trimmed := strings.TrimSpace(value)
 	trimmed = strings.TrimSuffix(trimmed, ".git")
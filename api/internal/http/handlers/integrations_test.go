@@ -6,13 +6,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/gates"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/http/handlers"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/http/server"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 type stubOIDCVerifier struct {
@@ -73,30 +77,37 @@ func TestPublishOIDCAndList(t *testing.T) {
 	pool, cleanup := testutil.StartPostgres(t)
 	defer cleanup()
 
+	composeServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/compose/docker-compose.integration.yml":
+			_, _ = w.Write([]byte("services:\n  spotify:\n    image: ghcr.io/petoadam/homenavi-spotify:latest\n    volumes:\n      - ${INTEGRATIONS_ROOT}/integrations/secrets/spotify.secrets.json:/app/config/integration.secrets.json\n"))
+		case "/PetoAdam/homenavi-spotify/raw/v0.1.0/manifest/homenavi-integration.json":
+			_, _ = w.Write([]byte(`{"id":"spotify","name":"Spotify","version":"0.1.0"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(composeServer.Close)
+
 	verifier := stubOIDCVerifier{claims: handlers.OIDCClaims{
 		Repository: "PetoAdam/homenavi-spotify",
 		Ref:        "refs/tags/v0.1.0",
 		RefType:    "tag",
 		SHA:        "abc123",
+		Rules: handlers.RepoRules{
+			RepoURLBase:         "https://github.com/",
+			ManifestURLTemplate: composeServer.URL + "/{repo}/raw/{tag}/",
+		},
 	}}
-	h := server.NewWithVerifier(config.Config{OIDCTagPrefix: "v"}, pool, verifier)
-
-	composeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/compose/docker-compose.integration.yml" {
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		_, _ = w.Write([]byte("services:\n  spotify:\n    image: ghcr.io/petoadam/homenavi-spotify:latest\n    volumes:\n      - ${INTEGRATIONS_ROOT}/integrations/secrets/spotify.secrets.json:/app/config/integration.secrets.json\n"))
-	}))
-	t.Cleanup(composeServer.Close)
+	h := server.NewWithVerifier(config.Config{OIDCTagPrefix: "v", PublishHTTP: composeServer.Client()}, pool, verifier)
 
 	reqBody := models.PublishRequest{
 		ID:          "spotify",
 		Name:        "Spotify",
 		Version:     "v0.1.0",
 		Description: "Play music",
-		ManifestURL: "https://raw.githubusercontent.com/PetoAdam/homenavi-spotify/v0.1.0/manifest/homenavi-integration.json",
-		Manifest:    map[string]any{"id": "spotify"},
+		ManifestURL: composeServer.URL + "/PetoAdam/homenavi-spotify/raw/v0.1.0/manifest/homenavi-integration.json",
+		Manifest:    map[string]any{"id": "spotify", "name": "Spotify", "version": "0.1.0"},
 		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
 		Images:      []string{},
 		Assets:      map[string]string{},
@@ -123,3 +134,123 @@ func TestPublishOIDCAndList(t *testing.T) {
 		t.Fatalf("expected list 200, got %d", listRes.Code)
 	}
 }
+
+func TestPublishOIDCRejectsReplayedToken(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	verifier := stubOIDCVerifier{claims: handlers.OIDCClaims{
+		RegisteredClaims: jwt.RegisteredClaims{ID: "token-1", Issuer: "https://token.actions.githubusercontent.com"},
+		Repository:       "PetoAdam/homenavi-spotify",
+		Ref:              "refs/tags/v0.1.0",
+		RunID:            42,
+		RunAttempt:       1,
+	}}
+	h := server.NewWithVerifier(config.Config{OIDCTagPrefix: "v", AdminTokens: []string{"alice:secret"}}, pool, verifier)
+
+	for i, want := range []int{http.StatusBadRequest, http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodPost, "/api/integrations/publish-oidc", bytes.NewReader([]byte(`{`)))
+		req.Header.Set("Authorization", "Bearer test-token")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		if res.Code != want {
+			t.Fatalf("attempt %d: expected %d, got %d: %s", i+1, want, res.Code, res.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/publish-events?repository=PetoAdam/homenavi-spotify", nil)
+	req.Header.Set("X-Marketplace-Token", "secret")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", res.Code, res.Body.String())
+	}
+	var body struct {
+		Events []models.PublishEvent `json:"events"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode events: %v", err)
+	}
+	if len(body.Events) != 2 {
+		t.Fatalf("expected 2 events, got %+v", body.Events)
+	}
+	if body.Events[0].Error != "oidc token already used" || body.Events[1].Error != "invalid json" {
+		t.Fatalf("unexpected events %+v", body.Events)
+	}
+	if body.Events[1].Outcome != "rejected" || body.Events[1].TokenID != "jti:token-1" || body.Events[1].RunID != 42 {
+		t.Fatalf("unexpected event %+v", body.Events[1])
+	}
+}
+
+func TestPublishOIDCReportsReleaseGates(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	verifier := stubOIDCVerifier{
+		claims: handlers.OIDCClaims{
+			RegisteredClaims: jwt.RegisteredClaims{ID: "token-1", Issuer: "https://token.actions.githubusercontent.com"},
+			Repository:       "PetoAdam/homenavi-spotify",
+			Ref:              "refs/tags/v0.1.0",
+		},
+		workflowErr: &gates.Error{Results: []gates.Result{
+			{Gate: "workflow:verify.yml", Passed: true},
+			{Gate: "branch-protection", Passed: false, Error: "branch main is not protected"},
+		}},
+	}
+	h := server.NewWithVerifier(config.Config{OIDCTagPrefix: "v"}, pool, verifier)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/integrations/publish-oidc", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("Authorization", "Bearer test-token")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", res.Code, res.Body.String())
+	}
+	var body struct {
+		Gates []gates.Result `json:"gates"`
+	}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Gates) != 2 || !body.Gates[0].Passed || body.Gates[1].Passed || body.Gates[1].Error == "" {
+		t.Fatalf("unexpected gates %+v", body.Gates)
+	}
+}
+
+func TestPublishChecksOwnershipBeforeFetching(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := store.PublishIntegration(ctx, pool, testRelease(), store.PublishOptions{TagPrefix: "v", RequirePublisher: "acme"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	key, err := store.CreateAPIKey(ctx, pool, "mallory", "alice")
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	var fetches atomic.Int64
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(target.Close)
+	h := server.NewWithVerifier(config.Config{OIDCTagPrefix: "v", PublishHTTP: target.Client()}, pool, stubOIDCVerifier{})
+
+	reqBody := testRelease()
+	reqBody.Version = "v0.2.0"
+	reqBody.ManifestURL = target.URL + "/manifest.json"
+	reqBody.ComposeFile = target.URL + "/compose/docker-compose.integration.yml"
+	payload, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest(http.MethodPost, "/api/integrations/publish", bytes.NewReader(payload))
+	req.Header.Set("Authorization", "Bearer "+key.Key)
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d: %s", res.Code, res.Body.String())
+	}
+	if n := fetches.Load(); n != 0 {
+		t.Fatalf("expected no fetches for an id owned by another publisher, got %d", n)
+	}
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultJWKSTTL         = 30 * time.Minute
+	defaultJWKSMaxTTL      = 24 * time.Hour
+	defaultJWKSMinInterval = time.Minute
+	maxJWKSSize            = 1 << 20
+)
+
+// jwksCache holds the signing keys of one issuer. Keys live for the lifetime
+// the JWKS response advertises (Cache-Control max-age or Expires), clamped to
+// [minInterval, maxTTL], and ttl when it advertises none. A token signed with
+// an unknown kid triggers a refetch at most once per minInterval, so a key
+// rotation is picked up without waiting for the cache to expire. If a refetch
+// fails the previous keys stay in use.
+type jwksCache struct {
+	url         string
+	client      *http.Client
+	ttl         time.Duration
+	maxTTL      time.Duration
+	minInterval time.Duration
+
+	group singleflight.Group
+
+	mu          sync.RWMutex
+	keys        map[string]jwk
+	etag        string
+	fetchedAt   time.Time
+	expires     time.Time
+	lastAttempt time.Time
+	lastErr     error
+	fetches     int
+	failures    int
+}
+
+type jwk struct {
+	key any
+	kty string
+	alg string
+}
+
+// JWKSStatus is a snapshot of a jwksCache for the OIDC health endpoint.
+type JWKSStatus struct {
+	URL           string     `json:"url"`
+	Keys          []JWKSKey  `json:"keys"`
+	FetchedAt     *time.Time `json:"fetched_at"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	Fetches       int        `json:"fetches"`
+	Failures      int        `json:"failures"`
+}
+
+type JWKSKey struct {
+	KID string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg,omitempty"`
+}
+
+func newJWKSCache(url string, client *http.Client, cfg config.Config) *jwksCache {
+	c := &jwksCache{
+		url:         url,
+		client:      client,
+		ttl:         cfg.JWKSCacheTTL,
+		maxTTL:      cfg.JWKSMaxTTL,
+		minInterval: cfg.JWKSMinRefreshInterval,
+	}
+	if c.ttl <= 0 {
+		c.ttl = defaultJWKSTTL
+	}
+	if c.maxTTL <= 0 {
+		c.maxTTL = defaultJWKSMaxTTL
+	}
+	if c.minInterval <= 0 {
+		c.minInterval = defaultJWKSMinInterval
+	}
+	return c
+}
+
+func (c *jwksCache) key(ctx context.Context, kid string) (jwk, error) {
+	now := time.Now()
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	loaded := c.keys != nil
+	fresh := now.Before(c.expires)
+	throttled := now.Sub(c.lastAttempt) < c.minInterval
+	c.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+	if !loaded || !throttled {
+		if err := c.refresh(ctx); err != nil {
+			if !loaded {
+				return jwk{}, err
+			}
+			log.Printf("jwks refresh failed url=%q: %v", c.url, err)
+		}
+		c.mu.RLock()
+		key, ok = c.keys[kid]
+		c.mu.RUnlock()
+	}
+	if !ok {
+		return jwk{}, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+// refresh fetches the key set once for all concurrent callers. The fetch is
+// detached from the caller's context so one cancelled request does not fail
+// the others waiting on it.
+func (c *jwksCache) refresh(ctx context.Context) error {
+	_, err, _ := c.group.Do("jwks", func() (any, error) {
+		return nil, c.fetch(context.WithoutCancel(ctx))
+	})
+	return err
+}
+
+func (c *jwksCache) fetch(ctx context.Context) error {
+	c.mu.RLock()
+	etag := c.etag
+	if c.keys == nil {
+		etag = ""
+	}
+	c.mu.RUnlock()
+
+	keys, header, err := c.download(ctx, etag)
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastAttempt = now
+	c.fetches++
+	if err != nil {
+		c.lastErr = err
+		c.failures++
+		return err
+	}
+	c.lastErr = nil
+	if keys != nil {
+		c.keys = keys
+		c.etag = header.Get("ETag")
+	}
+	c.fetchedAt = now
+	c.expires = now.Add(c.lifetime(header, now))
+	return nil
+}
+
+// download fetches the key set. It returns nil keys when the server answers
+// 304 Not Modified to etag.
+func (c *jwksCache) download(ctx context.Context, etag string) (map[string]jwk, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		if etag != "" {
+			return nil, resp.Header, nil
+		}
+		fallthrough
+	default:
+		return nil, nil, fmt.Errorf("jwks fetch failed: %s", resp.Status)
+	}
+
+	var payload struct {
+		Keys []struct {
+			KID string `json:"kid"`
+			Kty string `json:"kty"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&payload); err != nil {
+		return nil, nil, err
+	}
+
+	out := make(map[string]jwk)
+	for _, key := range payload.Keys {
+		if key.KID == "" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		var (
+			pub any
+			err error
+		)
+		switch key.Kty {
+		case "RSA":
+			pub, err = rsaKey(key.N, key.E)
+		case "EC":
+			pub, err = ecKey(key.Crv, key.X, key.Y)
+		default:
+			continue
+		}
+		if err != nil {
+			log.Printf("jwks key skipped url=%q kid=%q: %v", c.url, key.KID, err)
+			continue
+		}
+		out[key.KID] = jwk{key: pub, kty: key.Kty, alg: key.Alg}
+	}
+
+	if len(out) == 0 {
+		return nil, nil, errors.New("no jwks keys found")
+	}
+	return out, resp.Header, nil
+}
+
+// lifetime returns how long a response may be cached according to its
+// Cache-Control or Expires header.
+func (c *jwksCache) lifetime(header http.Header, now time.Time) time.Duration {
+	ttl := c.ttl
+	if maxAge, ok := cacheMaxAge(header.Get("Cache-Control")); ok {
+		ttl = maxAge
+		if age, err := strconv.Atoi(strings.TrimSpace(header.Get("Age"))); err == nil && age > 0 {
+			ttl -= time.Duration(age) * time.Second
+		}
+	} else if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		ttl = expires.Sub(now)
+	}
+	return min(max(ttl, c.minInterval), c.maxTTL)
+}
+
+func cacheMaxAge(value string) (time.Duration, bool) {
+	for _, directive := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "no-cache":
+			return 0, true
+		case "max-age":
+			seconds, err := strconv.Atoi(strings.Trim(arg, `"`))
+			if err != nil || seconds < 0 {
+				continue
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return 0, false
+}
+
+func (c *jwksCache) status() JWKSStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := JWKSStatus{URL: c.url, Keys: []JWKSKey{}, Fetches: c.fetches, Failures: c.failures}
+	for kid, key := range c.keys {
+		out.Keys = append(out.Keys, JWKSKey{KID: kid, Kty: key.kty, Alg: key.alg})
+	}
+	sort.Slice(out.Keys, func(i, j int) bool { return out.Keys[i].KID < out.Keys[j].KID })
+	out.FetchedAt = timeOrNil(c.fetchedAt)
+	out.ExpiresAt = timeOrNil(c.expires)
+	out.LastAttemptAt = timeOrNil(c.lastAttempt)
+	if c.lastErr != nil {
+		out.LastError = c.lastErr.Error()
+	}
+	return out
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func rsaKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil || len(nBytes) == 0 {
+		return nil, errors.New("invalid modulus")
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil || len(eBytes) == 0 || len(eBytes) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+	eInt := big.NewInt(0).SetBytes(eBytes).Int64()
+	if eInt <= 1 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{N: big.NewInt(0).SetBytes(nBytes), E: int(eInt)}, nil
+}
+
+func ecKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+	size := (curve.Params().BitSize + 7) / 8
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil || len(xBytes) != size {
+		return nil, errors.New("invalid x coordinate")
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil || len(yBytes) != size {
+		return nil, errors.New("invalid y coordinate")
+	}
+	point := append([]byte{4}, xBytes...)
+	return ecdsa.ParseUncompressedPublicKey(curve, append(point, yBytes...))
+}
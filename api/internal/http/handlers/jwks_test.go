@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type testJWKS struct {
+	mu      sync.Mutex
+	keys    []map[string]string
+	header  http.Header
+	etag    string
+	delay   time.Duration
+	fetches atomic.Int32
+}
+
+func (s *testJWKS) set(keys ...map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *testJWKS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.fetches.Add(1)
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, values := range s.header {
+		w.Header()[name] = values
+	}
+	if s.etag != "" {
+		if r.Header.Get("If-None-Match") == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", s.etag)
+	}
+	_ = json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+}
+
+func rsaJWK(t *testing.T, kid string) (*rsa.PrivateKey, map[string]string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key, map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func newTestJWKSCache(t *testing.T, srv *testJWKS, cfg config.Config) *jwksCache {
+	t.Helper()
+	httpSrv := httptest.NewServer(srv)
+	t.Cleanup(httpSrv.Close)
+	return newJWKSCache(httpSrv.URL, httpSrv.Client(), cfg)
+}
+
+func TestJWKSCacheRefetchesUnknownKid(t *testing.T) {
+	_, first := rsaJWK(t, "first")
+	_, second := rsaJWK(t, "second")
+	srv := &testJWKS{}
+	srv.set(first)
+	cache := newTestJWKSCache(t, srv, config.Config{JWKSMinRefreshInterval: time.Hour})
+
+	if _, err := cache.key(context.Background(), "first"); err != nil {
+		t.Fatalf("first key: %v", err)
+	}
+	srv.set(first, second)
+	// The last fetch was just now, so the rotation is not picked up yet.
+	if _, err := cache.key(context.Background(), "second"); err == nil {
+		t.Fatalf("expected unknown kid within the refresh interval")
+	}
+	if got := srv.fetches.Load(); got != 1 {
+		t.Fatalf("expected 1 fetch, got %d", got)
+	}
+
+	cache.minInterval = 0
+	if _, err := cache.key(context.Background(), "second"); err != nil {
+		t.Fatalf("expected rotated key after refetch, got %v", err)
+	}
+	if got := srv.fetches.Load(); got != 2 {
+		t.Fatalf("expected 2 fetches, got %d", got)
+	}
+}
+
+func TestJWKSCacheHonoursCacheHeaders(t *testing.T) {
+	_, key := rsaJWK(t, "test")
+	srv := &testJWKS{header: http.Header{"Cache-Control": {"public, max-age=7200"}}, etag: `"v1"`}
+	srv.set(key)
+	cache := newTestJWKSCache(t, srv, config.Config{JWKSMinRefreshInterval: time.Second})
+
+	if _, err := cache.key(context.Background(), "test"); err != nil {
+		t.Fatalf("key: %v", err)
+	}
+	status := cache.status()
+	if status.ExpiresAt == nil || status.ExpiresAt.Sub(*status.FetchedAt) != 2*time.Hour {
+		t.Fatalf("expected 2h lifetime, got %+v", status)
+	}
+
+	cache.mu.Lock()
+	cache.expires = time.Now().Add(-time.Second)
+	cache.lastAttempt = time.Time{}
+	cache.mu.Unlock()
+	if _, err := cache.key(context.Background(), "test"); err != nil {
+		t.Fatalf("key after revalidation: %v", err)
+	}
+	status = cache.status()
+	if srv.fetches.Load() != 2 || len(status.Keys) != 1 || !status.ExpiresAt.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("expected 304 to extend the cached keys, got %+v", status)
+	}
+
+	if got := cache.lifetime(http.Header{"Cache-Control": {"no-store"}}, time.Now()); got != time.Second {
+		t.Fatalf("expected no-store to clamp to the refresh interval, got %s", got)
+	}
+	if got := cache.lifetime(http.Header{"Cache-Control": {"max-age=999999"}}, time.Now()); got != defaultJWKSMaxTTL {
+		t.Fatalf("expected max ttl clamp, got %s", got)
+	}
+	if got := cache.lifetime(http.Header{}, time.Now()); got != defaultJWKSTTL {
+		t.Fatalf("expected default ttl, got %s", got)
+	}
+}
+
+func TestJWKSCacheSingleFetch(t *testing.T) {
+	_, key := rsaJWK(t, "test")
+	srv := &testJWKS{delay: 50 * time.Millisecond}
+	srv.set(key)
+	cache := newTestJWKSCache(t, srv, config.Config{})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.key(context.Background(), "test"); err != nil {
+				t.Errorf("key: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := srv.fetches.Load(); got != 1 {
+		t.Fatalf("expected concurrent lookups to share one fetch, got %d", got)
+	}
+}
+
+func TestVerifyOIDCTokenECKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	srv := &testJWKS{}
+	srv.set(map[string]string{
+		"kid": "ec",
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	})
+	cache := newTestJWKSCache(t, srv, config.Config{})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": "https://issuer.example.com",
+		"aud": "homenavi-marketplace",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = "ec"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	claims := jwt.MapClaims{}
+	if err := verifyOIDCToken(context.Background(), signed, "https://issuer.example.com", "homenavi-marketplace", cache, claims); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if keys := cache.status().Keys; len(keys) != 1 || keys[0].Kty != "EC" {
+		t.Fatalf("unexpected cached keys %+v", keys)
+	}
+}
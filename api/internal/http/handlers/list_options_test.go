@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+)
+
+func TestListOptionsFromQuery(t *testing.T) {
+	values := url.Values{}
+	values.Set("q", " spotify ")
+	values.Set("verified", "true")
+	values.Set("deployment", "Helm")
+	values.Add("tag", "media,music")
+	values.Add("tag", "audio")
+
+	opts, err := listOptionsFromQuery(values)
+	if err != nil {
+		t.Fatalf("expected valid query, got %v", err)
+	}
+	if !opts.LatestOnly {
+		t.Fatalf("expected latest only by default")
+	}
+	if opts.Query != "spotify" {
+		t.Fatalf("expected trimmed query, got %q", opts.Query)
+	}
+	if opts.Verified == nil || !*opts.Verified {
+		t.Fatalf("expected verified filter true")
+	}
+	if opts.Deployment != store.DeploymentHelm {
+		t.Fatalf("expected helm deployment, got %q", opts.Deployment)
+	}
+	if len(opts.Tags) != 3 {
+		t.Fatalf("expected 3 tags, got %v", opts.Tags)
+	}
+}
+
+func TestListOptionsFromQueryRejectsInvalidFilters(t *testing.T) {
+	if _, err := listOptionsFromQuery(url.Values{"deployment": {"nomad"}}); err == nil {
+		t.Fatalf("expected error for unknown deployment kind")
+	}
+	if _, err := listOptionsFromQuery(url.Values{"verified": {"maybe"}}); err == nil {
+		t.Fatalf("expected error for invalid verified value")
+	}
+}
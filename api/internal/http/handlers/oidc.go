@@ -2,34 +2,84 @@ package handlers
 
 import (
 	"context"
-	"crypto/rsa"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"math/big"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/gates"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type OIDCClaims struct {
 	jwt.RegisteredClaims
-	Repository      string `json:"repository"`
-	RepositoryOwner string `json:"repository_owner"`
-	Ref             string `json:"ref"`
-	RefType         string `json:"ref_type"`
-	SHA             string `json:"sha"`
-	Workflow        string `json:"workflow"`
-	JobWorkflowRef  string `json:"job_workflow_ref"`
-	Actor           string `json:"actor"`
+	Repository      string     `json:"repository"`
+	RepositoryOwner string     `json:"repository_owner"`
+	Ref             string     `json:"ref"`
+	RefType         string     `json:"ref_type"`
+	SHA             string     `json:"sha"`
+	Workflow        string     `json:"workflow"`
+	JobWorkflowRef  string     `json:"job_workflow_ref"`
+	Actor           string     `json:"actor"`
 	RunID           ClaimInt64 `json:"run_id"`
 	RunAttempt      ClaimInt64 `json:"run_attempt"`
+	// Rules is set by the provider that verified the token; the zero value
+	// means GitHub.
+	Rules RepoRules `json:"-"`
+}
+
+// RepoRules describe where a provider's repositories and raw files live.
+// ManifestURLTemplate may use {repo} and {tag}. WorkflowURLBase is what
+// Fulcio puts before the job workflow ref in a signing certificate's build
+// signer URI; empty means RepoURLBase.
+type RepoRules struct {
+	RepoURLBase         string
+	ManifestURLTemplate string
+	WorkflowURLBase     string
+}
+
+var gitHubRepoRules = RepoRules{
+	RepoURLBase:         "https://github.com/",
+	ManifestURLTemplate: "https://raw.githubusercontent.com/{repo}/{tag}/",
+	WorkflowURLBase:     "https://github.com/",
+}
+
+func (c OIDCClaims) repoRules() RepoRules {
+	if c.Rules.RepoURLBase == "" {
+		return gitHubRepoRules
+	}
+	return c.Rules
+}
+
+// RepoURL returns the web URL of the repository the token was issued to.
+func (c OIDCClaims) RepoURL() string {
+	return strings.TrimSuffix(c.repoRules().RepoURLBase, "/") + "/" + strings.TrimSpace(c.Repository)
+}
+
+// SignerWorkflowURL returns the build signer URI Fulcio certifies for the
+// workflow the token was issued to, or "" without a job workflow ref.
+func (c OIDCClaims) SignerWorkflowURL() string {
+	ref := strings.TrimSpace(c.JobWorkflowRef)
+	if ref == "" {
+		return ""
+	}
+	rules := c.repoRules()
+	base := rules.WorkflowURLBase
+	if base == "" {
+		base = strings.TrimSuffix(rules.RepoURLBase, "/") + "/"
+	}
+	return base + ref
+}
+
+// ManifestURLPrefix returns the prefix manifest URLs must have for tag.
+func (c OIDCClaims) ManifestURLPrefix(tag string) string {
+	out := strings.ReplaceAll(c.repoRules().ManifestURLTemplate, "{repo}", strings.TrimSpace(c.Repository))
+	return strings.ReplaceAll(out, "{tag}", tag)
 }
 
 type ClaimInt64 int64
@@ -77,59 +127,46 @@ type OIDCVerifier interface {
 	VerifyWorkflow(ctx context.Context, claims OIDCClaims) error
 }
 
+// GitHubOIDCVerifier accepts GitHub Actions tokens. VerifyWorkflow runs the
+// release gates in RELEASE_GATES against the token's repository and commit.
 type GitHubOIDCVerifier struct {
-	issuer         string
-	audience       string
-	verifyWorkflow string
-	githubToken    string
-	client         *http.Client
-	jwks           jwksCache
-}
-
-type jwksCache struct {
-	mu        sync.Mutex
-	expires   time.Time
-	keysByKID map[string]*rsa.PublicKey
+	issuer   string
+	audience string
+	gates    []gates.Gate
+	gatesErr error
+	jwks     *jwksCache
 }
 
 func NewGitHubOIDCVerifier(cfg config.Config) *GitHubOIDCVerifier {
+	releaseGates, err := gates.Parse(cfg.ReleaseGates, gates.NewGitHub(cfg.GitHubAPIToken))
+	if err != nil {
+		log.Printf("oidc provider github release gates invalid: %v", err)
+	}
 	return &GitHubOIDCVerifier{
-		issuer:         cfg.OIDCIssuer,
-		audience:       cfg.OIDCAudience,
-		verifyWorkflow: cfg.OIDCVerifyWorkflow,
-		githubToken:    cfg.GitHubAPIToken,
-		client:         &http.Client{Timeout: 10 * time.Second},
+		issuer:   cfg.OIDCIssuer,
+		audience: cfg.OIDCAudience,
+		gates:    releaseGates,
+		gatesErr: err,
+		jwks:     newJWKSCache(strings.TrimSuffix(cfg.OIDCIssuer, "/")+"/.well-known/jwks", &http.Client{Timeout: 10 * time.Second}, cfg),
 	}
 }
 
+func (v *GitHubOIDCVerifier) Issuer() string {
+	return v.issuer
+}
+
+func (v *GitHubOIDCVerifier) JWKSStatus() JWKSStatus {
+	return v.jwks.status()
+}
+
 func (v *GitHubOIDCVerifier) Verify(ctx context.Context, token string) (OIDCClaims, error) {
 	var claims OIDCClaims
 	if strings.TrimSpace(token) == "" {
 		return claims, errors.New("missing oidc token")
 	}
 
-	parser := jwt.NewParser(
-		jwt.WithValidMethods([]string{"RS256"}),
-		jwt.WithAudience(v.audience),
-		jwt.WithIssuer(v.issuer),
-	)
-
-	parsed, err := parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
-		kid, _ := t.Header["kid"].(string)
-		if kid == "" {
-			return nil, errors.New("missing kid")
-		}
-		key, err := v.keyForKID(ctx, kid)
-		if err != nil {
-			return nil, err
-		}
-		return key, nil
-	})
-	if err != nil {
-		return claims, fmt.Errorf("invalid oidc token: %w", err)
-	}
-	if parsed == nil || !parsed.Valid {
-		return claims, errors.New("invalid oidc token")
+	if err := verifyOIDCToken(ctx, token, v.issuer, v.audience, v.jwks, &claims); err != nil {
+		return claims, err
 	}
 
 	if claims.Repository == "" || claims.Ref == "" || claims.SHA == "" {
@@ -140,115 +177,41 @@ func (v *GitHubOIDCVerifier) Verify(ctx context.Context, token string) (OIDCClai
 }
 
 func (v *GitHubOIDCVerifier) VerifyWorkflow(ctx context.Context, claims OIDCClaims) error {
-	if v.verifyWorkflow == "" {
-		return errors.New("verify workflow not configured")
+	if v.gatesErr != nil {
+		return v.gatesErr
 	}
-
-	url := fmt.Sprintf("https://api.github.com/repos/%s/actions/workflows/%s/runs?per_page=1&status=success&head_sha=%s", claims.Repository, v.verifyWorkflow, claims.SHA)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("User-Agent", "homenavi-marketplace")
-	if strings.TrimSpace(v.githubToken) != "" {
-		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(v.githubToken))
-	}
-
-	resp, err := v.client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("github api error: %s", resp.Status)
-	}
-
-	var payload struct {
-		TotalCount int `json:"total_count"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return err
-	}
-	if payload.TotalCount < 1 {
-		return errors.New("verify workflow did not pass")
-	}
-	return nil
+	_, err := gates.Run(ctx, v.gates, gates.Release{Repository: claims.Repository, Ref: claims.Ref, SHA: claims.SHA})
+	return err
 }
 
-func (v *GitHubOIDCVerifier) keyForKID(ctx context.Context, kid string) (*rsa.PublicKey, error) {
-	v.jwks.mu.Lock()
-	defer v.jwks.mu.Unlock()
-
-	if v.jwks.keysByKID == nil || time.Now().After(v.jwks.expires) {
-		keys, err := v.fetchJWKS(ctx)
-		if err != nil {
-			return nil, err
-		}
-		v.jwks.keysByKID = keys
-		v.jwks.expires = time.Now().Add(30 * time.Minute)
-	}
-	key := v.jwks.keysByKID[kid]
-	if key == nil {
-		return nil, errors.New("unknown kid")
-	}
-	return key, nil
-}
-
-func (v *GitHubOIDCVerifier) fetchJWKS(ctx context.Context) (map[string]*rsa.PublicKey, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://token.actions.githubusercontent.com/.well-known/jwks", nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := v.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("jwks fetch failed: %s", resp.Status)
-	}
-
-	var payload struct {
-		Keys []struct {
-			KID string `json:"kid"`
-			Kty string `json:"kty"`
-			Alg string `json:"alg"`
-			Use string `json:"use"`
-			N   string `json:"n"`
-			E   string `json:"e"`
-		} `json:"keys"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
-		return nil, err
-	}
+// verifyOIDCToken checks the signature, issuer and audience of token and
+// decodes its payload into claims.
+func verifyOIDCToken(ctx context.Context, token, issuer, audience string, jwks *jwksCache, claims jwt.Claims) error {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithAudience(audience),
+		jwt.WithIssuer(issuer),
+	)
 
-	out := make(map[string]*rsa.PublicKey)
-	for _, key := range payload.Keys {
-		if key.KID == "" || key.N == "" || key.E == "" {
-			continue
-		}
-		nBytes, err := base64.RawURLEncoding.DecodeString(key.N)
-		if err != nil {
-			continue
+	parsed, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("missing kid")
 		}
-		eBytes, err := base64.RawURLEncoding.DecodeString(key.E)
+		key, err := jwks.key(ctx, kid)
 		if err != nil {
-			continue
+			return nil, err
 		}
-		eInt := big.NewInt(0).SetBytes(eBytes).Int64()
-		if eInt <= 0 {
-			continue
+		if key.alg != "" && key.alg != t.Method.Alg() {
+			return nil, fmt.Errorf("kid %q is for %s, token uses %s", kid, key.alg, t.Method.Alg())
 		}
-		out[key.KID] = &rsa.PublicKey{N: big.NewInt(0).SetBytes(nBytes), E: int(eInt)}
+		return key.key, nil
+	})
+	if err != nil {
+		return fmt.Errorf("invalid oidc token: %w", err)
 	}
-
-	if len(out) == 0 {
-		return nil, errors.New("no jwks keys found")
+	if parsed == nil || !parsed.Valid {
+		return errors.New("invalid oidc token")
 	}
-
-	return out, nil
+	return nil
 }
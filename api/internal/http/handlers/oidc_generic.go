@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GenericOIDCVerifier accepts tokens from any issuer with a JWKS endpoint.
+// The repository, ref, ref type, commit and workflow are read from
+// configurable claims. It has no CI API to check, so VerifyWorkflow only
+// accepts tokens requested by one of the allowed workflows.
+type GenericOIDCVerifier struct {
+	issuer           string
+	audience         string
+	repoClaim        string
+	refClaim         string
+	refTypeClaim     string
+	shaClaim         string
+	workflowClaim    string
+	allowedWorkflows map[string]bool
+	rules            RepoRules
+	jwks             *jwksCache
+}
+
+func NewGenericOIDCVerifier(cfg config.Config) (*GenericOIDCVerifier, error) {
+	if cfg.GenericOIDCIssuer == "" || cfg.GenericOIDCJWKSURL == "" {
+		return nil, errors.New("GENERIC_OIDC_ISSUER and GENERIC_OIDC_JWKS_URL are required")
+	}
+	if cfg.GenericOIDCRepoURLBase == "" || cfg.GenericOIDCManifestURLTemplate == "" {
+		return nil, errors.New("GENERIC_OIDC_REPO_URL_BASE and GENERIC_OIDC_MANIFEST_URL_TEMPLATE are required")
+	}
+	if cfg.GenericOIDCRefTypeClaim == "" {
+		return nil, errors.New("GENERIC_OIDC_REF_TYPE_CLAIM is required")
+	}
+	allowed := make(map[string]bool, len(cfg.GenericOIDCAllowedWorkflows))
+	for _, workflow := range cfg.GenericOIDCAllowedWorkflows {
+		allowed[workflow] = true
+	}
+	return &GenericOIDCVerifier{
+		issuer:           cfg.GenericOIDCIssuer,
+		audience:         cfg.GenericOIDCAudience,
+		repoClaim:        cfg.GenericOIDCRepoClaim,
+		refClaim:         cfg.GenericOIDCRefClaim,
+		refTypeClaim:     cfg.GenericOIDCRefTypeClaim,
+		shaClaim:         cfg.GenericOIDCSHAClaim,
+		workflowClaim:    cfg.GenericOIDCWorkflowClaim,
+		allowedWorkflows: allowed,
+		rules: RepoRules{
+			RepoURLBase:         cfg.GenericOIDCRepoURLBase,
+			ManifestURLTemplate: cfg.GenericOIDCManifestURLTemplate,
+		},
+		jwks: newJWKSCache(cfg.GenericOIDCJWKSURL, &http.Client{Timeout: 10 * time.Second}, cfg),
+	}, nil
+}
+
+func (v *GenericOIDCVerifier) Issuer() string {
+	return v.issuer
+}
+
+func (v *GenericOIDCVerifier) JWKSStatus() JWKSStatus {
+	return v.jwks.status()
+}
+
+func (v *GenericOIDCVerifier) Verify(ctx context.Context, token string) (OIDCClaims, error) {
+	raw := jwt.MapClaims{}
+	if strings.TrimSpace(token) == "" {
+		return OIDCClaims{}, errors.New("missing oidc token")
+	}
+	if err := verifyOIDCToken(ctx, token, v.issuer, v.audience, v.jwks, raw); err != nil {
+		return OIDCClaims{}, err
+	}
+	return v.mapClaims(raw)
+}
+
+func (v *GenericOIDCVerifier) mapClaims(raw jwt.MapClaims) (OIDCClaims, error) {
+	claims := OIDCClaims{
+		Repository: stringClaim(raw, v.repoClaim),
+		SHA:        stringClaim(raw, v.shaClaim),
+		Workflow:   stringClaim(raw, v.workflowClaim),
+		Actor:      stringClaim(raw, "sub"),
+		Rules:      v.rules,
+	}
+	claims.Issuer = stringClaim(raw, "iss")
+	claims.Subject = stringClaim(raw, "sub")
+	claims.ID = stringClaim(raw, "jti")
+
+	// The ref type claim decides whether the ref is a tag; a bare ref name
+	// alone does not.
+	ref := stringClaim(raw, v.refClaim)
+	refType := stringClaim(raw, v.refTypeClaim)
+	if claims.Repository == "" || ref == "" || refType == "" || claims.SHA == "" {
+		return claims, fmt.Errorf("missing required oidc claims (%s, %s, %s, %s)", v.repoClaim, v.refClaim, v.refTypeClaim, v.shaClaim)
+	}
+	switch {
+	case refType == "tag" && !strings.HasPrefix(ref, "refs/"):
+		claims.Ref = "refs/tags/" + ref
+	case refType == "tag" && strings.HasPrefix(ref, "refs/tags/"):
+		claims.Ref = ref
+	case refType != "tag" && !strings.HasPrefix(ref, "refs/tags/"):
+		claims.Ref = ref
+		if !strings.HasPrefix(ref, "refs/") {
+			claims.Ref = "refs/heads/" + ref
+		}
+	default:
+		return claims, fmt.Errorf("oidc %s %q does not match %s %q", v.refClaim, ref, v.refTypeClaim, refType)
+	}
+	claims.RefType = refType
+	return claims, nil
+}
+
+func (v *GenericOIDCVerifier) VerifyWorkflow(_ context.Context, claims OIDCClaims) error {
+	if len(v.allowedWorkflows) == 0 {
+		return errors.New("generic oidc provider has no allowed workflows configured")
+	}
+	if !v.allowedWorkflows[claims.Workflow] {
+		return fmt.Errorf("oidc %s %q is not an allowed workflow", v.workflowClaim, claims.Workflow)
+	}
+	return nil
+}
+
+func stringClaim(raw jwt.MapClaims, name string) string {
+	value, _ := raw[name].(string)
+	return strings.TrimSpace(value)
+}
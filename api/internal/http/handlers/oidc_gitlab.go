@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// GitLabOIDCVerifier accepts GitLab CI id_tokens. The project path is used as
+// the repository and the verify job must have succeeded in the same pipeline.
+type GitLabOIDCVerifier struct {
+	issuer    string
+	audience  string
+	verifyJob string
+	apiToken  string
+	client    *http.Client
+	jwks      *jwksCache
+}
+
+type gitLabClaims struct {
+	jwt.RegisteredClaims
+	ProjectPath    string     `json:"project_path"`
+	NamespacePath  string     `json:"namespace_path"`
+	Ref            string     `json:"ref"`
+	RefType        string     `json:"ref_type"`
+	SHA            string     `json:"sha"`
+	PipelineID     ClaimInt64 `json:"pipeline_id"`
+	UserLogin      string     `json:"user_login"`
+	CIConfigRefURI string     `json:"ci_config_ref_uri"`
+}
+
+func NewGitLabOIDCVerifier(cfg config.Config) *GitLabOIDCVerifier {
+	issuer := strings.TrimSuffix(cfg.GitLabOIDCIssuer, "/")
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &GitLabOIDCVerifier{
+		issuer:    issuer,
+		audience:  cfg.GitLabOIDCAudience,
+		verifyJob: cfg.GitLabVerifyJob,
+		apiToken:  cfg.GitLabAPIToken,
+		client:    client,
+		jwks:      newJWKSCache(issuer+"/oauth/discovery/keys", client, cfg),
+	}
+}
+
+func (v *GitLabOIDCVerifier) Issuer() string {
+	return v.issuer
+}
+
+func (v *GitLabOIDCVerifier) JWKSStatus() JWKSStatus {
+	return v.jwks.status()
+}
+
+func (v *GitLabOIDCVerifier) Verify(ctx context.Context, token string) (OIDCClaims, error) {
+	var raw gitLabClaims
+	if strings.TrimSpace(token) == "" {
+		return OIDCClaims{}, errors.New("missing oidc token")
+	}
+	if err := verifyOIDCToken(ctx, token, v.issuer, v.audience, v.jwks, &raw); err != nil {
+		return OIDCClaims{}, err
+	}
+	if raw.ProjectPath == "" || raw.Ref == "" || raw.SHA == "" {
+		return OIDCClaims{}, errors.New("missing required oidc claims")
+	}
+
+	ref := "refs/heads/" + raw.Ref
+	if raw.RefType == "tag" {
+		ref = "refs/tags/" + raw.Ref
+	}
+	return OIDCClaims{
+		RegisteredClaims: raw.RegisteredClaims,
+		Repository:       raw.ProjectPath,
+		RepositoryOwner:  raw.NamespacePath,
+		Ref:              ref,
+		RefType:          raw.RefType,
+		SHA:              raw.SHA,
+		Workflow:         raw.CIConfigRefURI,
+		JobWorkflowRef:   raw.CIConfigRefURI,
+		Actor:            raw.UserLogin,
+		RunID:            raw.PipelineID,
+		Rules: RepoRules{
+			RepoURLBase:         v.issuer + "/",
+			ManifestURLTemplate: v.issuer + "/{repo}/-/raw/{tag}/",
+			// ci_config_ref_uri already starts with the GitLab host.
+			WorkflowURLBase: "https://",
+		},
+	}, nil
+}
+
+func (v *GitLabOIDCVerifier) VerifyWorkflow(ctx context.Context, claims OIDCClaims) error {
+	if v.verifyJob == "" {
+		return errors.New("verify job not configured")
+	}
+	if claims.RunID == 0 {
+		return errors.New("oidc pipeline_id claim missing")
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v4/projects/%s/pipelines/%d/jobs?scope[]=success&per_page=100", v.issuer, url.PathEscape(claims.Repository), claims.RunID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "homenavi-marketplace")
+	if strings.TrimSpace(v.apiToken) != "" {
+		req.Header.Set("PRIVATE-TOKEN", strings.TrimSpace(v.apiToken))
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gitlab api error: %s", resp.Status)
+	}
+
+	var jobs []struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if job.Name == v.verifyJob {
+			return nil
+		}
+	}
+	return errors.New("verify job did not pass")
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCProvider is an OIDCVerifier for a single token issuer.
+type OIDCProvider interface {
+	OIDCVerifier
+	Issuer() string
+}
+
+// OIDCRegistry dispatches tokens to the provider matching their issuer.
+type OIDCRegistry struct {
+	providers map[string]OIDCProvider
+}
+
+func NewOIDCRegistry(providers ...OIDCProvider) *OIDCRegistry {
+	r := &OIDCRegistry{providers: make(map[string]OIDCProvider, len(providers))}
+	for _, p := range providers {
+		r.providers[normalizeIssuer(p.Issuer())] = p
+	}
+	return r
+}
+
+// NewOIDCRegistryFromConfig builds the providers named in OIDC_PROVIDERS.
+// Unknown or incomplete providers are logged and skipped.
+func NewOIDCRegistryFromConfig(cfg config.Config) *OIDCRegistry {
+	providers := []OIDCProvider{}
+	for _, name := range cfg.OIDCProviders {
+		switch strings.ToLower(name) {
+		case "github":
+			providers = append(providers, NewGitHubOIDCVerifier(cfg))
+		case "gitlab":
+			providers = append(providers, NewGitLabOIDCVerifier(cfg))
+		case "generic":
+			p, err := NewGenericOIDCVerifier(cfg)
+			if err != nil {
+				log.Printf("oidc provider generic disabled: %v", err)
+				continue
+			}
+			providers = append(providers, p)
+		default:
+			log.Printf("oidc provider %q unknown, skipping", name)
+		}
+	}
+	return NewOIDCRegistry(providers...)
+}
+
+func (r *OIDCRegistry) Verify(ctx context.Context, token string) (OIDCClaims, error) {
+	if strings.TrimSpace(token) == "" {
+		return OIDCClaims{}, errors.New("missing oidc token")
+	}
+	// The issuer is read before the signature is checked only to pick the
+	// provider; the provider then verifies it against its own configuration.
+	var unverified jwt.RegisteredClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(token, &unverified); err != nil {
+		return OIDCClaims{}, fmt.Errorf("invalid oidc token: %w", err)
+	}
+	p, err := r.provider(unverified.Issuer)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+	return p.Verify(ctx, token)
+}
+
+func (r *OIDCRegistry) VerifyWorkflow(ctx context.Context, claims OIDCClaims) error {
+	p, err := r.provider(claims.Issuer)
+	if err != nil {
+		return err
+	}
+	return p.VerifyWorkflow(ctx, claims)
+}
+
+func (r *OIDCRegistry) provider(issuer string) (OIDCProvider, error) {
+	p, ok := r.providers[normalizeIssuer(issuer)]
+	if !ok {
+		return nil, fmt.Errorf("oidc issuer %q not accepted", issuer)
+	}
+	return p, nil
+}
+
+// OIDCProviderStatus is the state of one provider's signing key cache.
+type OIDCProviderStatus struct {
+	Issuer string      `json:"issuer"`
+	JWKS   *JWKSStatus `json:"jwks,omitempty"`
+}
+
+// Status reports every provider, sorted by issuer.
+func (r *OIDCRegistry) Status() []OIDCProviderStatus {
+	out := make([]OIDCProviderStatus, 0, len(r.providers))
+	for _, p := range r.providers {
+		status := OIDCProviderStatus{Issuer: p.Issuer()}
+		if cached, ok := p.(interface{ JWKSStatus() JWKSStatus }); ok {
+			jwks := cached.JWKSStatus()
+			status.JWKS = &jwks
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Issuer < out[j].Issuer })
+	return out
+}
+
+// OIDCStatus reports the JWKS cache of each OIDC provider. It answers 503
+// when the last key fetch of any provider failed.
+func (h IntegrationsHandler) OIDCStatus(w http.ResponseWriter, r *http.Request) {
+	registry, ok := h.OIDCVerifier.(interface{ Status() []OIDCProviderStatus })
+	if !ok {
+		writeError(w, http.StatusNotFound, "oidc status not available")
+		return
+	}
+	providers := registry.Status()
+	status, code := "ok", http.StatusOK
+	for _, p := range providers {
+		if p.JWKS != nil && p.JWKS.LastError != "" {
+			status, code = "degraded", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, code, map[string]any{"status": status, "providers": providers})
+}
+
+func normalizeIssuer(issuer string) string {
+	return strings.TrimSuffix(strings.TrimSpace(issuer), "/")
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestIssuer(t *testing.T, jwksPath string) (*httptest.Server, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != jwksPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "test",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, key
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func TestOIDCRegistryGitLab(t *testing.T) {
+	srv, key := newTestIssuer(t, "/oauth/discovery/keys")
+	registry := NewOIDCRegistry(NewGitLabOIDCVerifier(config.Config{
+		GitLabOIDCIssuer:   srv.URL,
+		GitLabOIDCAudience: "homenavi-marketplace",
+	}))
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	token := signTestToken(t, key, jwt.MapClaims{
+		"iss":               srv.URL,
+		"aud":               "homenavi-marketplace",
+		"project_path":      "homenavi/contrib/hue",
+		"ref":               "v1.0.0",
+		"ref_type":          "tag",
+		"sha":               "abc123",
+		"pipeline_id":       "42",
+		"ci_config_ref_uri": host + "/homenavi/contrib/hue//.gitlab-ci.yml@refs/tags/v1.0.0",
+	})
+	claims, err := registry.Verify(context.Background(), token)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.Ref != "refs/tags/v1.0.0" || claims.RunID != 42 {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+	if got := claims.RepoURL(); got != srv.URL+"/homenavi/contrib/hue" {
+		t.Fatalf("unexpected repo url %q", got)
+	}
+	if got, want := claims.SignerWorkflowURL(), "https://"+host+"/homenavi/contrib/hue//.gitlab-ci.yml@refs/tags/v1.0.0"; got != want {
+		t.Fatalf("expected signer workflow url %q, got %q", want, got)
+	}
+
+	req := testPublishRequest(t)
+	req.Version = "v1.0.0"
+	req.ReleaseTag = "v1.0.0"
+	req.RepoURL = srv.URL + "/homenavi/contrib/hue"
+	req.ManifestURL = srv.URL + "/homenavi/contrib/hue/-/raw/v1.0.0/manifest/homenavi-integration.json"
+	if err := validateOIDCRequest(req, claims, "v1.0.0"); err != nil {
+		t.Fatalf("expected valid gitlab request, got %v", err)
+	}
+	req.ManifestURL = "https://raw.githubusercontent.com/homenavi/contrib/v1.0.0/manifest.json"
+	if err := validateOIDCRequest(req, claims, "v1.0.0"); err == nil {
+		t.Fatalf("expected github manifest url to be rejected for a gitlab token")
+	}
+}
+
+func TestOIDCRegistryGeneric(t *testing.T) {
+	srv, key := newTestIssuer(t, "/jwks")
+	generic, err := NewGenericOIDCVerifier(config.Config{
+		GenericOIDCIssuer:              srv.URL,
+		GenericOIDCJWKSURL:             srv.URL + "/jwks",
+		GenericOIDCAudience:            "homenavi-marketplace",
+		GenericOIDCRepoClaim:           "repo",
+		GenericOIDCRefClaim:            "ref",
+		GenericOIDCSHAClaim:            "commit",
+		GenericOIDCRefTypeClaim:        "ref_kind",
+		GenericOIDCWorkflowClaim:       "pipeline",
+		GenericOIDCAllowedWorkflows:    []string{"team/hue/.ci/release.yml"},
+		GenericOIDCRepoURLBase:         "https://git.example.com/",
+		GenericOIDCManifestURLTemplate: "https://git.example.com/{repo}/raw/{tag}/",
+	})
+	if err != nil {
+		t.Fatalf("generic verifier: %v", err)
+	}
+	registry := NewOIDCRegistry(generic)
+
+	claims, err := registry.Verify(context.Background(), signTestToken(t, key, jwt.MapClaims{
+		"iss":      srv.URL,
+		"aud":      "homenavi-marketplace",
+		"repo":     "team/hue",
+		"ref":      "v1.0.0",
+		"ref_kind": "tag",
+		"commit":   "abc123",
+		"pipeline": "team/hue/.ci/release.yml",
+	}))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.Ref != "refs/tags/v1.0.0" || claims.RefType != "tag" {
+		t.Fatalf("unexpected ref %q (%s)", claims.Ref, claims.RefType)
+	}
+	if claims.RepoURL() != "https://git.example.com/team/hue" || claims.ManifestURLPrefix("v1.0.0") != "https://git.example.com/team/hue/raw/v1.0.0/" {
+		t.Fatalf("unexpected repo rules: %q %q", claims.RepoURL(), claims.ManifestURLPrefix("v1.0.0"))
+	}
+	if err := registry.VerifyWorkflow(context.Background(), claims); err != nil {
+		t.Fatalf("verify workflow: %v", err)
+	}
+	other := claims
+	other.Workflow = "team/hue/.ci/anything.yml"
+	if err := registry.VerifyWorkflow(context.Background(), other); err == nil {
+		t.Fatalf("expected a workflow outside the allowed list to be rejected")
+	}
+
+	// A bare ref without a ref type is not taken to be a tag.
+	if _, err := registry.Verify(context.Background(), signTestToken(t, key, jwt.MapClaims{
+		"iss":    srv.URL,
+		"aud":    "homenavi-marketplace",
+		"repo":   "team/hue",
+		"ref":    "v1.0.0",
+		"commit": "abc123",
+	})); err == nil {
+		t.Fatalf("expected a token without a ref type to be rejected")
+	}
+	branch, err := registry.Verify(context.Background(), signTestToken(t, key, jwt.MapClaims{
+		"iss":      srv.URL,
+		"aud":      "homenavi-marketplace",
+		"repo":     "team/hue",
+		"ref":      "v1.0.0",
+		"ref_kind": "branch",
+		"commit":   "abc123",
+	}))
+	if err != nil || branch.Ref != "refs/heads/v1.0.0" {
+		t.Fatalf("expected a branch named like a tag to stay a branch, got %q err=%v", branch.Ref, err)
+	}
+
+	ungated, err := NewGenericOIDCVerifier(config.Config{
+		GenericOIDCIssuer:              srv.URL,
+		GenericOIDCJWKSURL:             srv.URL + "/jwks",
+		GenericOIDCRefTypeClaim:        "ref_kind",
+		GenericOIDCRepoURLBase:         "https://git.example.com/",
+		GenericOIDCManifestURLTemplate: "https://git.example.com/{repo}/raw/{tag}/",
+	})
+	if err != nil {
+		t.Fatalf("generic verifier: %v", err)
+	}
+	if err := ungated.VerifyWorkflow(context.Background(), claims); err == nil {
+		t.Fatalf("expected publishes to be refused without allowed workflows")
+	}
+	if _, err := NewGenericOIDCVerifier(config.Config{
+		GenericOIDCIssuer:              srv.URL,
+		GenericOIDCJWKSURL:             srv.URL + "/jwks",
+		GenericOIDCRepoURLBase:         "https://git.example.com/",
+		GenericOIDCManifestURLTemplate: "https://git.example.com/{repo}/raw/{tag}/",
+	}); err == nil {
+		t.Fatalf("expected the ref type claim to be required")
+	}
+
+	_, err = registry.Verify(context.Background(), signTestToken(t, key, jwt.MapClaims{
+		"iss":  "https://unknown.example.com",
+		"aud":  "homenavi-marketplace",
+		"repo": "team/hue",
+	}))
+	if err == nil {
+		t.Fatalf("expected unknown issuer to be rejected")
+	}
+}
@@ -40,6 +40,29 @@ func TestValidateOIDCRequestRejectsRepoMismatch(t *testing.T) {
 	}
 }
 
+func TestValidateOIDCRequestConfinesManifestURL(t *testing.T) {
+	claims := OIDCClaims{
+		Repository: "PetoAdam/homenavi-spotify",
+		Ref:        "refs/tags/v0.1.0",
+		RefType:    "tag",
+	}
+
+	req := testPublishRequest(t)
+	req.Version = "v0.1.0"
+	req.ReleaseTag = "v0.1.0"
+	req.RepoURL = "https://github.com/PetoAdam/homenavi-spotify"
+	req.ManifestURL = "https://raw.githubusercontent.com/PetoAdam/homenavi-spotify/v0.1.0/../../../other/repo/v1.0.0/manifest.json"
+	if err := validateOIDCRequest(req, claims, "v0.1.0"); err == nil {
+		t.Fatalf("expected manifest_url leaving the tag to be rejected")
+	}
+
+	claims.Rules = RepoRules{RepoURLBase: "https://github.com/"}
+	req.ManifestURL = "https://raw.githubusercontent.com/PetoAdam/homenavi-spotify/v0.1.0/manifest.json"
+	if err := validateOIDCRequest(req, claims, "v0.1.0"); err == nil {
+		t.Fatalf("expected a provider without a manifest_url template to be rejected")
+	}
+}
+
 func TestTagFromClaims(t *testing.T) {
 	claims := OIDCClaims{
 		Ref:     "refs/tags/v1.2.3",
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+func (h IntegrationsHandler) Owner(w http.ResponseWriter, r *http.Request) {
+	owner, err := store.GetOwnership(r.Context(), h.DB, chi.URLParam(r, "id"))
+	if err != nil {
+		writeOwnershipError(w, err, "failed to load owner")
+		return
+	}
+	writeJSON(w, http.StatusOK, owner)
+}
+
+// RequestTransfer lets the owning repository offer the id to another repository.
+func (h IntegrationsHandler) RequestTransfer(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	repo, ok := h.oidcRepository(w, r)
+	if !ok {
+		return
+	}
+	var req models.TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	transfer, err := store.RequestTransfer(r.Context(), h.DB, id, repo, req.ToRepository)
+	if err != nil {
+		writeOwnershipError(w, err, "failed to request transfer")
+		return
+	}
+	log.Printf("ownership transfer requested id=%q from=%q to=%q", id, transfer.FromRepository, transfer.ToRepository)
+	writeJSON(w, http.StatusCreated, transfer)
+}
+
+func (h IntegrationsHandler) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	repo, ok := h.oidcRepository(w, r)
+	if !ok {
+		return
+	}
+	if err := store.CancelTransfer(r.Context(), h.DB, id, repo); err != nil {
+		writeOwnershipError(w, err, "failed to cancel transfer")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AcceptTransfer completes a pending transfer; the token must come from the
+// receiving repository.
+func (h IntegrationsHandler) AcceptTransfer(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	repo, ok := h.oidcRepository(w, r)
+	if !ok {
+		return
+	}
+	owner, err := store.AcceptTransfer(r.Context(), h.DB, id, repo)
+	if err != nil {
+		writeOwnershipError(w, err, "failed to accept transfer")
+		return
+	}
+	writeJSON(w, http.StatusOK, owner)
+}
+
+func writeOwnershipError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeError(w, http.StatusNotFound, "owner not found")
+	case errors.Is(err, store.ErrNotOwner):
+		writeError(w, http.StatusForbidden, err.Error())
+	case errors.Is(err, store.ErrNoPendingTransfer):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrInvalidRepository):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, message)
+	}
+}
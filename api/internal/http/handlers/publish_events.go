@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+)
+
+// maxRecordedResponse bounds the error body kept for a publish event.
+const maxRecordedResponse = 64 << 10
+
+// publishAttempt collects what a publish handler learned about the caller
+// and the request before it responded.
+type publishAttempt struct {
+	endpoint  string
+	publisher string
+	tokenID   string
+	claims    *OIDCClaims
+	request   *models.PublishRequest
+}
+
+// publishRecorder keeps the status and error body of a publish response so
+// every outcome can be recorded without touching each error path.
+type publishRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *publishRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *publishRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.status >= http.StatusBadRequest && r.body.Len() < maxRecordedResponse {
+		r.body.Write(data[:min(len(data), maxRecordedResponse-r.body.Len())])
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+// recordPublish stores the attempt in publish_events. Attempts whose API
+// key or OIDC token did not verify are only counted, so anyone able to reach
+// the endpoint cannot fill the log. Failures are logged because the response
+// has already been sent.
+func (h IntegrationsHandler) recordPublish(r *http.Request, rec *publishRecorder, attempt *publishAttempt) {
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ctx := context.WithoutCancel(r.Context())
+	if attempt.publisher == "" && attempt.claims == nil {
+		if err := store.CountUnauthenticatedPublish(ctx, h.DB, attempt.endpoint, status, time.Now()); err != nil {
+			log.Printf("publish attempt count failed endpoint=%q status=%d: %v", attempt.endpoint, status, err)
+		}
+		return
+	}
+	event := models.PublishEvent{
+		Endpoint:  attempt.endpoint,
+		Status:    status,
+		Outcome:   publishOutcome(status),
+		Publisher: attempt.publisher,
+		TokenID:   attempt.tokenID,
+	}
+	if claims := attempt.claims; claims != nil {
+		event.Issuer = claims.Issuer
+		event.Subject = claims.Subject
+		event.Repository = claims.RepoURL()
+		if repository := store.NormalizeRepository(event.Repository); repository != "" {
+			event.Repository = repository
+		}
+		event.Actor = claims.Actor
+		event.RunID = int64(claims.RunID)
+		event.RunAttempt = int64(claims.RunAttempt)
+		event.Claims = toMap(claims)
+	}
+	if attempt.request != nil {
+		req := *attempt.request
+		// The SBOM is stored with the release; keeping it here would only
+		// bloat the log.
+		req.SBOM = nil
+		event.IntegrationID = req.ID
+		event.Version = req.Version
+		event.Request = toMap(req)
+	}
+	if status >= http.StatusBadRequest {
+		_ = json.Unmarshal(rec.body.Bytes(), &event.Response)
+		event.Error, _ = event.Response["error"].(string)
+	}
+	if err := store.RecordPublishEvent(ctx, h.DB, event); err != nil {
+		log.Printf("publish event record failed endpoint=%q id=%q status=%d: %v", event.Endpoint, event.IntegrationID, status, err)
+	}
+}
+
+func publishOutcome(status int) string {
+	switch {
+	case status < http.StatusBadRequest:
+		return "published"
+	case status < http.StatusInternalServerError:
+		return "rejected"
+	default:
+		return "error"
+	}
+}
+
+func toMap(value any) map[string]any {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var out map[string]any
+	_ = json.Unmarshal(data, &out)
+	return out
+}
+
+// oidcTokenID identifies a token for replay protection: its jti, else the
+// CI run attempt it was issued to, else a hash of the token itself.
+func oidcTokenID(claims OIDCClaims, token string) string {
+	if claims.ID != "" {
+		return "jti:" + claims.ID
+	}
+	if claims.RunID != 0 {
+		return fmt.Sprintf("run:%s:%d:%d", claims.Repository, claims.RunID, claims.RunAttempt)
+	}
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// consumeOIDCToken rejects a token that was already presented.
+func (h IntegrationsHandler) consumeOIDCToken(ctx context.Context, claims OIDCClaims, tokenID string) error {
+	expiresAt := time.Now().Add(24 * time.Hour)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	return store.ConsumeOIDCToken(ctx, h.DB, claims.Issuer, tokenID, expiresAt)
+}
+
+func writeReplayError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrTokenReplayed) {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "failed to record oidc token")
+}
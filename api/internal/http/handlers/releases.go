@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+func (h IntegrationsHandler) Yank(w http.ResponseWriter, r *http.Request) {
+	id, version, ok := h.authorizeReleaseOwner(w, r)
+	if !ok {
+		return
+	}
+	var req models.YankRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		writeError(w, http.StatusBadRequest, "reason is required")
+		return
+	}
+	item, err := store.YankRelease(r.Context(), h.DB, id, version, req.Reason, h.PrereleaseLatest)
+	h.writeReleaseUpdate(w, "yank", item, err)
+}
+
+func (h IntegrationsHandler) Unyank(w http.ResponseWriter, r *http.Request) {
+	id, version, ok := h.authorizeReleaseOwner(w, r)
+	if !ok {
+		return
+	}
+	item, err := store.UnyankRelease(r.Context(), h.DB, id, version, h.PrereleaseLatest)
+	h.writeReleaseUpdate(w, "unyank", item, err)
+}
+
+func (h IntegrationsHandler) Deprecate(w http.ResponseWriter, r *http.Request) {
+	id, version, ok := h.authorizeReleaseOwner(w, r)
+	if !ok {
+		return
+	}
+	var req models.DeprecateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	item, err := store.DeprecateRelease(r.Context(), h.DB, id, version, strings.TrimSpace(req.Message))
+	h.writeReleaseUpdate(w, "deprecate", item, err)
+}
+
+func (h IntegrationsHandler) Undeprecate(w http.ResponseWriter, r *http.Request) {
+	id, version, ok := h.authorizeReleaseOwner(w, r)
+	if !ok {
+		return
+	}
+	item, err := store.UndeprecateRelease(r.Context(), h.DB, id, version)
+	h.writeReleaseUpdate(w, "undeprecate", item, err)
+}
+
+// authorizeReleaseOwner checks that the bearer OIDC token was issued to the
+// repository that owns the integration.
+func (h IntegrationsHandler) authorizeReleaseOwner(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	id := chi.URLParam(r, "id")
+	version := chi.URLParam(r, "version")
+	if id == "" || version == "" {
+		writeError(w, http.StatusBadRequest, "missing id or version")
+		return "", "", false
+	}
+	repo, ok := h.oidcRepository(w, r)
+	if !ok {
+		return "", "", false
+	}
+	item, err := store.GetIntegration(r.Context(), h.DB, id, version)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "integration not found")
+		return "", "", false
+	}
+	owner := store.NormalizeRepository(item.RepoURL)
+	if ownership, err := store.GetOwnership(r.Context(), h.DB, id); err == nil {
+		owner = ownership.Repository
+	}
+	if owner == "" || owner != store.NormalizeRepository(repo) {
+		log.Printf("release update forbidden id=%q version=%q repo=%q owner=%q", id, version, repo, owner)
+		writeError(w, http.StatusForbidden, "oidc repository does not own this release")
+		return "", "", false
+	}
+	return id, version, true
+}
+
+// oidcRepository verifies and consumes the bearer OIDC token, so it cannot
+// be replayed, and returns the URL of the repository it was issued to.
+func (h IntegrationsHandler) oidcRepository(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.OIDCVerifier == nil {
+		writeError(w, http.StatusServiceUnavailable, "oidc verifier not configured")
+		return "", false
+	}
+	token, err := bearerToken(r)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return "", false
+	}
+	claims, err := h.OIDCVerifier.Verify(r.Context(), token)
+	if err != nil {
+		log.Printf("oidc invalid token: %v", err)
+		writeError(w, http.StatusUnauthorized, "invalid oidc token")
+		return "", false
+	}
+	if strings.TrimSpace(claims.Repository) == "" {
+		writeError(w, http.StatusUnauthorized, "oidc repository claim missing")
+		return "", false
+	}
+	tokenID := oidcTokenID(claims, token)
+	if err := h.consumeOIDCToken(r.Context(), claims, tokenID); err != nil {
+		log.Printf("oidc token rejected token_id=%q: %v", tokenID, err)
+		writeReplayError(w, err)
+		return "", false
+	}
+	return claims.RepoURL(), true
+}
+
+func (h IntegrationsHandler) writeReleaseUpdate(w http.ResponseWriter, action string, item *models.Integration, err error) {
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "integration not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to "+action+" release")
+		return
+	}
+	log.Printf("release %s id=%q version=%q latest=%t", action, item.ID, item.Version, item.Latest)
+	writeJSON(w, http.StatusOK, item)
+}
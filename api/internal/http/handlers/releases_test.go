@@ -0,0 +1,52 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/config"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/http/handlers"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/http/server"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestYankRequiresOwningRepository(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	req := testRelease()
+	req.RepoURL = "https://github.com/PetoAdam/homenavi-spotify"
+	if _, err := store.PublishIntegration(context.Background(), pool, req, store.PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	other := server.NewWithVerifier(config.Config{OIDCTagPrefix: "v"}, pool, stubOIDCVerifier{claims: handlers.OIDCClaims{Repository: "someone/else"}})
+	yankReq := httptest.NewRequest(http.MethodPost, "/api/integrations/spotify/versions/v0.1.0/yank", bytes.NewReader([]byte(`{"reason":"broken"}`)))
+	yankReq.Header.Set("Authorization", "Bearer other-token")
+	res := httptest.NewRecorder()
+	other.ServeHTTP(res, yankReq)
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for foreign repository, got %d", res.Code)
+	}
+
+	owner := server.NewWithVerifier(config.Config{OIDCTagPrefix: "v"}, pool, stubOIDCVerifier{claims: handlers.OIDCClaims{Repository: "PetoAdam/homenavi-spotify"}})
+	yankReq = httptest.NewRequest(http.MethodPost, "/api/integrations/spotify/versions/v0.1.0/yank", bytes.NewReader([]byte(`{"reason":"broken"}`)))
+	yankReq.Header.Set("Authorization", "Bearer owner-token")
+	res = httptest.NewRecorder()
+	owner.ServeHTTP(res, yankReq)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected 200 for owning repository, got %d", res.Code)
+	}
+
+	unyankReq := httptest.NewRequest(http.MethodPost, "/api/integrations/spotify/versions/v0.1.0/unyank", nil)
+	unyankReq.Header.Set("Authorization", "Bearer owner-token")
+	res = httptest.NewRecorder()
+	owner.ServeHTTP(res, unyankReq)
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a replayed token, got %d", res.Code)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxBulkResolve = 200
+
+func (h IntegrationsHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "missing id")
+		return
+	}
+	constraint, err := semver.ParseConstraint(r.URL.Query().Get("constraint"), h.OIDCTagPrefix)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	includePrerelease, _ := strconv.ParseBool(r.URL.Query().Get("include_prerelease"))
+	item, err := store.ResolveIntegration(r.Context(), h.DB, id, constraint, store.ResolveOptions{
+		TagPrefix:         h.OIDCTagPrefix,
+		IncludePrerelease: includePrerelease,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrNoMatchingVersion) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to resolve version")
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+func (h IntegrationsHandler) ResolveBulk(w http.ResponseWriter, r *http.Request) {
+	var req models.BulkResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if len(req.Integrations) == 0 {
+		writeError(w, http.StatusBadRequest, "integrations must not be empty")
+		return
+	}
+	if len(req.Integrations) > maxBulkResolve {
+		writeError(w, http.StatusBadRequest, "integrations must be <= "+strconv.Itoa(maxBulkResolve)+" items")
+		return
+	}
+
+	results := make([]models.ResolveResult, len(req.Integrations))
+	lookups := make([]store.ResolveRequest, 0, len(req.Integrations))
+	lookupIndex := make([]int, 0, len(req.Integrations))
+	for i, item := range req.Integrations {
+		results[i] = models.ResolveResult{ID: strings.TrimSpace(item.ID), Constraint: item.Constraint}
+		if results[i].ID == "" {
+			results[i].Error = "missing id"
+			continue
+		}
+		constraint, err := semver.ParseConstraint(item.Constraint, h.OIDCTagPrefix)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		lookups = append(lookups, store.ResolveRequest{ID: results[i].ID, Constraint: constraint})
+		lookupIndex = append(lookupIndex, i)
+	}
+
+	resolved, err := store.ResolveIntegrations(r.Context(), h.DB, lookups, store.ResolveOptions{
+		TagPrefix:         h.OIDCTagPrefix,
+		IncludePrerelease: req.IncludePrerelease,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to resolve versions")
+		return
+	}
+	for j, res := range resolved {
+		i := lookupIndex[j]
+		if res.Err != nil {
+			results[i].Error = res.Err.Error()
+			continue
+		}
+		results[i].Integration = res.Integration
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"results": results})
+}
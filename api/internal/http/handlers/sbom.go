@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/oci"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/sbom"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// SBOM returns the stored SBOM document of the latest or requested release.
+func (h IntegrationsHandler) SBOM(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	item, err := store.GetIntegration(r.Context(), h.DB, id, r.URL.Query().Get("version"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "integration not found")
+		return
+	}
+	doc, err := store.GetSBOM(r.Context(), h.DB, item.ID, item.Version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "no sbom for this release")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to load sbom")
+		return
+	}
+	contentType := "application/spdx+json"
+	if doc.Format == sbom.FormatCycloneDX {
+		contentType = "application/vnd.cyclonedx+json"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(doc.Document)
+}
+
+// sbomSummary loads the release's SBOM summary with current advisories.
+// Failures only drop the section, they never fail the request.
+func (h IntegrationsHandler) sbomSummary(ctx context.Context, id, version string) *models.SBOMSummary {
+	doc, err := store.GetSBOM(ctx, h.DB, id, version)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("sbom load failed id=%q version=%q: %v", id, version, err)
+		}
+		return nil
+	}
+	summary := doc.Summary
+	if h.VulnDB != nil {
+		summary.Vulnerabilities = h.VulnDB.Match(summary.Components)
+	}
+	return &summary
+}
+
+// resolveSBOM parses the submitted SBOM or, when the image digest is known,
+// fetches one attached to the image. A release without an SBOM is allowed.
+func (h IntegrationsHandler) resolveSBOM(ctx context.Context, req models.PublishRequest, digest string) (*sbom.Document, error) {
+	if len(req.SBOM) > 0 {
+		doc, err := sbom.Parse(req.SBOM)
+		if err != nil {
+			return nil, errField("sbom: " + err.Error())
+		}
+		return doc, nil
+	}
+	if digest == "" {
+		return nil, nil
+	}
+	image, err := oci.ParseImage(req.Image)
+	if err != nil {
+		return nil, nil
+	}
+	doc, err := sbom.FetchAttached(ctx, h.registry(), image, digest)
+	if err != nil {
+		if !errors.Is(err, sbom.ErrNotFound) {
+			log.Printf("attached sbom fetch failed image=%q: %v", req.Image, err)
+		}
+		return nil, nil
+	}
+	return doc, nil
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+// Stats returns the download series of one integration, per version.
+func (h IntegrationsHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	opts, err := statsOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	stats, err := store.IntegrationStats(r.Context(), h.DB, chi.URLParam(r, "id"), opts)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "integration not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to load stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// MarketplaceStats returns the download series across all integrations.
+func (h IntegrationsHandler) MarketplaceStats(w http.ResponseWriter, r *http.Request) {
+	opts, err := statsOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	stats, err := store.MarketplaceStats(r.Context(), h.DB, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load stats")
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func statsOptionsFromQuery(values url.Values) (store.StatsOptions, error) {
+	opts := store.StatsOptions{Interval: strings.ToLower(strings.TrimSpace(values.Get("interval")))}
+	if opts.Interval != "" && opts.Interval != store.IntervalDay && opts.Interval != store.IntervalWeek {
+		return opts, store.ErrInvalidInterval
+	}
+	if raw := strings.TrimSpace(values.Get("days")); raw != "" {
+		days, err := strconv.Atoi(raw)
+		if err != nil || days <= 0 {
+			return opts, errors.New("days must be a positive integer")
+		}
+		opts.Days = days
+	}
+	return opts, nil
+}
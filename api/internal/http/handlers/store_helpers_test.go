@@ -0,0 +1,17 @@
+package handlers_test
+
+import "github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+
+// testRelease is the smallest release of the spotify integration that can be
+// stored directly, bypassing publish validation.
+func testRelease() models.PublishRequest {
+	return models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/store"
+)
+
+const maxUpdateCheck = 500
+
+func (h IntegrationsHandler) CheckUpdates(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json")
+		return
+	}
+	if len(req.Installed) > maxUpdateCheck {
+		writeError(w, http.StatusBadRequest, "installed must be <= "+strconv.Itoa(maxUpdateCheck)+" items")
+		return
+	}
+	for i := range req.Installed {
+		req.Installed[i].ID = strings.TrimSpace(req.Installed[i].ID)
+		req.Installed[i].Version = strings.TrimSpace(req.Installed[i].Version)
+		if req.Installed[i].ID == "" || req.Installed[i].Version == "" {
+			writeError(w, http.StatusBadRequest, "installed entries require id and version")
+			return
+		}
+	}
+
+	updates, err := store.CheckUpdates(r.Context(), h.DB, req.Installed, h.OIDCTagPrefix)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to check updates")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"updates": updates})
+}
@@ -14,7 +14,7 @@ func testComposeYAML() string {
 
 func newComposeServer(t *testing.T, composeYAML string) string {
 	t.Helper()
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/compose/docker-compose.integration.yml" {
 			w.WriteHeader(http.StatusNotFound)
 			return
@@ -26,6 +26,14 @@ func newComposeServer(t *testing.T, composeYAML string) string {
 	return server.URL + "/compose/docker-compose.integration.yml"
 }
 
+// testHTTPClient trusts the certificate all httptest TLS servers share, so it
+// can stand in for the public-only client against local test servers.
+func testHTTPClient(t *testing.T) *http.Client {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+	return server.Client()
+}
+
 func testPublishRequest(t *testing.T) models.PublishRequest {
 	composeURL := newComposeServer(t, testComposeYAML())
 	req := models.PublishRequest{
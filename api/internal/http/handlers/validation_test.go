@@ -1,15 +1,21 @@
 package handlers
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/compose"
+)
 
 func TestValidatePublishRequest(t *testing.T) {
 	req := testPublishRequest(t)
-	if err := validatePublishRequest(req); err != nil {
+	if err := validatePublishRequest(req, compose.DefaultPolicy(), testHTTPClient(t)); err != nil {
 		t.Fatalf("expected valid request, got %v", err)
 	}
 
 	req.ID = ""
-	if err := validatePublishRequest(req); err == nil {
+	if err := validatePublishRequest(req, compose.DefaultPolicy(), testHTTPClient(t)); err == nil {
 		t.Fatalf("expected validation error for empty id")
 	}
 }
@@ -18,7 +24,7 @@ func TestValidatePublishRequestRejectsDevCompose(t *testing.T) {
 	req := testPublishRequest(t)
 	req.ComposeFile = newComposeServer(t, "services:\n  spotify:\n    image: ghcr.io/petoadam/homenavi-spotify:latest\n    volumes:\n      - ${HOMENAVI_ROOT}/integrations/secrets/spotify.secrets.json:/app/config/integration.secrets.json\n")
 	req.Deployment.Compose.File = req.ComposeFile
-	if err := validatePublishRequest(req); err == nil {
+	if err := validatePublishRequest(req, compose.DefaultPolicy(), testHTTPClient(t)); err == nil {
 		t.Fatalf("expected validation error for dev compose")
 	}
 }
@@ -27,7 +33,34 @@ func TestValidatePublishRequestRequiresImagePerService(t *testing.T) {
 	req := testPublishRequest(t)
 	req.ComposeFile = newComposeServer(t, "services:\n  spotify:\n    volumes:\n      - ${INTEGRATIONS_ROOT}/integrations/secrets/spotify.secrets.json:/app/config/integration.secrets.json\n")
 	req.Deployment.Compose.File = req.ComposeFile
-	if err := validatePublishRequest(req); err == nil {
+	if err := validatePublishRequest(req, compose.DefaultPolicy(), testHTTPClient(t)); err == nil {
 		t.Fatalf("expected validation error for missing image")
 	}
 }
+
+func TestValidatePublishRequestReportsEveryComposeViolation(t *testing.T) {
+	req := testPublishRequest(t)
+	req.ComposeFile = newComposeServer(t, "services:\n  spotify:\n    image: ghcr.io/petoadam/homenavi-spotify:latest\n    privileged: true\n    network_mode: host\n    volumes:\n      - ${INTEGRATIONS_ROOT}/integrations/spotify:/data\n      - /etc:/host-etc:ro\n")
+	req.Deployment.Compose.File = req.ComposeFile
+	err := validatePublishRequest(req, compose.DefaultPolicy(), testHTTPClient(t))
+	var policyErr *compose.PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected policy error, got %v", err)
+	}
+	if len(policyErr.Violations) != 3 {
+		t.Fatalf("expected 3 violations, got %+v", policyErr.Violations)
+	}
+}
+
+func TestValidatePublishRequestRefusesPrivateCompose(t *testing.T) {
+	req := testPublishRequest(t)
+	if err := validatePublishRequest(req, compose.DefaultPolicy(), publishHTTPClient); err == nil || !strings.Contains(err.Error(), "public address") {
+		t.Fatalf("expected loopback compose_file to be refused, got %v", err)
+	}
+
+	req.ComposeFile = strings.Replace(req.ComposeFile, "https://", "http://", 1)
+	req.Deployment.Compose.File = req.ComposeFile
+	if err := validatePublishRequest(req, compose.DefaultPolicy(), testHTTPClient(t)); err == nil || !strings.Contains(err.Error(), "https") {
+		t.Fatalf("expected http compose_file to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+type adminActorKey struct{}
+
+// adminActorPattern is what the part of an entry before its first ":" must
+// look like to be read as an actor name.
+var adminActorPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._@-]{0,63}$`)
+
+// AdminAuth authenticates requests by the X-Marketplace-Token header. Tokens
+// are configured as "actor:token" pairs; a bare token is logged as "admin".
+type AdminAuth struct {
+	tokens map[[sha256.Size]byte]string
+}
+
+// NewAdminAuth reads entries as "actor:token" only when the text before the
+// first ":" is a valid actor name; anything else, including a token that
+// merely contains ":", is a bare token.
+func NewAdminAuth(entries []string) AdminAuth {
+	auth := AdminAuth{tokens: map[[sha256.Size]byte]string{}}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		actor, token := "admin", entry
+		if name, rest, found := strings.Cut(entry, ":"); found && adminActorPattern.MatchString(name) {
+			actor, token = name, rest
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		auth.tokens[sha256.Sum256([]byte(token))] = actor
+	}
+	return auth
+}
+
+func (a AdminAuth) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(a.tokens) == 0 {
+			writeAuthError(w, http.StatusServiceUnavailable, "admin api not configured")
+			return
+		}
+		token := strings.TrimSpace(r.Header.Get("X-Marketplace-Token"))
+		if token == "" {
+			writeAuthError(w, http.StatusUnauthorized, "missing admin token")
+			return
+		}
+		actor, ok := a.lookup(token)
+		if !ok {
+			writeAuthError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminActorKey{}, actor)))
+	})
+}
+
+// lookup compares token hashes in constant time so response timing does not
+// reveal how much of a token matched.
+func (a AdminAuth) lookup(token string) (string, bool) {
+	sum := sha256.Sum256([]byte(token))
+	actor, found := "", false
+	for known, name := range a.tokens {
+		if subtle.ConstantTimeCompare(known[:], sum[:]) == 1 {
+			actor, found = name, true
+		}
+	}
+	return actor, found
+}
+
+func AdminActor(ctx context.Context) string {
+	actor, _ := ctx.Value(adminActorKey{}).(string)
+	return actor
+}
+
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuth(t *testing.T) {
+	var actor string
+	handler := NewAdminAuth([]string{"alice:secret-a", "secret-b", "bob:se:cr:et", "9f:2a:c4"}).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor = AdminActor(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		token string
+		code  int
+		actor string
+	}{
+		{"", http.StatusUnauthorized, ""},
+		{"wrong", http.StatusUnauthorized, ""},
+		{"secret-a", http.StatusOK, "alice"},
+		{"secret-b", http.StatusOK, "admin"},
+		{"se:cr:et", http.StatusOK, "bob"},
+		{"9f:2a:c4", http.StatusOK, "admin"},
+		{"2a:c4", http.StatusUnauthorized, ""},
+	}
+	for _, tc := range cases {
+		actor = ""
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/audit", nil)
+		if tc.token != "" {
+			req.Header.Set("X-Marketplace-Token", tc.token)
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		if res.Code != tc.code || actor != tc.actor {
+			t.Fatalf("token %q: expected %d/%q, got %d/%q", tc.token, tc.code, tc.actor, res.Code, actor)
+		}
+	}
+}
+
+func TestAdminAuthUnconfigured(t *testing.T) {
+	handler := NewAdminAuth(nil).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/audit", nil)
+	req.Header.Set("X-Marketplace-Token", "anything")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", res.Code)
+	}
+}
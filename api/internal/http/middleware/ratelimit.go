@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit allows each client PerMinute requests a minute with bursts of
+// the same size, answering 429 once the budget is spent. Clients are keyed
+// by ClientIP.
+type RateLimit struct {
+	PerMinute         int
+	TrustProxyHeaders bool
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	seen   time.Time
+}
+
+func NewRateLimit(perMinute int, trustProxyHeaders bool) *RateLimit {
+	return &RateLimit{PerMinute: perMinute, TrustProxyHeaders: trustProxyHeaders, buckets: map[string]*bucket{}}
+}
+
+func (l *RateLimit) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.PerMinute <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if wait, ok := l.allow(ClientIP(r, l.TrustProxyHeaders), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeAuthError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow takes a token from key's bucket, or reports how long until one is
+// available.
+func (l *RateLimit) allow(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rate := float64(l.PerMinute) / float64(time.Minute)
+	capacity := float64(l.PerMinute)
+
+	// Buckets idle long enough to have refilled are dropped.
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.seen) > time.Minute {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, seen: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(capacity, b.tokens+float64(now.Sub(b.seen))*rate)
+	b.seen = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// ClientIP returns the address of the client. With trustProxyHeaders it
+// takes the last X-Forwarded-For entry, the one appended by the reverse proxy
+// in front of the API; only enable it behind exactly one such proxy.
+func ClientIP(r *http.Request, trustProxyHeaders bool) string {
+	if trustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	limit := NewRateLimit(2, false)
+	handler := limit.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/integrations/spotify/downloads", nil)
+		req.RemoteAddr = remote
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+	for i := 0; i < 2; i++ {
+		if res := send("10.0.0.1:1234"); res.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, res.Code)
+		}
+	}
+	res := send("10.0.0.1:5678")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", res.Code, res.Header())
+	}
+	if res := send("10.0.0.2:1234"); res.Code != http.StatusOK {
+		t.Fatalf("expected other clients to be unaffected, got %d", res.Code)
+	}
+
+	// Tokens refill at PerMinute per minute.
+	if _, ok := limit.allow("10.0.0.1", time.Now().Add(31*time.Second)); !ok {
+		t.Fatalf("expected a token after refill")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:4000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+	if got := ClientIP(req, false); got != "192.0.2.1" {
+		t.Fatalf("expected remote address, got %q", got)
+	}
+	if got := ClientIP(req, true); got != "198.51.100.7" {
+		t.Fatalf("expected proxy-appended address, got %q", got)
+	}
+}
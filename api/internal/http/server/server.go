@@ -11,7 +11,7 @@ import (
 )
 
 func New(cfg config.Config, db *gorm.DB) http.Handler {
-	verifier := handlers.NewGitHubOIDCVerifier(cfg)
+	verifier := handlers.NewOIDCRegistryFromConfig(cfg)
 	return NewWithVerifier(cfg, db, verifier)
 }
 
@@ -21,19 +21,71 @@ func NewWithVerifier(cfg config.Config, db *gorm.DB, verifier handlers.OIDCVerif
 	r.Use(middleware.Logging)
 	r.Use(middleware.CORS{AllowedOrigins: cfg.AllowedOrigin}.Handler)
 
-	h := handlers.IntegrationsHandler{DB: db, OIDCVerifier: verifier, OIDCTagPrefix: cfg.OIDCTagPrefix}
+	h := handlers.IntegrationsHandler{
+		DB:               db,
+		OIDCVerifier:     verifier,
+		OIDCTagPrefix:    cfg.OIDCTagPrefix,
+		PrereleaseLatest: cfg.PrereleaseLatest,
+		ComposePolicy:    cfg.ComposePolicy,
+		PublishHTTP:      cfg.PublishHTTP,
+		VerifyImages:     cfg.VerifyImages,
+		Cosign:           cfg.Cosign,
+		SignatureMode:    cfg.CosignMode,
+		ProvenanceMode:   cfg.ProvenanceMode,
+		VulnDB:           cfg.VulnDB,
+
+		DownloadHashKey:       []byte(cfg.DownloadHashSecret),
+		DownloadDedupWindow:   cfg.DownloadDedupWindow,
+		DownloadInstallsPerIP: cfg.DownloadInstallsPerIP,
+		TrustProxyHeaders:     cfg.TrustProxyHeaders,
+	}
+	downloadLimit := middleware.NewRateLimit(cfg.DownloadRateLimit, cfg.TrustProxyHeaders)
 
 	r.Get("/api/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	r.Get("/api/health/oidc", h.OIDCStatus)
+	r.Get("/api/stats", h.MarketplaceStats)
 
 	r.Route("/api/integrations", func(r chi.Router) {
 		r.Get("/", h.List)
+		r.Post("/publish", h.Publish)
 		r.Post("/publish-oidc", h.PublishOIDC)
+		r.Post("/resolve", h.ResolveBulk)
+		r.Post("/updates", h.CheckUpdates)
 		r.Get("/{id}", h.Get)
+		r.Get("/{id}/resolve", h.Resolve)
 		r.Get("/{id}/versions", h.Versions)
-		r.Post("/{id}/downloads", h.IncrementDownloads)
+		r.Get("/{id}/sbom", h.SBOM)
+		r.Get("/{id}/stats", h.Stats)
+		r.Get("/{id}/owner", h.Owner)
+		r.Post("/{id}/owner/transfer", h.RequestTransfer)
+		r.Delete("/{id}/owner/transfer", h.CancelTransfer)
+		r.Post("/{id}/owner/transfer/accept", h.AcceptTransfer)
+		r.Post("/{id}/versions/{version}/yank", h.Yank)
+		r.Post("/{id}/versions/{version}/unyank", h.Unyank)
+		r.Post("/{id}/versions/{version}/deprecate", h.Deprecate)
+		r.Post("/{id}/versions/{version}/undeprecate", h.Undeprecate)
+		r.With(downloadLimit.Handler).Post("/{id}/downloads", h.IncrementDownloads)
+	})
+
+	admin := handlers.AdminHandler{DB: db, PrereleaseLatest: cfg.PrereleaseLatest}
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(middleware.NewAdminAuth(cfg.AdminTokens).Handler)
+		r.Get("/audit", admin.Audit)
+		r.Get("/publish-events", admin.PublishEvents)
+		r.Get("/publish-events/unauthenticated", admin.UnauthenticatedPublishAttempts)
+		r.Post("/integrations/{id}/featured", admin.SetFeatured)
+		r.Post("/integrations/{id}/reassign", admin.Reassign)
+		r.Post("/integrations/{id}/owner", admin.SetOwner)
+		r.Post("/integrations/{id}/versions/{version}/verified", admin.SetVerified)
+		r.Post("/integrations/{id}/versions/{version}/yank", admin.Yank)
+		r.Post("/integrations/{id}/versions/{version}/unyank", admin.Unyank)
+		r.Delete("/integrations/{id}/versions/{version}", admin.DeleteRelease)
+		r.Post("/publishers/{publisher}/keys", admin.CreateAPIKey)
+		r.Get("/publishers/{publisher}/keys", admin.ListAPIKeys)
+		r.Delete("/keys/{keyID}", admin.RevokeAPIKey)
 	})
 
 	return r
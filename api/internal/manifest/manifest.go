@@ -0,0 +1,114 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/netguard"
+)
+
+// CurrentSchemaVersion is assumed for manifests without schema_version.
+const CurrentSchemaVersion = 1
+
+const maxManifestSize = 256 * 1024
+
+var (
+	ErrFetch    = errors.New("failed to fetch manifest_url")
+	ErrMismatch = errors.New("manifest does not match manifest_url")
+)
+
+// ValidationError lists every schema violation of a manifest.
+type ValidationError struct {
+	SchemaVersion int
+	Problems      []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("manifest does not match schema v%d: %s", e.SchemaVersion, strings.Join(e.Problems, "; "))
+}
+
+var defaultClient = netguard.NewClient(6 * time.Second)
+
+// Fetch downloads and decodes the manifest at url, which must be https. A nil
+// client means one that only connects to public addresses.
+func Fetch(ctx context.Context, client *http.Client, url string) (map[string]any, error) {
+	if err := netguard.CheckURL(url); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFetch, err)
+	}
+	if client == nil {
+		client = defaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, ErrFetch
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "homenavi-marketplace")
+	resp, err := client.Do(req)
+	if err != nil {
+		for _, reason := range []error{netguard.ErrNotPublic, netguard.ErrInsecureURL} {
+			if errors.Is(err, reason) {
+				return nil, fmt.Errorf("%w: %v", ErrFetch, reason)
+			}
+		}
+		return nil, ErrFetch
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%w: %s", ErrFetch, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, ErrFetch
+	}
+	if len(body) > maxManifestSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrFetch, maxManifestSize)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(body, &out); err != nil || out == nil {
+		return nil, fmt.Errorf("%w: not a json object", ErrFetch)
+	}
+	return out, nil
+}
+
+// Equal reports whether two decoded manifests hold the same JSON value.
+func Equal(a, b map[string]any) bool {
+	left, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	right, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(left, right)
+}
+
+// Validate checks m against the schema named by its schema_version.
+func Validate(m map[string]any) error {
+	version := CurrentSchemaVersion
+	if raw, ok := m["schema_version"]; ok {
+		n, isNumber := raw.(float64)
+		if !isNumber || n < 1 || n != float64(int(n)) {
+			return &ValidationError{SchemaVersion: version, Problems: []string{"/schema_version: must be a positive integer"}}
+		}
+		version = int(n)
+	}
+	s, err := loadSchema(version)
+	if err != nil {
+		return &ValidationError{SchemaVersion: version, Problems: []string{err.Error()}}
+	}
+	problems := []string{}
+	s.validate("", m, &problems)
+	if len(problems) > 0 {
+		return &ValidationError{SchemaVersion: version, Problems: problems}
+	}
+	return nil
+}
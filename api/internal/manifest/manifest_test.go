@@ -0,0 +1,81 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := map[string]any{
+		"schema_version": float64(1),
+		"id":             "spotify",
+		"name":           "Spotify",
+		"version":        "0.1.0",
+		"tags":           []any{"media"},
+		"extra":          map[string]any{"kept": true},
+	}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("expected valid manifest, got %v", err)
+	}
+
+	err := Validate(map[string]any{"id": "Spotify!", "tags": []any{"media", float64(3)}})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	joined := strings.Join(verr.Problems, "\n")
+	for _, want := range []string{`/: missing required property "name"`, `/: missing required property "version"`, "/id: must match", "/tags/1: must be string"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected problem %q in:\n%s", want, joined)
+		}
+	}
+
+	if err := Validate(map[string]any{"schema_version": float64(99), "id": "x", "name": "X", "version": "1.0.0"}); !errors.As(err, &verr) || !strings.Contains(err.Error(), "unsupported schema_version 99") {
+		t.Fatalf("expected unsupported schema version, got %v", err)
+	}
+}
+
+func TestFetchAndEqual(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.json":
+			_, _ = w.Write([]byte(`{"id":"spotify","name":"Spotify","version":"0.1.0","tags":["media"]}`))
+		case "/list.json":
+			_, _ = w.Write([]byte(`["spotify"]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	fetched, err := Fetch(context.Background(), srv.Client(), srv.URL+"/manifest.json")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	submitted := map[string]any{"tags": []any{"media"}, "version": "0.1.0", "name": "Spotify", "id": "spotify"}
+	if !Equal(submitted, fetched) {
+		t.Fatalf("expected key order to be ignored")
+	}
+	submitted["name"] = "Not Spotify"
+	if Equal(submitted, fetched) {
+		t.Fatalf("expected changed manifest to differ")
+	}
+
+	for _, path := range []string{"/missing.json", "/list.json"} {
+		if _, err := Fetch(context.Background(), srv.Client(), srv.URL+path); !errors.Is(err, ErrFetch) {
+			t.Fatalf("expected ErrFetch for %s, got %v", path, err)
+		}
+	}
+
+	insecure := strings.Replace(srv.URL, "https://", "http://", 1) + "/manifest.json"
+	if _, err := Fetch(context.Background(), srv.Client(), insecure); !errors.Is(err, ErrFetch) || !strings.Contains(err.Error(), "https") {
+		t.Fatalf("expected http manifest_url to be refused, got %v", err)
+	}
+	if _, err := Fetch(context.Background(), nil, srv.URL+"/manifest.json"); !errors.Is(err, ErrFetch) || !strings.Contains(err.Error(), "not public") {
+		t.Fatalf("expected loopback manifest_url to be refused, got %v", err)
+	}
+}
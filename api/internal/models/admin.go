@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type AuditEvent struct {
+	ID            uint           `json:"id"`
+	Actor         string         `json:"actor"`
+	Action        string         `json:"action"`
+	IntegrationID string         `json:"integration_id,omitempty"`
+	Version       string         `json:"version,omitempty"`
+	Details       map[string]any `json:"details,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+type FeaturedRequest struct {
+	Featured bool `json:"featured"`
+}
+
+type VerifiedRequest struct {
+	Verified bool `json:"verified"`
+}
+
+type ReassignRequest struct {
+	NewID string `json:"new_id"`
+}
+
+type APIKey struct {
+	ID         uint       `json:"id"`
+	Publisher  string     `json:"publisher"`
+	Prefix     string     `json:"prefix"`
+	Key        string     `json:"key,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
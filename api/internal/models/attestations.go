@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Attestations is the supply-chain evidence verified when a release was
+// published. Sections are omitted when nothing was verified.
+type Attestations struct {
+	Signature  *SignatureAttestation  `json:"signature,omitempty"`
+	Provenance *ProvenanceAttestation `json:"provenance,omitempty"`
+}
+
+type SignatureAttestation struct {
+	Issuer           string    `json:"issuer"`
+	Identity         string    `json:"identity"`
+	SourceRepository string    `json:"source_repository,omitempty"`
+	SourceRef        string    `json:"source_ref,omitempty"`
+	SourceDigest     string    `json:"source_digest,omitempty"`
+	LogIndex         int64     `json:"log_index"`
+	SignedAt         time.Time `json:"signed_at"`
+}
+
+type ProvenanceAttestation struct {
+	PredicateType    string    `json:"predicate_type"`
+	BuilderID        string    `json:"builder_id,omitempty"`
+	SourceRepository string    `json:"source_repository,omitempty"`
+	Identity         string    `json:"identity"`
+	LogIndex         int64     `json:"log_index"`
+	SignedAt         time.Time `json:"signed_at"`
+}
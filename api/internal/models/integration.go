@@ -1,30 +1,43 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Integration struct {
-	ID          string              `json:"id"`
-	Name        string              `json:"name"`
-	Version     string              `json:"version"`
-	Description string              `json:"description"`
-	ManifestURL string              `json:"manifest_url"`
-	Manifest    map[string]any      `json:"manifest,omitempty"`
-	Image       string              `json:"image"`
-	Images      []string            `json:"images"`
-	Assets      map[string]string   `json:"assets"`
-	ListenPath  string              `json:"listen_path"`
-	ComposeFile string              `json:"compose_file"`
-	Deployment  DeploymentArtifacts `json:"deployment_artifacts"`
-	RepoURL     string              `json:"repo_url,omitempty"`
-	ReleaseTag  string              `json:"release_tag,omitempty"`
-	Publisher   string              `json:"publisher,omitempty"`
-	Verified    bool                `json:"verified"`
-	Latest      bool                `json:"latest"`
-	Downloads   int64               `json:"downloads"`
-	Trending    float64             `json:"trending_score"`
-	Featured    bool                `json:"featured"`
-	CreatedAt   time.Time           `json:"created_at"`
-	UpdatedAt   time.Time           `json:"updated_at"`
+	ID                 string              `json:"id"`
+	Name               string              `json:"name"`
+	Version            string              `json:"version"`
+	Description        string              `json:"description"`
+	ManifestURL        string              `json:"manifest_url"`
+	Manifest           map[string]any      `json:"manifest,omitempty"`
+	Image              string              `json:"image"`
+	ImageDigest        string              `json:"image_digest,omitempty"`
+	Images             []string            `json:"images"`
+	Assets             map[string]string   `json:"assets"`
+	ListenPath         string              `json:"listen_path"`
+	ComposeFile        string              `json:"compose_file"`
+	Deployment         DeploymentArtifacts `json:"deployment_artifacts"`
+	Attestations       Attestations        `json:"attestations"`
+	SBOM               *SBOMSummary        `json:"sbom,omitempty"`
+	RepoURL            string              `json:"repo_url,omitempty"`
+	ReleaseTag         string              `json:"release_tag,omitempty"`
+	Publisher          string              `json:"publisher,omitempty"`
+	Verified           bool                `json:"verified"`
+	Latest             bool                `json:"latest"`
+	Prerelease         bool                `json:"prerelease"`
+	Yanked             bool                `json:"yanked"`
+	YankReason         string              `json:"yank_reason,omitempty"`
+	YankedAt           *time.Time          `json:"yanked_at,omitempty"`
+	Deprecated         bool                `json:"deprecated"`
+	DeprecationMessage string              `json:"deprecation_message,omitempty"`
+	Downloads          int64               `json:"downloads"`
+	VersionDownloads   int64               `json:"version_downloads"`
+	Trending           float64             `json:"trending_score"`
+	Featured           bool                `json:"featured"`
+	CreatedAt          time.Time           `json:"created_at"`
+	UpdatedAt          time.Time           `json:"updated_at"`
 }
 
 type PublishRequest struct {
@@ -43,6 +56,8 @@ type PublishRequest struct {
 	RepoURL     string              `json:"repo_url"`
 	ReleaseTag  string              `json:"release_tag"`
 	Publisher   string              `json:"publisher"`
+	// SBOM is an optional SPDX or CycloneDX JSON document for the release.
+	SBOM json.RawMessage `json:"sbom,omitempty"`
 }
 
 type DeploymentArtifacts struct {
@@ -59,3 +74,11 @@ type DeploymentArtifacts struct {
 		Version  string `json:"version,omitempty"`
 	} `json:"k8s_generated,omitempty"`
 }
+
+type YankRequest struct {
+	Reason string `json:"reason"`
+}
+
+type DeprecateRequest struct {
+	Message string `json:"message"`
+}
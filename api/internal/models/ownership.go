@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type Ownership struct {
+	ID              string             `json:"id"`
+	Repository      string             `json:"repository"`
+	Publisher       string             `json:"publisher,omitempty"`
+	PendingTransfer *OwnershipTransfer `json:"pending_transfer"`
+}
+
+type OwnershipTransfer struct {
+	ID             uint       `json:"id"`
+	IntegrationID  string     `json:"integration_id"`
+	FromRepository string     `json:"from_repository"`
+	ToRepository   string     `json:"to_repository"`
+	CreatedAt      time.Time  `json:"created_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty"`
+}
+
+type TransferRequest struct {
+	ToRepository string `json:"to_repository"`
+}
+
+type OwnerRequest struct {
+	Repository string `json:"repository"`
+}
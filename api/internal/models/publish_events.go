@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// PublishEvent records one publish attempt and its outcome.
+type PublishEvent struct {
+	ID            uint           `json:"id"`
+	Endpoint      string         `json:"endpoint"`
+	Outcome       string         `json:"outcome"`
+	Status        int            `json:"status"`
+	Error         string         `json:"error,omitempty"`
+	IntegrationID string         `json:"integration_id,omitempty"`
+	Version       string         `json:"version,omitempty"`
+	Publisher     string         `json:"publisher,omitempty"`
+	Issuer        string         `json:"issuer,omitempty"`
+	Subject       string         `json:"subject,omitempty"`
+	Repository    string         `json:"repository,omitempty"`
+	Actor         string         `json:"actor,omitempty"`
+	RunID         int64          `json:"run_id,omitempty"`
+	RunAttempt    int64          `json:"run_attempt,omitempty"`
+	TokenID       string         `json:"token_id,omitempty"`
+	Claims        map[string]any `json:"claims,omitempty"`
+	Request       map[string]any `json:"request,omitempty"`
+	Response      map[string]any `json:"response,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// UnauthenticatedPublishAttempts counts publish attempts of one UTC day that
+// were rejected before a credential verified.
+type UnauthenticatedPublishAttempts struct {
+	Endpoint string    `json:"endpoint"`
+	Day      time.Time `json:"day"`
+	Status   int       `json:"status"`
+	Attempts int64     `json:"attempts"`
+}
@@ -0,0 +1,18 @@
+package models
+
+type ResolveRequest struct {
+	ID         string `json:"id"`
+	Constraint string `json:"constraint"`
+}
+
+type BulkResolveRequest struct {
+	Integrations      []ResolveRequest `json:"integrations"`
+	IncludePrerelease bool             `json:"include_prerelease"`
+}
+
+type ResolveResult struct {
+	ID          string       `json:"id"`
+	Constraint  string       `json:"constraint"`
+	Integration *Integration `json:"integration"`
+	Error       string       `json:"error,omitempty"`
+}
@@ -0,0 +1,44 @@
+package models
+
+// SBOMSummary condenses a release's SBOM for the integration detail view.
+type SBOMSummary struct {
+	Format          string          `json:"format"`
+	SpecVersion     string          `json:"spec_version,omitempty"`
+	ComponentCount  int             `json:"component_count"`
+	Licenses        []LicenseCount  `json:"licenses"`
+	Components      []SBOMComponent `json:"components"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities,omitempty"`
+}
+
+type LicenseCount struct {
+	License string `json:"license"`
+	Count   int    `json:"count"`
+}
+
+type SBOMComponent struct {
+	Name     string   `json:"name"`
+	Version  string   `json:"version,omitempty"`
+	PURL     string   `json:"purl,omitempty"`
+	Licenses []string `json:"licenses,omitempty"`
+}
+
+// Vulnerability is a known advisory affecting one SBOM component.
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Summary  string   `json:"summary,omitempty"`
+	Severity string   `json:"severity,omitempty"`
+	Package  string   `json:"package"`
+	Version  string   `json:"version"`
+	Fixed    string   `json:"fixed,omitempty"`
+}
+
+// SBOM is the document stored for one release.
+type SBOM struct {
+	IntegrationID string
+	Version       string
+	Format        string
+	SpecVersion   string
+	Document      []byte
+	Summary       SBOMSummary
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// DownloadRequest describes one install reported to the downloads endpoint.
+type DownloadRequest struct {
+	Version string `json:"version"`
+	// Method is compose, helm or k8s.
+	Method string `json:"method"`
+}
+
+type StatsPoint struct {
+	Date      time.Time `json:"date"`
+	Downloads int64     `json:"downloads"`
+}
+
+type VersionStats struct {
+	Version   string       `json:"version"`
+	Downloads int64        `json:"downloads"`
+	Series    []StatsPoint `json:"series"`
+}
+
+// DownloadStats is the download history of one integration between From and
+// To, bucketed by Interval ("day" or "week").
+type DownloadStats struct {
+	ID        string           `json:"id"`
+	Interval  string           `json:"interval"`
+	From      time.Time        `json:"from"`
+	To        time.Time        `json:"to"`
+	Downloads int64            `json:"downloads"`
+	Series    []StatsPoint     `json:"series"`
+	Versions  []VersionStats   `json:"versions"`
+	Methods   map[string]int64 `json:"methods"`
+}
+
+type IntegrationDownloads struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Downloads int64  `json:"downloads"`
+}
+
+// MarketplaceStats summarises downloads across every integration.
+type MarketplaceStats struct {
+	Interval     string                 `json:"interval"`
+	From         time.Time              `json:"from"`
+	To           time.Time              `json:"to"`
+	Integrations int64                  `json:"integrations"`
+	Downloads    int64                  `json:"downloads"`
+	Series       []StatsPoint           `json:"series"`
+	Methods      map[string]int64       `json:"methods"`
+	Top          []IntegrationDownloads `json:"top"`
+}
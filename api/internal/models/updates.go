@@ -0,0 +1,22 @@
+package models
+
+type InstalledIntegration struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+}
+
+type UpdateCheckRequest struct {
+	Installed []InstalledIntegration `json:"installed"`
+}
+
+type UpdateStatus struct {
+	ID                 string `json:"id"`
+	InstalledVersion   string `json:"installed_version"`
+	LatestVersion      string `json:"latest_version,omitempty"`
+	UpdateAvailable    bool   `json:"update_available"`
+	Known              bool   `json:"known"`
+	Yanked             bool   `json:"yanked"`
+	YankReason         string `json:"yank_reason,omitempty"`
+	Deprecated         bool   `json:"deprecated"`
+	DeprecationMessage string `json:"deprecation_message,omitempty"`
+}
@@ -0,0 +1,77 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublic(t *testing.T) {
+	cases := map[string]bool{
+		"140.82.112.3":           true,
+		"2606:4700::1111":        true,
+		"127.0.0.1":              false,
+		"::1":                    false,
+		"10.1.2.3":               false,
+		"172.16.0.1":             false,
+		"192.168.1.1":            false,
+		"169.254.169.254":        false,
+		"fe80::1":                false,
+		"fd00:ec2::254":          false,
+		"100.100.100.200":        false,
+		"0.0.0.0":                false,
+		"::":                     false,
+		"::ffff:127.0.0.1":       false,
+		"::ffff:169.254.169.254": false,
+		"64:ff9b::a9fe:a9fe":     false,
+		"255.255.255.255":        false,
+		"224.0.0.1":              false,
+	}
+	for raw, want := range cases {
+		if got := IsPublic(netip.MustParseAddr(raw)); got != want {
+			t.Errorf("IsPublic(%s) = %t, want %t", raw, got, want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"https://example.com/manifest.json": true,
+		"http://example.com/manifest.json":  false,
+		"file:///etc/passwd":                false,
+		"https:///manifest.json":            false,
+		"manifest.json":                     false,
+	} {
+		if err := CheckURL(raw); (err == nil) != ok {
+			t.Errorf("CheckURL(%q) = %v", raw, err)
+		}
+	}
+}
+
+func TestClientRefusesPrivateAndPlainHTTP(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := NewClient(5 * time.Second)
+	for url, want := range map[string]error{
+		srv.URL: ErrNotPublic,
+		strings.Replace(srv.URL, "https", "http", 1): ErrInsecureURL,
+		"https://169.254.169.254/latest/meta-data/":  ErrNotPublic,
+	} {
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if !errors.Is(err, want) {
+			t.Errorf("GET %s: expected %v, got %v", url, want, err)
+		}
+	}
+}
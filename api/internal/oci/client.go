@@ -0,0 +1,235 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/netguard"
+)
+
+const (
+	MediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	MediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+const maxManifestSize = 4 << 20
+
+var ErrNotFound = errors.New("not found in registry")
+
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type Manifest struct {
+	MediaType string       `json:"mediaType"`
+	Config    Descriptor   `json:"config"`
+	Layers    []Descriptor `json:"layers"`
+	Manifests []Descriptor `json:"manifests"`
+}
+
+// Client talks to OCI distribution registries anonymously, following the
+// bearer token challenge registries such as ghcr.io and Docker Hub use for
+// public pulls.
+type Client struct {
+	HTTP *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient returns a client that only connects to public registries over
+// https, since registry hosts and token realms come from publish requests and
+// registry responses.
+func NewClient() *Client {
+	return &Client{HTTP: netguard.NewClient(15 * time.Second)}
+}
+
+// Manifest fetches a manifest by tag or digest and returns it with its digest.
+func (c *Client) Manifest(ctx context.Context, registry, repository, reference string, accept ...string) (*Manifest, string, error) {
+	if len(accept) == 0 {
+		accept = []string{MediaTypeOCIManifest, MediaTypeOCIIndex, MediaTypeDockerManifest, MediaTypeDockerList}
+	}
+	resp, err := c.get(ctx, registry, repository, "/manifests/"+reference, strings.Join(accept, ", "))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, "", fmt.Errorf("manifest %s/%s:%s invalid: %w", registry, repository, reference, err)
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = resp.Header.Get("Content-Type")
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return &manifest, digest, nil
+}
+
+// Blob downloads a blob, refusing blobs larger than limit bytes.
+func (c *Client) Blob(ctx context.Context, registry, repository, digest string, limit int64) ([]byte, error) {
+	resp, err := c.get(ctx, registry, repository, "/blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("blob %s larger than %d bytes", digest, limit)
+	}
+	return body, nil
+}
+
+func (c *Client) get(ctx context.Context, registry, repository, path, accept string) (*http.Response, error) {
+	endpoint := "https://" + apiHost(registry) + "/v2/" + repository + path
+	key := registry + "/" + repository
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		req.Header.Set("User-Agent", "homenavi-marketplace")
+		if token := c.token(key); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return resp, nil
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := c.authenticate(ctx, key, challenge); err != nil {
+				return nil, err
+			}
+			continue
+		case resp.StatusCode == http.StatusNotFound:
+			resp.Body.Close()
+			return nil, ErrNotFound
+		}
+		resp.Body.Close()
+		return nil, fmt.Errorf("registry %s: %s", registry, resp.Status)
+	}
+	return nil, fmt.Errorf("registry %s: unauthorized", registry)
+}
+
+// authenticate fetches an anonymous pull token for the challenge in a 401.
+func (c *Client) authenticate(ctx context.Context, key, challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("registry auth %q not supported", scheme)
+	}
+	fields := parseChallenge(params)
+	realm := fields["realm"]
+	if realm == "" {
+		return errors.New("registry auth challenge missing realm")
+	}
+	query := url.Values{}
+	if fields["service"] != "" {
+		query.Set("service", fields["service"])
+	}
+	if fields["scope"] != "" {
+		query.Set("scope", fields["scope"])
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token request failed: %s", resp.Status)
+	}
+	var payload struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return err
+	}
+	token := payload.Token
+	if token == "" {
+		token = payload.AccessToken
+	}
+	if token == "" {
+		return errors.New("registry token response empty")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens == nil {
+		c.tokens = map[string]string{}
+	}
+	c.tokens[key] = token
+	return nil
+}
+
+func (c *Client) token(key string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[key]
+}
+
+func parseChallenge(params string) map[string]string {
+	out := map[string]string{}
+	for params != "" {
+		var pair string
+		// Values are quoted and may contain commas (e.g. multiple scopes).
+		name, rest, ok := strings.Cut(params, "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			pair, params = rest[1:end+1], strings.TrimPrefix(strings.TrimSpace(rest[end+2:]), ",")
+		} else {
+			pair, params, _ = strings.Cut(rest, ",")
+		}
+		out[strings.ToLower(strings.TrimSpace(name))] = pair
+		params = strings.TrimSpace(params)
+	}
+	return out
+}
+
+func apiHost(registry string) string {
+	if registry == dockerHub {
+		return "registry-1.docker.io"
+	}
+	return registry
+}
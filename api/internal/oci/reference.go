@@ -0,0 +1,109 @@
+package oci
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const dockerHub = "docker.io"
+
+var ErrInvalidReference = errors.New("invalid image reference")
+
+var (
+	pathComponent = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	tagPattern    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// Image is a parsed container image reference such as
+// ghcr.io/acme/app:1.0.0 or nginx@sha256:....
+type Image struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseImage parses an image reference, applying the Docker Hub defaults
+// for a missing registry ("docker.io") and namespace ("library/").
+func ParseImage(raw string) (Image, error) {
+	var img Image
+	value := strings.TrimSpace(raw)
+	if value == "" || strings.Contains(value, "://") {
+		return img, ErrInvalidReference
+	}
+	if name, digest, ok := strings.Cut(value, "@"); ok {
+		if !digestPattern.MatchString(digest) {
+			return img, ErrInvalidReference
+		}
+		img.Digest = digest
+		value = name
+	}
+	if idx := strings.LastIndex(value, ":"); idx > strings.LastIndex(value, "/") {
+		img.Tag = value[idx+1:]
+		value = value[:idx]
+		if !tagPattern.MatchString(img.Tag) {
+			return img, ErrInvalidReference
+		}
+	}
+
+	first, rest, hasSlash := strings.Cut(value, "/")
+	if hasSlash && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		img.Registry = first
+		img.Repository = rest
+	} else {
+		img.Registry = dockerHub
+		img.Repository = value
+	}
+	if img.Registry == "index.docker.io" || img.Registry == "registry-1.docker.io" {
+		img.Registry = dockerHub
+	}
+	if img.Registry == dockerHub && !strings.Contains(img.Repository, "/") {
+		img.Repository = "library/" + img.Repository
+	}
+	if err := ValidateRepository(img.Repository); err != nil {
+		return img, err
+	}
+	return img, nil
+}
+
+// ValidateRepository checks a repository path against the distribution spec.
+func ValidateRepository(repository string) error {
+	if repository == "" {
+		return ErrInvalidReference
+	}
+	for _, part := range strings.Split(repository, "/") {
+		if !pathComponent.MatchString(part) {
+			return ErrInvalidReference
+		}
+	}
+	return nil
+}
+
+// Name returns registry/repository without tag or digest.
+func (i Image) Name() string {
+	return i.Registry + "/" + i.Repository
+}
+
+// Reference returns the digest if set, otherwise the tag ("latest" if empty).
+func (i Image) Reference() string {
+	if i.Digest != "" {
+		return i.Digest
+	}
+	if i.Tag != "" {
+		return i.Tag
+	}
+	return "latest"
+}
+
+func (i Image) String() string {
+	out := i.Name()
+	if i.Tag != "" {
+		out += ":" + i.Tag
+	}
+	if i.Digest != "" {
+		out += "@" + i.Digest
+	}
+	return out
+}
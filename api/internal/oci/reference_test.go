@@ -0,0 +1,35 @@
+package oci
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseImage(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	cases := []struct {
+		raw  string
+		name string
+		ref  string
+	}{
+		{raw: "nginx", name: "docker.io/library/nginx", ref: "latest"},
+		{raw: "ghcr.io/petoadam/homenavi-spotify:v1.0.0", name: "ghcr.io/petoadam/homenavi-spotify", ref: "v1.0.0"},
+		{raw: "localhost:5000/acme/app@" + digest, name: "localhost:5000/acme/app", ref: digest},
+		{raw: "index.docker.io/acme/app:1", name: "docker.io/acme/app", ref: "1"},
+	}
+	for _, tc := range cases {
+		img, err := ParseImage(tc.raw)
+		if err != nil {
+			t.Errorf("ParseImage(%q): %v", tc.raw, err)
+			continue
+		}
+		if img.Name() != tc.name || img.Reference() != tc.ref {
+			t.Errorf("ParseImage(%q) = %s %s, want %s %s", tc.raw, img.Name(), img.Reference(), tc.name, tc.ref)
+		}
+	}
+	for _, raw := range []string{"", "https://ghcr.io/acme/app", "ghcr.io/Acme/app", "acme/app@sha256:abc"} {
+		if _, err := ParseImage(raw); err == nil {
+			t.Errorf("ParseImage(%q) expected error", raw)
+		}
+	}
+}
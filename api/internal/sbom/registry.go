@@ -0,0 +1,44 @@
+package sbom
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/oci"
+)
+
+var ErrNotFound = errors.New("no sbom attached to image")
+
+var attachedMediaTypes = map[string]bool{
+	"text/spdx+json":                 true,
+	"application/spdx+json":          true,
+	"application/vnd.cyclonedx+json": true,
+}
+
+// FetchAttached downloads an SBOM attached with `cosign attach sbom`, which
+// stores it under the tag sha256-<hex>.sbom next to the image.
+func FetchAttached(ctx context.Context, client *oci.Client, image oci.Image, digest string) (*Document, error) {
+	algorithm, hexDigest, ok := strings.Cut(digest, ":")
+	if !ok {
+		return nil, ErrNotFound
+	}
+	manifest, _, err := client.Manifest(ctx, image.Registry, image.Repository, algorithm+"-"+hexDigest+".sbom", oci.MediaTypeOCIManifest, oci.MediaTypeDockerManifest)
+	if errors.Is(err, oci.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range manifest.Layers {
+		if !attachedMediaTypes[layer.MediaType] {
+			continue
+		}
+		data, err := client.Blob(ctx, image.Registry, image.Repository, layer.Digest, MaxSize)
+		if err != nil {
+			return nil, err
+		}
+		return Parse(data)
+	}
+	return nil, ErrNotFound
+}
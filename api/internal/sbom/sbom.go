@@ -0,0 +1,186 @@
+package sbom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+)
+
+const (
+	FormatSPDX      = "spdx"
+	FormatCycloneDX = "cyclonedx"
+
+	// MaxSize bounds stored SBOM documents.
+	MaxSize = 8 << 20
+)
+
+var ErrUnsupported = errors.New("sbom must be an SPDX or CycloneDX JSON document")
+
+// Document is a parsed SBOM. Raw is kept verbatim for the sbom endpoint.
+type Document struct {
+	Format      string
+	SpecVersion string
+	Components  []models.SBOMComponent
+	Raw         json.RawMessage
+}
+
+// Parse detects and reads SPDX 2.x and CycloneDX JSON documents.
+func Parse(data []byte) (*Document, error) {
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("sbom larger than %d bytes", MaxSize)
+	}
+	var probe struct {
+		SPDXVersion string `json:"spdxVersion"`
+		BOMFormat   string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, ErrUnsupported
+	}
+	var doc *Document
+	var err error
+	switch {
+	case strings.HasPrefix(probe.SPDXVersion, "SPDX-"):
+		doc, err = parseSPDX(data)
+	case probe.BOMFormat == "CycloneDX":
+		doc, err = parseCycloneDX(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc.Raw = append(json.RawMessage(nil), data...)
+	return doc, nil
+}
+
+func parseSPDX(data []byte) (*Document, error) {
+	var spdx struct {
+		SPDXVersion string `json:"spdxVersion"`
+		Packages    []struct {
+			Name             string `json:"name"`
+			VersionInfo      string `json:"versionInfo"`
+			LicenseConcluded string `json:"licenseConcluded"`
+			LicenseDeclared  string `json:"licenseDeclared"`
+			ExternalRefs     []struct {
+				ReferenceType    string `json:"referenceType"`
+				ReferenceLocator string `json:"referenceLocator"`
+			} `json:"externalRefs"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &spdx); err != nil {
+		return nil, fmt.Errorf("spdx document invalid: %w", err)
+	}
+	doc := &Document{Format: FormatSPDX, SpecVersion: strings.TrimPrefix(spdx.SPDXVersion, "SPDX-")}
+	for _, pkg := range spdx.Packages {
+		component := models.SBOMComponent{Name: pkg.Name, Version: pkg.VersionInfo}
+		for _, ref := range pkg.ExternalRefs {
+			if ref.ReferenceType == "purl" {
+				component.PURL = ref.ReferenceLocator
+				break
+			}
+		}
+		license := pkg.LicenseConcluded
+		if !spdxLicenseKnown(license) {
+			license = pkg.LicenseDeclared
+		}
+		if spdxLicenseKnown(license) {
+			component.Licenses = []string{license}
+		}
+		doc.Components = append(doc.Components, component)
+	}
+	return doc, nil
+}
+
+func spdxLicenseKnown(license string) bool {
+	return license != "" && license != "NOASSERTION" && license != "NONE"
+}
+
+type cycloneDXComponent struct {
+	Name     string `json:"name"`
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	PURL     string `json:"purl"`
+	Licenses []struct {
+		License struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"license"`
+		Expression string `json:"expression"`
+	} `json:"licenses"`
+	Components []cycloneDXComponent `json:"components"`
+}
+
+func parseCycloneDX(data []byte) (*Document, error) {
+	var bom struct {
+		SpecVersion string               `json:"specVersion"`
+		Components  []cycloneDXComponent `json:"components"`
+	}
+	if err := json.Unmarshal(data, &bom); err != nil {
+		return nil, fmt.Errorf("cyclonedx document invalid: %w", err)
+	}
+	doc := &Document{Format: FormatCycloneDX, SpecVersion: bom.SpecVersion}
+	var walk func([]cycloneDXComponent)
+	walk = func(components []cycloneDXComponent) {
+		for _, c := range components {
+			component := models.SBOMComponent{Name: c.Name, Version: c.Version, PURL: c.PURL}
+			if c.Group != "" {
+				component.Name = c.Group + "/" + c.Name
+			}
+			for _, l := range c.Licenses {
+				if license := firstNonEmpty(l.Expression, l.License.ID, l.License.Name); license != "" {
+					component.Licenses = append(component.Licenses, license)
+				}
+			}
+			doc.Components = append(doc.Components, component)
+			walk(c.Components)
+		}
+	}
+	walk(bom.Components)
+	return doc, nil
+}
+
+// Summary lists the components and how many use each licence, most common
+// first. Components without a licence are counted as "unknown".
+func (d *Document) Summary() models.SBOMSummary {
+	counts := map[string]int{}
+	for _, component := range d.Components {
+		if len(component.Licenses) == 0 {
+			counts["unknown"]++
+		}
+		for _, license := range component.Licenses {
+			counts[license]++
+		}
+	}
+	licenses := make([]models.LicenseCount, 0, len(counts))
+	for license, count := range counts {
+		licenses = append(licenses, models.LicenseCount{License: license, Count: count})
+	}
+	sort.Slice(licenses, func(i, j int) bool {
+		if licenses[i].Count != licenses[j].Count {
+			return licenses[i].Count > licenses[j].Count
+		}
+		return licenses[i].License < licenses[j].License
+	})
+	components := append([]models.SBOMComponent{}, d.Components...)
+	sort.SliceStable(components, func(i, j int) bool { return components[i].Name < components[j].Name })
+	return models.SBOMSummary{
+		Format:         d.Format,
+		SpecVersion:    d.SpecVersion,
+		ComponentCount: len(components),
+		Licenses:       licenses,
+		Components:     components,
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package sbom
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+)
+
+const spdxDoc = `{
+  "spdxVersion": "SPDX-2.3",
+  "packages": [
+    {"name": "golang.org/x/net", "versionInfo": "v0.20.0", "licenseConcluded": "BSD-3-Clause",
+     "externalRefs": [{"referenceType": "purl", "referenceLocator": "pkg:golang/golang.org/x/net@v0.20.0"}]},
+    {"name": "github.com/go-chi/chi/v5", "versionInfo": "v5.0.12", "licenseConcluded": "NOASSERTION", "licenseDeclared": "MIT",
+     "externalRefs": [{"referenceType": "purl", "referenceLocator": "pkg:golang/github.com/go-chi/chi/v5@v5.0.12"}]},
+    {"name": "busybox", "versionInfo": "1.36.1-r15", "licenseConcluded": "NOASSERTION"}
+  ]
+}`
+
+const cycloneDXDoc = `{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.5",
+  "components": [
+    {"name": "requests", "version": "2.31.0", "purl": "pkg:pypi/requests@2.31.0",
+     "licenses": [{"license": {"id": "Apache-2.0"}}],
+     "components": [{"name": "urllib3", "version": "1.26.5", "purl": "pkg:pypi/urllib3@1.26.5", "licenses": [{"expression": "MIT"}]}]}
+  ]
+}`
+
+func TestParseSPDX(t *testing.T) {
+	doc, err := Parse([]byte(spdxDoc))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	summary := doc.Summary()
+	if summary.Format != FormatSPDX || summary.SpecVersion != "2.3" || summary.ComponentCount != 3 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	want := map[string]int{"BSD-3-Clause": 1, "MIT": 1, "unknown": 1}
+	for _, license := range summary.Licenses {
+		if want[license.License] != license.Count {
+			t.Fatalf("unexpected licence counts %+v", summary.Licenses)
+		}
+	}
+}
+
+func TestParseCycloneDXFlattensNestedComponents(t *testing.T) {
+	doc, err := Parse([]byte(cycloneDXDoc))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if doc.Format != FormatCycloneDX || len(doc.Components) != 2 || doc.Components[1].Licenses[0] != "MIT" {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+}
+
+func TestParseRejectsUnknownFormat(t *testing.T) {
+	if _, err := Parse([]byte(`{"hello":"world"}`)); err == nil {
+		t.Fatalf("expected unsupported format error")
+	}
+}
+
+func TestVulnDBMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "osv.json")
+	entries := `[
+  {"id": "GO-2024-0001", "aliases": ["CVE-2024-0001"], "summary": "net bug",
+   "affected": [{"package": {"ecosystem": "Go", "name": "golang.org/x/net"},
+     "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "0.23.0"}]}]}]},
+  {"id": "GO-2024-0002", "summary": "already fixed",
+   "affected": [{"package": {"ecosystem": "Go", "name": "golang.org/x/net"},
+     "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "0.10.0"}]}]}]},
+  {"id": "PYSEC-2021-108", "database_specific": {"severity": "HIGH"},
+   "affected": [{"package": {"ecosystem": "PyPI", "name": "urllib3"}, "versions": ["1.26.5"]}]},
+  {"id": "GHSA-withdrawn", "withdrawn": "2024-01-01T00:00:00Z",
+   "affected": [{"package": {"purl": "pkg:pypi/requests"}, "versions": ["2.31.0"]}]}
+]`
+	if err := os.WriteFile(path, []byte(entries), 0o644); err != nil {
+		t.Fatalf("write db: %v", err)
+	}
+	db, err := OpenVulnDB(path)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+
+	spdx, _ := Parse([]byte(spdxDoc))
+	cyclone, _ := Parse([]byte(cycloneDXDoc))
+	components := append(append([]models.SBOMComponent{}, spdx.Components...), cyclone.Components...)
+	vulns := db.Match(components)
+	if len(vulns) != 2 {
+		t.Fatalf("expected 2 vulnerabilities, got %+v", vulns)
+	}
+	if vulns[0].ID != "GO-2024-0001" || vulns[0].Fixed != "0.23.0" || vulns[0].Version != "v0.20.0" {
+		t.Fatalf("unexpected go vulnerability %+v", vulns[0])
+	}
+	if vulns[1].ID != "PYSEC-2021-108" || vulns[1].Severity != "HIGH" {
+		t.Fatalf("unexpected pypi vulnerability %+v", vulns[1])
+	}
+}
+
+func TestAffectsOnlyComparesSemverEcosystems(t *testing.T) {
+	var debian, npm osvAffected
+	if err := json.Unmarshal([]byte(`{"package": {"ecosystem": "Debian:12", "name": "openssl"}, "versions": ["3.0.11-1~deb12u1"],
+  "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "3.0.11-1~deb12u2"}]}]}`), &debian); err != nil {
+		t.Fatalf("debian advisory: %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"package": {"ecosystem": "npm", "name": "lodash"},
+  "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "0"}, {"fixed": "4.17.21"}]}]}`), &npm); err != nil {
+		t.Fatalf("npm advisory: %v", err)
+	}
+	// Debian orders "~" before anything, so semver would get this wrong.
+	if affected, _ := affects(debian, "3.0.11-1+deb12u1"); affected {
+		t.Fatalf("expected a debian ECOSYSTEM range not to be compared as semver")
+	}
+	if affected, _ := affects(debian, "3.0.11-1~deb12u1"); !affected {
+		t.Fatalf("expected the listed debian version to match")
+	}
+	if affected, fixed := affects(npm, "4.17.20"); !affected || fixed != "4.17.21" {
+		t.Fatalf("expected the npm ECOSYSTEM range to match, got %t %q", affected, fixed)
+	}
+}
+
+func TestPurlKey(t *testing.T) {
+	cases := map[string][2]string{
+		"pkg:golang/github.com/go-chi/chi/v5@v5.0.12":     {"golang/github.com/go-chi/chi/v5", "v5.0.12"},
+		"pkg:npm/%40angular/core@16.0.0":                  {"npm/@angular/core", "16.0.0"},
+		"pkg:PyPI/Django_Rest@3.0?x=1#sub":                {"pypi/django-rest", "3.0"},
+		"pkg:deb/debian/openssl@3.0.11-1?distro=bookworm": {"deb/debian/openssl", "3.0.11-1"},
+	}
+	for purl, want := range cases {
+		key, version := purlKey(purl)
+		if key != want[0] || version != want[1] {
+			t.Errorf("purlKey(%q) = %q %q, want %q %q", purl, key, version, want[0], want[1])
+		}
+	}
+}
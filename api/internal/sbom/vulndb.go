@@ -0,0 +1,357 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
+)
+
+// reloadInterval bounds how often the database file is checked for changes.
+const reloadInterval = time.Minute
+
+type osvEntry struct {
+	ID               string   `json:"id"`
+	Aliases          []string `json:"aliases"`
+	Summary          string   `json:"summary"`
+	Withdrawn        string   `json:"withdrawn"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []osvAffected `json:"affected"`
+}
+
+type osvAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+		PURL      string `json:"purl"`
+	} `json:"package"`
+	Versions []string `json:"versions"`
+	Ranges   []struct {
+		Type   string `json:"type"`
+		Events []struct {
+			Introduced   string `json:"introduced"`
+			Fixed        string `json:"fixed"`
+			LastAffected string `json:"last_affected"`
+		} `json:"events"`
+	} `json:"ranges"`
+}
+
+type advisory struct {
+	entry    *osvEntry
+	affected osvAffected
+}
+
+// VulnDB matches SBOM components against a locally mirrored OSV database:
+// a file holding a JSON array of OSV entries or one entry per line. The
+// file is reloaded when it changes, so a cron job can refresh the mirror.
+type VulnDB struct {
+	path string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	checked time.Time
+	byKey   map[string][]advisory
+}
+
+func OpenVulnDB(path string) (*VulnDB, error) {
+	db := &VulnDB{path: path}
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *VulnDB) load() error {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+	entries, err := decodeOSV(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", db.path, err)
+	}
+	byKey := map[string][]advisory{}
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Withdrawn != "" {
+			continue
+		}
+		for _, affected := range entry.Affected {
+			key := affectedKey(affected)
+			if key == "" {
+				continue
+			}
+			byKey[key] = append(byKey[key], advisory{entry: entry, affected: affected})
+		}
+	}
+	db.mu.Lock()
+	db.byKey = byKey
+	db.modTime = info.ModTime()
+	db.checked = time.Now()
+	db.mu.Unlock()
+	return nil
+}
+
+func decodeOSV(data []byte) ([]osvEntry, error) {
+	trimmed := bytes.TrimSpace(data)
+	var entries []osvEntry
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		err := json.Unmarshal(trimmed, &entries)
+		return entries, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry osvEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func (db *VulnDB) refresh() {
+	db.mu.RLock()
+	due := time.Since(db.checked) >= reloadInterval
+	modTime := db.modTime
+	db.mu.RUnlock()
+	if !due {
+		return
+	}
+	info, err := os.Stat(db.path)
+	if err == nil && info.ModTime().Equal(modTime) {
+		db.mu.Lock()
+		db.checked = time.Now()
+		db.mu.Unlock()
+		return
+	}
+	if err := db.load(); err != nil {
+		log.Printf("vulnerability db reload failed, keeping previous data: %v", err)
+		db.mu.Lock()
+		db.checked = time.Now()
+		db.mu.Unlock()
+	}
+}
+
+// Match returns the advisories affecting components, ordered by package and
+// id. Components without a purl cannot be matched.
+func (db *VulnDB) Match(components []models.SBOMComponent) []models.Vulnerability {
+	db.refresh()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	out := []models.Vulnerability{}
+	seen := map[string]bool{}
+	for _, component := range components {
+		key, version := purlKey(component.PURL)
+		if key == "" {
+			continue
+		}
+		if version == "" {
+			version = component.Version
+		}
+		for _, adv := range db.byKey[key] {
+			affected, fixed := affects(adv.affected, version)
+			if !affected || seen[adv.entry.ID+"|"+key+"|"+version] {
+				continue
+			}
+			seen[adv.entry.ID+"|"+key+"|"+version] = true
+			out = append(out, models.Vulnerability{
+				ID:       adv.entry.ID,
+				Aliases:  adv.entry.Aliases,
+				Summary:  adv.entry.Summary,
+				Severity: severity(adv.entry),
+				Package:  component.Name,
+				Version:  version,
+				Fixed:    fixed,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Package != out[j].Package {
+			return out[i].Package < out[j].Package
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func severity(entry *osvEntry) string {
+	if entry.DatabaseSpecific.Severity != "" {
+		return entry.DatabaseSpecific.Severity
+	}
+	if len(entry.Severity) > 0 {
+		return entry.Severity[0].Score
+	}
+	return ""
+}
+
+// ecosystemTypes maps OSV ecosystems to purl types.
+var ecosystemTypes = map[string]string{
+	"Go":        "golang",
+	"npm":       "npm",
+	"PyPI":      "pypi",
+	"Maven":     "maven",
+	"crates.io": "cargo",
+	"RubyGems":  "gem",
+	"NuGet":     "nuget",
+	"Packagist": "composer",
+	"Pub":       "pub",
+	"Hex":       "hex",
+	"Debian":    "deb/debian",
+	"Ubuntu":    "deb/ubuntu",
+	"Alpine":    "apk/alpine",
+}
+
+// semverEcosystems are the OSV ecosystems whose versions order like semver.
+// ECOSYSTEM ranges of any other ecosystem, such as Debian or Alpine package
+// versions, cannot be compared here and only the explicit version list is
+// matched.
+var semverEcosystems = map[string]bool{
+	"Go":        true,
+	"npm":       true,
+	"crates.io": true,
+	"Hex":       true,
+	"Pub":       true,
+	"NuGet":     true,
+}
+
+func affectedKey(affected osvAffected) string {
+	if affected.Package.PURL != "" {
+		key, _ := purlKey(affected.Package.PURL)
+		return key
+	}
+	ecosystem, _, _ := strings.Cut(affected.Package.Ecosystem, ":")
+	purlType, ok := ecosystemTypes[ecosystem]
+	if !ok || affected.Package.Name == "" {
+		return ""
+	}
+	name := affected.Package.Name
+	if ecosystem == "Maven" {
+		name = strings.Replace(name, ":", "/", 1)
+	}
+	return normalizeKey(purlType + "/" + name)
+}
+
+// purlKey returns "type/namespace/name" and the version of a package URL.
+// Qualifiers such as distro are ignored.
+func purlKey(purl string) (string, string) {
+	rest, ok := strings.CutPrefix(purl, "pkg:")
+	if !ok {
+		return "", ""
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, _, _ = strings.Cut(rest, "?")
+	var version string
+	if idx := strings.LastIndex(rest, "@"); idx >= 0 {
+		version, rest = rest[idx+1:], rest[:idx]
+		if unescaped, err := url.PathUnescape(version); err == nil {
+			version = unescaped
+		}
+	}
+	if unescaped, err := url.PathUnescape(rest); err == nil {
+		rest = unescaped
+	}
+	return normalizeKey(rest), version
+}
+
+func normalizeKey(key string) string {
+	purlType, name, _ := strings.Cut(key, "/")
+	purlType = strings.ToLower(purlType)
+	if purlType == "pypi" {
+		name = strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	}
+	return purlType + "/" + name
+}
+
+// affects reports whether version is listed or falls in a SEMVER range, or
+// an ECOSYSTEM range of a semver ecosystem, and the version that fixes it.
+// Other ecosystems only match the explicit version list.
+func affects(affected osvAffected, version string) (bool, string) {
+	for _, listed := range affected.Versions {
+		if strings.TrimPrefix(listed, "v") == strings.TrimPrefix(version, "v") {
+			return true, ""
+		}
+	}
+	v, err := parseLoose(version)
+	if err != nil {
+		return false, ""
+	}
+	ecosystem, _, _ := strings.Cut(affected.Package.Ecosystem, ":")
+	for _, r := range affected.Ranges {
+		if r.Type != "SEMVER" && (r.Type != "ECOSYSTEM" || !semverEcosystems[ecosystem]) {
+			continue
+		}
+		inRange := false
+		for _, event := range r.Events {
+			switch {
+			case event.Introduced != "":
+				if event.Introduced == "0" {
+					inRange = true
+				} else if introduced, err := parseLoose(event.Introduced); err == nil && v.Compare(introduced) >= 0 {
+					inRange = true
+				}
+			case event.Fixed != "":
+				fixed, err := parseLoose(event.Fixed)
+				if err != nil {
+					continue
+				}
+				if inRange && v.Compare(fixed) < 0 {
+					return true, event.Fixed
+				}
+				inRange = false
+			case event.LastAffected != "":
+				last, err := parseLoose(event.LastAffected)
+				if err != nil {
+					continue
+				}
+				if inRange && v.Compare(last) <= 0 {
+					return true, ""
+				}
+				inRange = false
+			}
+		}
+		if inRange {
+			return true, ""
+		}
+	}
+	return false, ""
+}
+
+// parseLoose accepts "1", "1.2" and Go's "+incompatible" suffix.
+func parseLoose(raw string) (semver.Version, error) {
+	value := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(raw), "v"), "+incompatible")
+	core, suffix := value, ""
+	if idx := strings.IndexAny(value, "-+"); idx >= 0 {
+		core, suffix = value[:idx], value[idx:]
+	}
+	for strings.Count(core, ".") < 2 {
+		core += ".0"
+	}
+	return semver.Parse(core+suffix, "")
+}
@@ -0,0 +1,263 @@
+package semver
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidConstraint = errors.New("invalid version constraint")
+
+type operator int
+
+const (
+	opEQ operator = iota
+	opGT
+	opGTE
+	opLT
+	opLTE
+)
+
+type comparator struct {
+	op      operator
+	version Version
+}
+
+// Constraint is a set of alternatives joined by "||"; a version matches when
+// it satisfies every comparator of at least one alternative.
+type Constraint struct {
+	raw  string
+	sets [][]comparator
+}
+
+// ParseConstraint accepts npm-style ranges: exact versions, comparators
+// (>, >=, <, <=, =), caret (^1.2), tilde (~1.2.3), x-ranges (1.x, 1.2.*, *)
+// and partial versions (1.2), combined with spaces (AND) and "||" (OR).
+func ParseConstraint(raw, prefix string) (Constraint, error) {
+	c := Constraint{raw: strings.TrimSpace(raw)}
+	if c.raw == "" {
+		return c, ErrInvalidConstraint
+	}
+	for _, alt := range strings.Split(c.raw, "||") {
+		fields := strings.Fields(alt)
+		if len(fields) == 0 {
+			return c, ErrInvalidConstraint
+		}
+		set := []comparator{}
+		for _, field := range fields {
+			comps, err := parseComparator(field, prefix)
+			if err != nil {
+				return c, err
+			}
+			set = append(set, comps...)
+		}
+		c.sets = append(c.sets, set)
+	}
+	return c, nil
+}
+
+func (c Constraint) String() string {
+	return c.raw
+}
+
+// Check reports whether v satisfies the constraint. Prereleases only match when
+// includePrerelease is set or an alternative names a prerelease of the same
+// MAJOR.MINOR.PATCH, so "^1.2" never resolves to "1.3.0-rc.1".
+func (c Constraint) Check(v Version, includePrerelease bool) bool {
+	for _, set := range c.sets {
+		if matchesSet(set, v, includePrerelease) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesSet(set []comparator, v Version, includePrerelease bool) bool {
+	for _, comp := range set {
+		if !comp.matches(v) {
+			return false
+		}
+	}
+	if !v.IsPrerelease() || includePrerelease {
+		return true
+	}
+	for _, comp := range set {
+		if comp.version.IsPrerelease() &&
+			comp.version.Major == v.Major &&
+			comp.version.Minor == v.Minor &&
+			comp.version.Patch == v.Patch {
+			return true
+		}
+	}
+	return false
+}
+
+func (c comparator) matches(v Version) bool {
+	cmp := v.Compare(c.version)
+	switch c.op {
+	case opGT:
+		return cmp > 0
+	case opGTE:
+		return cmp >= 0
+	case opLT:
+		return cmp < 0
+	case opLTE:
+		return cmp <= 0
+	}
+	return cmp == 0
+}
+
+// partial is a version where trailing parts may be missing or wildcards.
+type partial struct {
+	version Version
+	parts   int
+}
+
+func parseComparator(field, prefix string) ([]comparator, error) {
+	switch {
+	case strings.HasPrefix(field, "^"):
+		p, err := parsePartial(field[1:], prefix)
+		if err != nil {
+			return nil, err
+		}
+		return caretRange(p), nil
+	case strings.HasPrefix(field, "~"):
+		p, err := parsePartial(strings.TrimPrefix(field[1:], ">"), prefix)
+		if err != nil {
+			return nil, err
+		}
+		return tildeRange(p), nil
+	}
+
+	op := opEQ
+	for _, candidate := range []struct {
+		token string
+		op    operator
+	}{{">=", opGTE}, {"<=", opLTE}, {">", opGT}, {"<", opLT}, {"=", opEQ}} {
+		if strings.HasPrefix(field, candidate.token) {
+			op = candidate.op
+			field = field[len(candidate.token):]
+			break
+		}
+	}
+	p, err := parsePartial(field, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if p.parts == 3 {
+		return []comparator{{op: op, version: p.version}}, nil
+	}
+
+	lower, upper := p.version, p.bump()
+	switch op {
+	case opGT:
+		if p.parts == 0 {
+			return nil, ErrInvalidConstraint
+		}
+		return []comparator{{op: opGTE, version: upper}}, nil
+	case opGTE:
+		return []comparator{{op: opGTE, version: lower}}, nil
+	case opLT:
+		return []comparator{{op: opLT, version: lower}}, nil
+	case opLTE:
+		if p.parts == 0 {
+			return []comparator{{op: opGTE, version: Version{}}}, nil
+		}
+		return []comparator{{op: opLT, version: upper}}, nil
+	}
+	if p.parts == 0 {
+		return []comparator{{op: opGTE, version: Version{}}}, nil
+	}
+	return []comparator{{op: opGTE, version: lower}, {op: opLT, version: upper}}, nil
+}
+
+func caretRange(p partial) []comparator {
+	lower := p.version
+	upper := Version{}
+	switch {
+	case p.parts == 0:
+		return []comparator{{op: opGTE, version: Version{}}}
+	case lower.Major > 0 || p.parts == 1:
+		upper.Major = lower.Major + 1
+	case lower.Minor > 0 || p.parts == 2:
+		upper.Minor = lower.Minor + 1
+	default:
+		upper.Patch = lower.Patch + 1
+	}
+	return []comparator{{op: opGTE, version: lower}, {op: opLT, version: upper}}
+}
+
+func tildeRange(p partial) []comparator {
+	lower := p.version
+	upper := Version{Major: lower.Major}
+	switch p.parts {
+	case 0:
+		return []comparator{{op: opGTE, version: Version{}}}
+	case 1:
+		upper.Major++
+	default:
+		upper.Minor = lower.Minor + 1
+	}
+	return []comparator{{op: opGTE, version: lower}, {op: opLT, version: upper}}
+}
+
+// bump returns the first version outside the partial, e.g. 1.2 -> 1.3.0.
+func (p partial) bump() Version {
+	switch p.parts {
+	case 1:
+		return Version{Major: p.version.Major + 1}
+	case 2:
+		return Version{Major: p.version.Major, Minor: p.version.Minor + 1}
+	}
+	return p.version
+}
+
+func parsePartial(raw, prefix string) (partial, error) {
+	value := trimPrefix(raw, prefix)
+	if value == "" {
+		return partial{}, ErrInvalidConstraint
+	}
+	if value == "*" || value == "x" || value == "X" {
+		return partial{}, nil
+	}
+	core := value
+	if idx := strings.IndexAny(core, "-+"); idx >= 0 {
+		core = core[:idx]
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return partial{}, ErrInvalidConstraint
+	}
+	count := 0
+	for _, part := range parts {
+		if part == "*" || part == "x" || part == "X" {
+			break
+		}
+		count++
+	}
+	if count == 3 {
+		v, err := parseCore(value)
+		if err != nil {
+			return partial{}, ErrInvalidConstraint
+		}
+		return partial{version: v, parts: 3}, nil
+	}
+	if core != value {
+		// Prerelease or build tags need a full MAJOR.MINOR.PATCH.
+		return partial{}, ErrInvalidConstraint
+	}
+	p := partial{parts: count}
+	nums := []*uint64{&p.version.Major, &p.version.Minor}
+	for i := 0; i < count; i++ {
+		n, err := parseNumber(parts[i])
+		if err != nil {
+			return partial{}, ErrInvalidConstraint
+		}
+		*nums[i] = n
+	}
+	for _, part := range parts[count:] {
+		if part != "*" && part != "x" && part != "X" {
+			return partial{}, ErrInvalidConstraint
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,67 @@
+package semver
+
+import "testing"
+
+func TestConstraintCheck(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"^0.3", "v0.3.0", true},
+		{"^0.3", "v0.3.9", true},
+		{"^0.3", "v0.4.0", false},
+		{"^1.2.3", "v1.9.0", true},
+		{"^1.2.3", "v2.0.0", false},
+		{"^0.0.3", "v0.0.4", false},
+		{"~1.2.3", "v1.2.9", true},
+		{"~1.2.3", "v1.3.0", false},
+		{"~1", "v1.9.0", true},
+		{"1.x", "v1.4.2", true},
+		{"1.2.*", "v1.3.0", false},
+		{"*", "v9.0.0", true},
+		{"1.2", "v1.2.5", true},
+		{">=1.0.0 <2.0.0", "v1.5.0", true},
+		{">=1.0.0 <2.0.0", "v2.0.0", false},
+		{">1.2", "v1.2.9", false},
+		{">1.2", "v1.3.0", true},
+		{"<=1.2", "v1.2.9", true},
+		{"^1.0.0 || ^2.0.0", "v2.1.0", true},
+		{"=v1.2.3", "v1.2.3", true},
+		{"^1.2", "v1.3.0-rc.1", false},
+		{"^1.3.0-rc.1", "v1.3.0-rc.2", true},
+		{"^1.3.0-rc.1", "v1.4.0-rc.1", false},
+	}
+	for _, tc := range cases {
+		c, err := ParseConstraint(tc.constraint, "v")
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.constraint, err)
+		}
+		v, err := Parse(tc.version, "v")
+		if err != nil {
+			t.Fatalf("parse version %q: %v", tc.version, err)
+		}
+		if got := c.Check(v, false); got != tc.want {
+			t.Fatalf("%q check %q: expected %t, got %t", tc.constraint, tc.version, tc.want, got)
+		}
+	}
+}
+
+func TestConstraintIncludePrerelease(t *testing.T) {
+	c, err := ParseConstraint("^1.2", "v")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	v, _ := Parse("v1.3.0-rc.1", "v")
+	if !c.Check(v, true) {
+		t.Fatalf("expected prerelease to match when included")
+	}
+}
+
+func TestParseConstraintRejectsInvalid(t *testing.T) {
+	for _, raw := range []string{"", "||", "^", "abc", "1.x.3", ">*", "1.2-rc.1", "^1.2.3.4", "^vv1.2.3"} {
+		if _, err := ParseConstraint(raw, "v"); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidVersion = errors.New("invalid semantic version")
+
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string
+	Build      string
+}
+
+// Parse reads a MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] version. The tag prefix
+// and one leading "v" are stripped first, so "v1.2.3" parses with either
+// prefix. A prefix ending in "v" is that "v", so "vv1.2.3" does not parse with
+// prefix "v".
+func Parse(raw, prefix string) (Version, error) {
+	return parseCore(trimPrefix(raw, prefix))
+}
+
+// parseCore parses value with any prefix already stripped.
+func parseCore(value string) (Version, error) {
+	var v Version
+	if value == "" {
+		return v, ErrInvalidVersion
+	}
+
+	if idx := strings.Index(value, "+"); idx >= 0 {
+		v.Build = value[idx+1:]
+		value = value[:idx]
+		if !validIdentifiers(v.Build) {
+			return v, ErrInvalidVersion
+		}
+	}
+	if idx := strings.Index(value, "-"); idx >= 0 {
+		pre := value[idx+1:]
+		value = value[:idx]
+		if !validIdentifiers(pre) {
+			return v, ErrInvalidVersion
+		}
+		v.Prerelease = strings.Split(pre, ".")
+		for _, id := range v.Prerelease {
+			if isNumeric(id) {
+				if _, err := parseNumber(id); err != nil {
+					return v, ErrInvalidVersion
+				}
+			}
+		}
+	}
+
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return v, ErrInvalidVersion
+	}
+	nums := make([]uint64, 3)
+	for i, part := range parts {
+		n, err := parseNumber(part)
+		if err != nil {
+			return v, ErrInvalidVersion
+		}
+		nums[i] = n
+	}
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+	return v, nil
+}
+
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+func (v Version) String() string {
+	out := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.IsPrerelease() {
+		out += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if v.Build != "" {
+		out += "+" + v.Build
+	}
+	return out
+}
+
+// Compare returns -1, 0 or 1 following semver precedence; build metadata is ignored.
+func (v Version) Compare(o Version) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+	switch {
+	case !v.IsPrerelease() && !o.IsPrerelease():
+		return 0
+	case !v.IsPrerelease():
+		return 1
+	case !o.IsPrerelease():
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		if c := compareIdentifier(v.Prerelease[i], o.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(v.Prerelease)), uint64(len(o.Prerelease)))
+}
+
+// Key returns a string whose byte-wise ("C" collation) order matches semver
+// precedence, so versions can be sorted and paged in SQL.
+func (v Version) Key() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%020d.%020d.%020d", v.Major, v.Minor, v.Patch)
+	if !v.IsPrerelease() {
+		// '~' sorts after '-', so a release outranks its prereleases.
+		b.WriteString("~")
+		return b.String()
+	}
+	b.WriteString("-")
+	for i, id := range v.Prerelease {
+		if i > 0 {
+			// '!' sorts below every identifier character, so shorter
+			// identifier lists and shorter identifiers come first.
+			b.WriteString("!")
+		}
+		if isNumeric(id) {
+			n, _ := strconv.ParseUint(id, 10, 64)
+			fmt.Fprintf(&b, "0%020d", n)
+		} else {
+			b.WriteString("1")
+			b.WriteString(id)
+		}
+	}
+	return b.String()
+}
+
+func compareIdentifier(a, b string) int {
+	aNum, bNum := isNumeric(a), isNumeric(b)
+	switch {
+	case aNum && bNum:
+		an, _ := strconv.ParseUint(a, 10, 64)
+		bn, _ := strconv.ParseUint(b, 10, 64)
+		return compareUint(an, bn)
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func parseNumber(value string) (uint64, error) {
+	if !isNumeric(value) || (len(value) > 1 && value[0] == '0') {
+		return 0, ErrInvalidVersion
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+func isNumeric(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func validIdentifiers(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, id := range strings.Split(value, ".") {
+		if id == "" {
+			return false
+		}
+		for _, r := range id {
+			if !(r >= '0' && r <= '9') && !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && r != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// trimPrefix strips the tag prefix and one leading "v" from raw. A prefix
+// ending in "v" already is that "v".
+func trimPrefix(raw, prefix string) string {
+	value := strings.TrimSpace(raw)
+	if prefix != "" && strings.HasPrefix(value, prefix) {
+		value = value[len(prefix):]
+		if strings.HasSuffix(prefix, "v") {
+			return value
+		}
+	}
+	return strings.TrimPrefix(value, "v")
+}
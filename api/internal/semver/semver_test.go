@@ -0,0 +1,72 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	v, err := Parse("release-v1.2.3-rc.1+build.5", "release-")
+	if err != nil {
+		t.Fatalf("expected valid version, got %v", err)
+	}
+	if v.Major != 1 || v.Minor != 2 || v.Patch != 3 {
+		t.Fatalf("unexpected core version: %+v", v)
+	}
+	if !v.IsPrerelease() || v.Prerelease[0] != "rc" || v.Prerelease[1] != "1" {
+		t.Fatalf("unexpected prerelease: %v", v.Prerelease)
+	}
+	if v.Build != "build.5" {
+		t.Fatalf("unexpected build: %q", v.Build)
+	}
+
+	for _, raw := range []string{"", "v1.2", "1.2.3.4", "01.2.3", "1.2.3-", "1.2.3-rc..1", "1.2.x", "latest", "vv1.2.3"} {
+		if _, err := Parse(raw, "v"); err == nil {
+			t.Fatalf("expected error for %q", raw)
+		}
+	}
+	for _, raw := range []string{"v1.2.3", "1.2.3"} {
+		if _, err := Parse(raw, "v"); err != nil {
+			t.Fatalf("expected %q to parse with prefix v, got %v", raw, err)
+		}
+	}
+}
+
+func TestCompareAndKeyOrdering(t *testing.T) {
+	// Ascending precedence, from the semver spec examples plus multi-digit parts.
+	ordered := []string{
+		"v0.1.9",
+		"v0.2.0-alpha",
+		"v0.2.0-alpha.1",
+		"v0.2.0-alpha.beta",
+		"v0.2.0-beta",
+		"v0.2.0-beta.2",
+		"v0.2.0-beta.11",
+		"v0.2.0-rc.1",
+		"v0.2.0",
+		"v0.10.0",
+		"v1.0.0",
+	}
+	versions := make([]Version, 0, len(ordered))
+	for _, raw := range ordered {
+		v, err := Parse(raw, "v")
+		if err != nil {
+			t.Fatalf("parse %s: %v", raw, err)
+		}
+		versions = append(versions, v)
+	}
+	for i := 1; i < len(versions); i++ {
+		if versions[i-1].Compare(versions[i]) != -1 {
+			t.Fatalf("expected %s < %s", ordered[i-1], ordered[i])
+		}
+		if versions[i-1].Key() >= versions[i].Key() {
+			t.Fatalf("expected key(%s) < key(%s)", ordered[i-1], ordered[i])
+		}
+	}
+
+}
+
+func TestCompareIgnoresBuildMetadata(t *testing.T) {
+	a, _ := Parse("1.0.0+a", "")
+	b, _ := Parse("1.0.0+b", "")
+	if a.Compare(b) != 0 {
+		t.Fatalf("expected build metadata to be ignored")
+	}
+}
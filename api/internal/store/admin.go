@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+var ErrIDInUse = errors.New("id already in use")
+
+// SetFeatured flags the integration id.
+func SetFeatured(ctx context.Context, db *gorm.DB, id string, featured bool) error {
+	res := db.WithContext(ctx).
+		Model(&dbmodels.Integration{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"featured": featured, "updated_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func SetVerified(ctx context.Context, db *gorm.DB, id, version string, verified bool) (*models.Integration, error) {
+	return updateRelease(ctx, db, id, version, map[string]any{"verified": verified}, nil)
+}
+
+// DeleteRelease removes one release and recomputes latest for the integration.
+func DeleteRelease(ctx context.Context, db *gorm.DB, id, version string, prereleaseLatest bool) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("integration_id = ? AND version = ?", id, version).Delete(&dbmodels.Release{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("integration_id = ? AND version = ?", id, version).Delete(&dbmodels.IntegrationSBOM{}).Error; err != nil {
+			return err
+		}
+		// The integration and its counters go with its last release.
+		var remaining int64
+		if err := tx.Model(&dbmodels.Release{}).Where("integration_id = ?", id).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return tx.Where("id = ?", id).Delete(&dbmodels.Integration{}).Error
+		}
+		return refreshLatest(tx, id, prereleaseLatest, "", "")
+	})
+}
+
+// ReassignIntegration moves every release, download event and daily
+// download rollup of oldID to newID. Releases follow the integration row
+// through their foreign key.
+func ReassignIntegration(ctx context.Context, db *gorm.DB, oldID, newID string) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&dbmodels.Integration{}).Where("id = ?", newID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrIDInUse
+		}
+		if err := tx.Model(&dbmodels.IntegrationOwner{}).Where("integration_id = ?", newID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrIDInUse
+		}
+		res := tx.Model(&dbmodels.Integration{}).
+			Where("id = ?", oldID).
+			Updates(map[string]any{"id": newID, "updated_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Model(&dbmodels.IntegrationDownloadEvent{}).
+			Where("integration_id = ?", oldID).
+			Update("integration_id", newID).Error; err != nil {
+			return err
+		}
+		for _, model := range []any{&dbmodels.IntegrationDownloadDaily{}, &dbmodels.IntegrationOwner{}, &dbmodels.OwnershipTransfer{}, &dbmodels.IntegrationSBOM{}, &dbmodels.DownloadRanking{}} {
+			if err := tx.Model(model).
+				Where("integration_id = ?", oldID).
+				Update("integration_id", newID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type AuditFilter struct {
+	IntegrationID string
+	Actor         string
+}
+
+func RecordAuditEvent(ctx context.Context, db *gorm.DB, event models.AuditEvent) error {
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Create(&dbmodels.AdminAuditEvent{
+		Actor:         event.Actor,
+		Action:        event.Action,
+		IntegrationID: event.IntegrationID,
+		Version:       event.Version,
+		Details:       datatypes.JSON(details),
+	}).Error
+}
+
+// ListAuditEvents returns admin actions, newest first.
+func ListAuditEvents(ctx context.Context, db *gorm.DB, filter AuditFilter, page Page) ([]models.AuditEvent, string, error) {
+	const sortMode = "audit"
+	cursor, err := decodeCursor(page.Cursor, sortMode)
+	if err != nil {
+		return nil, "", err
+	}
+	limit := page.limit()
+	query := db.WithContext(ctx).Model(&dbmodels.AdminAuditEvent{})
+	if filter.IntegrationID != "" {
+		query = query.Where("integration_id = ?", filter.IntegrationID)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	query = applyKeyset(query, []sortColumn{sortBySeqDesc}, cursor)
+
+	rows := []dbmodels.AdminAuditEvent{}
+	if err := query.Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if len(rows) > limit {
+		rows = rows[:limit]
+		nextCursor = encodeCursor(pageCursor{Sort: sortMode, Seq: rows[len(rows)-1].ID})
+	}
+	out := make([]models.AuditEvent, 0, len(rows))
+	for _, row := range rows {
+		event := models.AuditEvent{
+			ID:            row.ID,
+			Actor:         row.Actor,
+			Action:        row.Action,
+			IntegrationID: row.IntegrationID,
+			Version:       row.Version,
+			CreatedAt:     row.CreatedAt,
+		}
+		if len(row.Details) > 0 {
+			_ = json.Unmarshal(row.Details, &event.Details)
+		}
+		out = append(out, event)
+	}
+	return out, nextCursor, nil
+}
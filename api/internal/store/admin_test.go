@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestAdminOperations(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	for _, version := range []string{"v0.1.0", "v0.2.0"} {
+		req.Version = version
+		if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+
+	if err := SetFeatured(ctx, pool, "spotify", true); err != nil {
+		t.Fatalf("set featured: %v", err)
+	}
+	if err := DeleteRelease(ctx, pool, "spotify", "v0.2.0", false); err != nil {
+		t.Fatalf("delete release: %v", err)
+	}
+	latest, err := GetIntegration(ctx, pool, "spotify", "")
+	if err != nil {
+		t.Fatalf("get latest: %v", err)
+	}
+	if latest.Version != "v0.1.0" || !latest.Featured {
+		t.Fatalf("expected featured v0.1.0 latest after delete, got %+v", latest)
+	}
+
+	// One download old enough to be rolled up and one still raw.
+	for _, client := range []string{"old", "new"} {
+		if _, err := IncrementDownloads(ctx, pool, "spotify", DownloadOptions{ClientHash: client}); err != nil {
+			t.Fatalf("increment downloads: %v", err)
+		}
+	}
+	if err := pool.Model(&dbmodels.IntegrationDownloadEvent{}).Where("client_hash = ?", "old").
+		Update("created_at", time.Now().AddDate(0, 0, -40)).Error; err != nil {
+		t.Fatalf("backdate event: %v", err)
+	}
+	if err := RollupDownloadEvents(ctx, pool, time.Now().AddDate(0, 0, -30)); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+
+	if err := ReassignIntegration(ctx, pool, "spotify", "spotify-connect"); err != nil {
+		t.Fatalf("reassign: %v", err)
+	}
+	if _, err := GetIntegration(ctx, pool, "spotify-connect", ""); err != nil {
+		t.Fatalf("expected reassigned integration: %v", err)
+	}
+	var leftover int64
+	if err := pool.Model(&dbmodels.IntegrationDownloadDaily{}).Where("integration_id = ?", "spotify").Count(&leftover).Error; err != nil || leftover != 0 {
+		t.Fatalf("expected daily rollups moved to the new id, %d left err=%v", leftover, err)
+	}
+	stats, err := IntegrationStats(ctx, pool, "spotify-connect", StatsOptions{Days: 90})
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Downloads != 2 {
+		t.Fatalf("expected rolled up and raw downloads under the new id, got %d", stats.Downloads)
+	}
+
+	req.ID = "other"
+	req.Name = "Other"
+	req.ListenPath = "/integrations/other"
+	req.Version = "v0.1.0"
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish other: %v", err)
+	}
+	if err := ReassignIntegration(ctx, pool, "other", "spotify-connect"); err != ErrIDInUse {
+		t.Fatalf("expected ErrIDInUse, got %v", err)
+	}
+
+	for _, action := range []string{"set_featured", "delete_release"} {
+		if err := RecordAuditEvent(ctx, pool, models.AuditEvent{Actor: "alice", Action: action, IntegrationID: "spotify"}); err != nil {
+			t.Fatalf("record audit: %v", err)
+		}
+	}
+	events, next, err := ListAuditEvents(ctx, pool, AuditFilter{IntegrationID: "spotify"}, Page{Limit: 1})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	if len(events) != 1 || events[0].Action != "delete_release" || next == "" {
+		t.Fatalf("expected newest audit event first, got %+v next=%q", events, next)
+	}
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"gorm.io/gorm"
+)
+
+const apiKeyPrefix = "hnm_"
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// CreateAPIKey issues a new key for publisher. Only the SHA-256 of the key is
+// stored, so the returned Key field is the only time the secret is visible.
+func CreateAPIKey(ctx context.Context, db *gorm.DB, publisher, createdBy string) (*models.APIKey, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	row := dbmodels.PublisherAPIKey{
+		Publisher: publisher,
+		KeyHash:   hashAPIKey(key),
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		CreatedBy: createdBy,
+	}
+	if err := db.WithContext(ctx).Create(&row).Error; err != nil {
+		return nil, err
+	}
+	out := fromDBAPIKey(row)
+	out.Key = key
+	return &out, nil
+}
+
+func ListAPIKeys(ctx context.Context, db *gorm.DB, publisher string) ([]models.APIKey, error) {
+	rows := []dbmodels.PublisherAPIKey{}
+	if err := db.WithContext(ctx).
+		Where("publisher = ?", publisher).
+		Order("id DESC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]models.APIKey, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, fromDBAPIKey(row))
+	}
+	return out, nil
+}
+
+func RevokeAPIKey(ctx context.Context, db *gorm.DB, id uint) (*models.APIKey, error) {
+	res := db.WithContext(ctx).
+		Model(&dbmodels.PublisherAPIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var row dbmodels.PublisherAPIKey
+	if err := db.WithContext(ctx).First(&row, id).Error; err != nil {
+		return nil, err
+	}
+	out := fromDBAPIKey(row)
+	return &out, nil
+}
+
+// AuthenticateAPIKey returns the publisher that owns an active key.
+func AuthenticateAPIKey(ctx context.Context, db *gorm.DB, key string) (string, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", ErrInvalidAPIKey
+	}
+	var row dbmodels.PublisherAPIKey
+	if err := db.WithContext(ctx).
+		Where("key_hash = ? AND revoked_at IS NULL", hashAPIKey(key)).
+		Take(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrInvalidAPIKey
+		}
+		return "", err
+	}
+	_ = db.WithContext(ctx).
+		Model(&dbmodels.PublisherAPIKey{}).
+		Where("id = ?", row.ID).
+		Update("last_used_at", time.Now()).Error
+	return row.Publisher, nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func fromDBAPIKey(row dbmodels.PublisherAPIKey) models.APIKey {
+	return models.APIKey{
+		ID:         row.ID,
+		Publisher:  row.Publisher,
+		Prefix:     row.Prefix,
+		CreatedBy:  row.CreatedBy,
+		CreatedAt:  row.CreatedAt,
+		LastUsedAt: row.LastUsedAt,
+		RevokedAt:  row.RevokedAt,
+	}
+}
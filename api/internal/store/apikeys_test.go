@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestAPIKeyPublish(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	key, err := CreateAPIKey(ctx, pool, "acme", "alice")
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	publisher, err := AuthenticateAPIKey(ctx, pool, key.Key)
+	if err != nil || publisher != "acme" {
+		t.Fatalf("expected acme, got %q err=%v", publisher, err)
+	}
+
+	req := models.PublishRequest{
+		ID:          "acme-lights",
+		Name:        "Acme Lights",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "acme-lights"},
+		Image:       "ghcr.io/acme/lights:latest",
+		ListenPath:  "/integrations/acme-lights",
+		Publisher:   publisher,
+	}
+	opts := PublishOptions{TagPrefix: "v", RejectExisting: true, RequirePublisher: publisher}
+	item, err := PublishIntegration(ctx, pool, req, opts)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if item.Verified {
+		t.Fatalf("expected api key release to be unverified")
+	}
+	if _, err := PublishIntegration(ctx, pool, req, opts); err != ErrVersionExists {
+		t.Fatalf("expected ErrVersionExists, got %v", err)
+	}
+	owner, err := GetOwnership(ctx, pool, "acme-lights")
+	if err != nil || owner.Publisher != "acme" || owner.Repository != "" {
+		t.Fatalf("expected acme-lights bound to the acme account, got %+v err=%v", owner, err)
+	}
+
+	// The account, not the publisher name on the releases, owns the id.
+	req.Version = "v0.2.0"
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{TagPrefix: "v", RejectExisting: true, RequirePublisher: "mallory"}); err != ErrPublisherMismatch {
+		t.Fatalf("expected ErrPublisherMismatch for another account, got %v", err)
+	}
+	if err := CheckOwnership(ctx, pool, "acme-lights", PublishOptions{RequirePublisher: "mallory"}); err != ErrPublisherMismatch {
+		t.Fatalf("expected CheckOwnership to refuse another account, got %v", err)
+	}
+	req.Publisher = "mallory"
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{TagPrefix: "v", RejectExisting: true, RequirePublisher: "mallory"}); err != ErrPublisherMismatch {
+		t.Fatalf("expected ErrPublisherMismatch, got %v", err)
+	}
+
+	if _, err := RevokeAPIKey(ctx, pool, key.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := AuthenticateAPIKey(ctx, pool, key.Key); err != ErrInvalidAPIKey {
+		t.Fatalf("expected ErrInvalidAPIKey after revoke, got %v", err)
+	}
+	keys, err := ListAPIKeys(ctx, pool, "acme")
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil || keys[0].Key != "" {
+		t.Fatalf("expected one revoked key without secret, got %+v err=%v", keys, err)
+	}
+}
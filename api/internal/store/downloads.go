@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"gorm.io/gorm"
+)
+
+// DefaultTrendingHalfLife is the trending half-life when none is configured.
+const DefaultTrendingHalfLife = 7 * 24 * time.Hour
+
+// recordDownload stores event unless the same client already downloaded the
+// same release within window. It reports whether the event was stored.
+func recordDownload(tx *gorm.DB, event dbmodels.IntegrationDownloadEvent, window time.Duration, clientsPerIP int) (bool, error) {
+	if event.ClientHash != "" && window > 0 {
+		// Serialise concurrent downloads by one client, or by every client
+		// of one address, so both cannot pass the checks below.
+		lockKey := event.ClientHash
+		if event.IPHash != "" {
+			lockKey = event.IPHash
+		}
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", event.IntegrationID+"\x00"+lockKey).Error; err != nil {
+			return false, err
+		}
+		since := time.Now().Add(-window)
+		var seen int64
+		if err := tx.Model(&dbmodels.IntegrationDownloadEvent{}).
+			Where("integration_id = ? AND version = ? AND client_hash = ? AND created_at >= ?",
+				event.IntegrationID, event.Version, event.ClientHash, since).
+			Count(&seen).Error; err != nil {
+			return false, err
+		}
+		if seen > 0 {
+			return false, nil
+		}
+		if event.IPHash != "" && clientsPerIP > 0 {
+			var clients int64
+			if err := tx.Model(&dbmodels.IntegrationDownloadEvent{}).
+				Where("integration_id = ? AND version = ? AND ip_hash = ? AND created_at >= ?",
+					event.IntegrationID, event.Version, event.IPHash, since).
+				Distinct("client_hash").
+				Count(&clients).Error; err != nil {
+				return false, err
+			}
+			if clients >= int64(clientsPerIP) {
+				return false, nil
+			}
+		}
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// countDownload bumps the total of id and the count of version, so the
+// response reflects the download. The trending score is left to
+// RecomputeDownloads.
+func countDownload(tx *gorm.DB, id, version string) error {
+	if err := tx.Model(&dbmodels.Integration{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"downloads":  gorm.Expr("downloads + ?", 1),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&dbmodels.Release{}).
+		Where("integration_id = ? AND version = ?", id, version).
+		Update("version_downloads", gorm.Expr("version_downloads + ?", 1)).Error
+}
+
+// downloadsSQL yields every download as (integration_id, version, method,
+// at, downloads): one row per recent event plus the daily rollups, dated at
+// midday.
+const downloadsSQL = `
+SELECT integration_id, version, method, created_at AS at, 1 AS downloads FROM integration_download_events
+UNION ALL
+SELECT integration_id, version, method, day + INTERVAL '12 hours', downloads FROM integration_download_daily`
+
+// RecomputeDownloads resets the download counters and trending_score of
+// every integration and release from the stored download events and daily
+// rollups. The trending score counts each download as 0.5^(age/halfLife),
+// so it decays for integrations that stop being downloaded. Only one replica
+// recomputes at a time; the others skip the tick.
+func RecomputeDownloads(ctx context.Context, db *gorm.DB, halfLife time.Duration) error {
+	if halfLife <= 0 {
+		halfLife = DefaultTrendingHalfLife
+	}
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	locked, err := tryWorkerLock(tx, "download recompute")
+	if err != nil || !locked {
+		tx.Rollback()
+		return err
+	}
+	// Downloads of removed versions, or recorded before versions were
+	// tracked, still count towards the integration total.
+	if err := tx.Exec(`
+UPDATE integrations AS i
+SET downloads = c.total, trending_score = c.score
+FROM (
+  SELECT l.id,
+    COALESCE(SUM(d.downloads), 0) AS total,
+    COALESCE(SUM(d.downloads * power(0.5, GREATEST(EXTRACT(EPOCH FROM (now() - d.at)), 0) / ?)), 0) AS score
+  FROM integrations AS l
+  LEFT JOIN (`+downloadsSQL+`) AS d ON d.integration_id = l.id
+  GROUP BY l.id
+) AS c
+WHERE i.id = c.id AND (i.downloads <> c.total OR i.trending_score <> c.score)
+`, halfLife.Seconds()).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Exec(`
+UPDATE integration_releases AS r
+SET version_downloads = c.total
+FROM (
+  SELECT l.integration_id, l.version, COALESCE(SUM(d.downloads), 0) AS total
+  FROM integration_releases AS l
+  LEFT JOIN (` + downloadsSQL + `) AS d ON d.integration_id = l.integration_id AND d.version = l.version
+  GROUP BY l.integration_id, l.version
+) AS c
+WHERE r.integration_id = c.integration_id AND r.version = c.version AND r.version_downloads <> c.total
+`).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := snapshotRankings(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// RankingSnapshotTTL is how long a superseded ranking snapshot is kept, and
+// so how long a downloads or trending cursor stays valid.
+const RankingSnapshotTTL = time.Hour
+
+// snapshotRankings records the current counters of every integration as a
+// new ranking snapshot and prunes expired ones. The newest snapshot is never
+// pruned.
+func snapshotRankings(tx *gorm.DB) error {
+	snapshot := dbmodels.DownloadRankingSnapshot{}
+	if err := tx.Create(&snapshot).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`
+INSERT INTO download_rankings (snapshot_id, integration_id, downloads, trending_score)
+SELECT ?, id, downloads, trending_score FROM integrations
+`, snapshot.ID).Error; err != nil {
+		return err
+	}
+	return tx.Where("id <> ? AND created_at < ?", snapshot.ID, time.Now().Add(-RankingSnapshotTTL)).
+		Delete(&dbmodels.DownloadRankingSnapshot{}).Error
+}
+
+// rankingSnapshot is the snapshot a downloads or trending listing pages
+// against: the cursor's, or the newest for a first page. 0 means no snapshot
+// has been taken yet, and every integration ranks by its live counters.
+func rankingSnapshot(ctx context.Context, db *gorm.DB, cursor *pageCursor) (uint, error) {
+	if cursor != nil {
+		if cursor.Snapshot == 0 {
+			return 0, nil
+		}
+		var count int64
+		if err := db.WithContext(ctx).Model(&dbmodels.DownloadRankingSnapshot{}).
+			Where("id = ?", cursor.Snapshot).
+			Count(&count).Error; err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			return 0, ErrInvalidCursor
+		}
+		return cursor.Snapshot, nil
+	}
+	var latest uint
+	if err := db.WithContext(ctx).Model(&dbmodels.DownloadRankingSnapshot{}).
+		Select("COALESCE(MAX(id), 0)").
+		Scan(&latest).Error; err != nil {
+		return 0, err
+	}
+	return latest, nil
+}
+
+// RollupDownloadEvents folds download events from UTC days before the one
+// containing before into integration_download_daily and deletes them. The
+// events are deleted and rolled up by one statement, so a concurrent rollup
+// can never count them twice.
+func RollupDownloadEvents(ctx context.Context, db *gorm.DB, before time.Time) error {
+	before = truncateInterval(before, IntervalDay)
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	locked, err := tryWorkerLock(tx, "download rollup")
+	if err != nil || !locked {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Exec(`
+WITH moved AS (
+  DELETE FROM integration_download_events
+  WHERE created_at < ?
+  RETURNING integration_id, version, method, created_at
+)
+INSERT INTO integration_download_daily (integration_id, version, method, day, downloads)
+SELECT integration_id, version, method, date_trunc('day', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC', COUNT(*)
+FROM moved
+GROUP BY 1, 2, 3, 4
+ON CONFLICT (integration_id, version, method, day)
+DO UPDATE SET downloads = integration_download_daily.downloads + EXCLUDED.downloads
+`, before).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// tryWorkerLock takes the transaction-scoped advisory lock of a background
+// job. It reports false when another replica holds it, in which case that
+// replica does this tick's work.
+func tryWorkerLock(tx *gorm.DB, job string) (bool, error) {
+	var locked bool
+	if err := tx.Raw("SELECT pg_try_advisory_xact_lock(hashtext(?))", "worker:"+job).Scan(&locked).Error; err != nil {
+		return false, err
+	}
+	return locked, nil
+}
@@ -11,6 +11,8 @@ import (
 
 	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/sbom"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -18,42 +20,195 @@ import (
 
 var ErrListenPathInUse = errors.New("listen_path already in use")
 var ErrNameInUse = errors.New("name already in use")
+var ErrInvalidVersion = errors.New("version must be a semantic version")
+var ErrVersionExists = errors.New("version already published")
+var ErrPublisherMismatch = errors.New("integration belongs to another publisher")
+
+type PublishOptions struct {
+	Verified bool
+	// TagPrefix is stripped from the version before it is parsed as semver.
+	TagPrefix string
+	// PrereleaseLatest lets a prerelease become the latest version.
+	PrereleaseLatest bool
+	// RejectExisting refuses to overwrite an already published (id, version).
+	RejectExisting bool
+	// RequirePublisher, when set, claims unowned ids for the publisher
+	// account and refuses ids owned by another account or a repository.
+	RequirePublisher string
+	// OwnerRepository, when set, claims unowned ids for the repository and
+	// refuses ids owned by another repository.
+	OwnerRepository string
+	// ImageDigest is the registry digest the image resolved to at publish time.
+	ImageDigest string
+	// Attestations records the signature and provenance checks that passed.
+	Attestations models.Attestations
+	// SBOM replaces the release's stored SBOM; nil removes it.
+	SBOM *sbom.Document
+}
+
+const (
+	DeploymentCompose      = "compose"
+	DeploymentHelm         = "helm"
+	DeploymentK8sGenerated = "k8s_generated"
+)
 
-func ListIntegrations(ctx context.Context, db *gorm.DB, latestOnly bool, sortBy string, featuredOnly bool) ([]models.Integration, error) {
-	query := db.WithContext(ctx).Model(&dbmodels.Integration{})
-	if latestOnly {
+type ListOptions struct {
+	Page
+	LatestOnly   bool
+	FeaturedOnly bool
+	// IncludeYanked keeps yanked releases when listing all versions.
+	IncludeYanked bool
+	SortBy        string
+	Query         string
+	Publisher     string
+	Verified      *bool
+	Deployment    string
+	Tags          []string
+}
+
+func IsDeploymentKind(kind string) bool {
+	switch kind {
+	case DeploymentCompose, DeploymentHelm, DeploymentK8sGenerated:
+		return true
+	}
+	return false
+}
+
+func ListIntegrations(ctx context.Context, db *gorm.DB, opts ListOptions) ([]models.Integration, string, error) {
+	query := db.WithContext(ctx).Model(&dbmodels.IntegrationVersion{})
+	if opts.LatestOnly {
 		query = query.Where("latest = ?", true)
 	}
-	if featuredOnly {
+	if opts.FeaturedOnly {
 		query = query.Where("featured = ?", true)
 	}
+	if !opts.IncludeYanked {
+		query = query.Where("yanked = ?", false)
+	}
+
+	search := strings.TrimSpace(opts.Query)
+	if search != "" {
+		query = query.Where("search_vector @@ websearch_to_tsquery('english', ?)", search)
+	}
+	if publisher := strings.TrimSpace(opts.Publisher); publisher != "" {
+		query = query.Where("LOWER(publisher) = LOWER(?)", publisher)
+	}
+	if opts.Verified != nil {
+		query = query.Where("verified = ?", *opts.Verified)
+	}
+	switch opts.Deployment {
+	case DeploymentCompose:
+		query = query.Where("(compose_file <> '' OR COALESCE(deployment->'compose'->>'file', '') <> '')")
+	case DeploymentHelm:
+		query = query.Where("COALESCE(deployment->'helm'->>'chart_ref', '') <> ''")
+	case DeploymentK8sGenerated:
+		query = query.Where("COALESCE(deployment->'k8s_generated'->>'chart_ref', '') <> ''")
+	}
+	if tags := normalizeTags(opts.Tags); len(tags) > 0 {
+		tagsJSON, err := json.Marshal(tags)
+		if err != nil {
+			return nil, "", err
+		}
+		query = query.Where("COALESCE(manifest->'tags', '[]'::jsonb) @> ?::jsonb", string(tagsJSON))
+	}
 
-	switch strings.ToLower(strings.TrimSpace(sortBy)) {
+	sortMode := strings.ToLower(strings.TrimSpace(opts.SortBy))
+	var columns []sortColumn
+	switch sortMode {
 	case "downloads":
-		query = query.Order("downloads DESC, name ASC")
+		columns = []sortColumn{sortByDownloads, sortByName, sortByID, sortByVersion}
 	case "trending":
-		query = query.Order("trending_score DESC, name ASC")
+		columns = []sortColumn{sortByTrending, sortByName, sortByID, sortByVersion}
 	case "version":
-		query = query.Order("version DESC")
+		columns = []sortColumn{sortByVersionKey, sortByID, sortByVersionDesc}
+	case "relevance":
+		if search != "" {
+			columns = []sortColumn{sortByRank, sortByName, sortByID, sortByVersion}
+			query = query.Select("integration_versions.*, ts_rank(search_vector, websearch_to_tsquery('english', ?)) AS search_rank", search)
+			break
+		}
+		fallthrough
 	default:
-		query = query.Order("name ASC")
+		sortMode = "name"
+		columns = []sortColumn{sortByName, sortByID, sortByVersion}
 	}
 
-	rows := []dbmodels.Integration{}
-	if err := query.Find(&rows).Error; err != nil {
-		return nil, err
+	cursor, err := decodeCursor(opts.Cursor, sortMode)
+	if err != nil {
+		return nil, "", err
 	}
-	return mapIntegrations(rows), nil
+	var snapshot uint
+	if sortMode == "downloads" || sortMode == "trending" {
+		if snapshot, err = rankingSnapshot(ctx, db, cursor); err != nil {
+			return nil, "", err
+		}
+		// Ids missing from the snapshot, or every id before the first
+		// snapshot, rank by their live counters.
+		query = query.
+			Select(`integration_versions.*,
+  COALESCE(rk.downloads, integration_versions.downloads) AS ranked_downloads,
+  COALESCE(rk.trending_score, integration_versions.trending_score) AS ranked_trending`).
+			Joins("LEFT JOIN download_rankings AS rk ON rk.integration_id = integration_versions.id AND rk.snapshot_id = ?", snapshot)
+	}
+	limit := opts.limit()
+	outer := applyKeyset(db.WithContext(ctx).Table("(?) AS integrations", query), columns, cursor)
+
+	rows := []listRow{}
+	if err := outer.Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next := cursorFromRow(sortMode, rows[len(rows)-1])
+		next.Snapshot = snapshot
+		nextCursor = encodeCursor(next)
+	}
+	out := make([]models.Integration, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, fromDBIntegration(row.IntegrationVersion))
+	}
+	return out, nextCursor, nil
+}
+
+type listRow struct {
+	dbmodels.IntegrationVersion
+	SearchRank      float64
+	RankedDownloads int64
+	RankedTrending  float64
+}
+
+func cursorFromRow(sortMode string, row listRow) pageCursor {
+	return pageCursor{
+		Sort:       sortMode,
+		SearchRank: row.SearchRank,
+		Downloads:  row.RankedDownloads,
+		Trending:   row.RankedTrending,
+		Name:       row.Name,
+		VersionKey: row.VersionKey,
+		ID:         row.ID,
+		Version:    row.Version,
+	}
+}
+
+func normalizeTags(tags []string) []string {
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if v := strings.TrimSpace(tag); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
 }
 
 func GetIntegration(ctx context.Context, db *gorm.DB, id string, version string) (*models.Integration, error) {
-	query := db.WithContext(ctx).Model(&dbmodels.Integration{}).Where("id = ?", id)
+	query := db.WithContext(ctx).Model(&dbmodels.IntegrationVersion{}).Where("id = ?", id)
 	if version != "" {
 		query = query.Where("version = ?", version)
 	} else {
 		query = query.Where("latest = ?", true)
 	}
-	var item dbmodels.Integration
+	var item dbmodels.IntegrationVersion
 	if err := query.First(&item).Error; err != nil {
 		return nil, err
 	}
@@ -61,19 +216,62 @@ func GetIntegration(ctx context.Context, db *gorm.DB, id string, version string)
 	return &result, nil
 }
 
-func ListVersions(ctx context.Context, db *gorm.DB, id string) ([]models.Integration, error) {
-	rows := []dbmodels.Integration{}
-	if err := db.WithContext(ctx).
-		Model(&dbmodels.Integration{}).
-		Where("id = ?", id).
-		Order("created_at DESC").
-		Find(&rows).Error; err != nil {
-		return nil, err
+func ListVersions(ctx context.Context, db *gorm.DB, id string, page Page) ([]models.Integration, string, error) {
+	const sortMode = "version"
+	cursor, err := decodeCursor(page.Cursor, sortMode)
+	if err != nil {
+		return nil, "", err
 	}
-	return mapIntegrations(rows), nil
+	limit := page.limit()
+	query := db.WithContext(ctx).
+		Model(&dbmodels.IntegrationVersion{}).
+		Where("id = ?", id)
+	query = applyKeyset(query, []sortColumn{sortByVersionKey, sortByVersionDesc}, cursor)
+
+	rows := []dbmodels.IntegrationVersion{}
+	if err := query.Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if len(rows) > limit {
+		rows = rows[:limit]
+		nextCursor = encodeCursor(cursorFromRow(sortMode, listRow{IntegrationVersion: rows[len(rows)-1]}))
+	}
+	return mapIntegrations(rows), nextCursor, nil
+}
+
+// DownloadOptions describe the install being counted.
+type DownloadOptions struct {
+	// Version defaults to the latest release.
+	Version string
+	// Method is one of the Install* methods, or empty when unknown.
+	Method string
+	// ClientHash identifies the installing client. A second download of the
+	// same version by the same client within DedupWindow is not counted.
+	ClientHash  string
+	DedupWindow time.Duration
+	// IPHash identifies the address the client reports from. Within
+	// DedupWindow, at most ClientsPerIP clients from one address are counted
+	// per version; 0 removes the cap.
+	IPHash       string
+	ClientsPerIP int
+}
+
+const (
+	InstallCompose = "compose"
+	InstallHelm    = "helm"
+	InstallK8s     = "k8s"
+)
+
+func IsInstallMethod(method string) bool {
+	switch method {
+	case InstallCompose, InstallHelm, InstallK8s:
+		return true
+	}
+	return false
 }
 
-func IncrementDownloads(ctx context.Context, db *gorm.DB, id string) (*models.Integration, error) {
+func IncrementDownloads(ctx context.Context, db *gorm.DB, id string, opts DownloadOptions) (*models.Integration, error) {
 	tx := db.WithContext(ctx).Begin()
 	if tx.Error != nil {
 		return nil, tx.Error
@@ -84,32 +282,33 @@ func IncrementDownloads(ctx context.Context, db *gorm.DB, id string) (*models.In
 		}
 	}()
 
-	if err := tx.Create(&dbmodels.IntegrationDownloadEvent{IntegrationID: id}).Error; err != nil {
-		tx.Rollback()
-		return nil, err
+	release := tx.Model(&dbmodels.IntegrationVersion{}).Select("version").Where("id = ?", id)
+	if opts.Version != "" {
+		release = release.Where("version = ?", opts.Version)
+	} else {
+		release = release.Where("latest = ? AND yanked = ?", true, false)
 	}
-
-	var downloads7d int64
-	if err := tx.Model(&dbmodels.IntegrationDownloadEvent{}).
-		Where("integration_id = ? AND created_at >= ?", id, time.Now().Add(-7*24*time.Hour)).
-		Count(&downloads7d).Error; err != nil {
+	var version string
+	if err := release.Take(&version).Error; err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	if err := tx.Model(&dbmodels.Integration{}).
-		Where("id = ? AND latest = ?", id, true).
-		Updates(map[string]any{
-			"downloads":      gorm.Expr("downloads + ?", 1),
-			"trending_score": float64(downloads7d),
-			"updated_at":     time.Now(),
-		}).Error; err != nil {
+	event := dbmodels.IntegrationDownloadEvent{IntegrationID: id, Version: version, Method: opts.Method, ClientHash: opts.ClientHash, IPHash: opts.IPHash}
+	counted, err := recordDownload(tx, event, opts.DedupWindow, opts.ClientsPerIP)
+	if err != nil {
 		tx.Rollback()
 		return nil, err
 	}
+	if counted {
+		if err := countDownload(tx, id, version); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
 
-	var item dbmodels.Integration
-	if err := tx.Where("id = ? AND latest = ?", id, true).First(&item).Error; err != nil {
+	var item dbmodels.IntegrationVersion
+	if err := tx.Where("id = ? AND version = ?", id, version).First(&item).Error; err != nil {
 		tx.Rollback()
 		return nil, err
 	}
@@ -122,12 +321,16 @@ func IncrementDownloads(ctx context.Context, db *gorm.DB, id string) (*models.In
 	return &result, nil
 }
 
-func PublishIntegration(ctx context.Context, db *gorm.DB, req models.PublishRequest, verified bool) (*models.Integration, error) {
+func PublishIntegration(ctx context.Context, db *gorm.DB, req models.PublishRequest, opts PublishOptions) (*models.Integration, error) {
 	if req.ListenPath == "" {
 		return nil, errors.New("listen_path is required")
 	}
+	version, err := semver.Parse(req.Version, opts.TagPrefix)
+	if err != nil {
+		return nil, ErrInvalidVersion
+	}
 
-	log.Printf("store publish integration id=%q version=%q listen_path=%q verified=%t", req.ID, req.Version, req.ListenPath, verified)
+	log.Printf("store publish integration id=%q version=%q listen_path=%q verified=%t", req.ID, req.Version, req.ListenPath, opts.Verified)
 
 	if err := ensureListenPathAvailable(ctx, db, req.ListenPath, req.ID); err != nil {
 		return nil, err
@@ -152,11 +355,16 @@ func PublishIntegration(ctx context.Context, db *gorm.DB, req models.PublishRequ
 	if err != nil {
 		return nil, fmt.Errorf("deployment_artifacts json invalid: %w", err)
 	}
+	attestationsJSON, err := json.Marshal(opts.Attestations)
+	if err != nil {
+		return nil, fmt.Errorf("attestations json invalid: %w", err)
+	}
 
 	manifestData := datatypes.JSON(manifestJSON)
 	imagesData := datatypes.JSON(imagesJSON)
 	assetsData := datatypes.JSON(assetsJSON)
 	deploymentData := datatypes.JSON(deploymentJSON)
+	attestationsData := datatypes.JSON(attestationsJSON)
 	composeFile := strings.TrimSpace(req.ComposeFile)
 	if composeFile == "" {
 		composeFile = strings.TrimSpace(req.Deployment.Compose.File)
@@ -172,60 +380,82 @@ func PublishIntegration(ctx context.Context, db *gorm.DB, req models.PublishRequ
 		}
 	}()
 
-	if err := tx.Model(&dbmodels.Integration{}).Where("id = ?", req.ID).Update("latest", false).Error; err != nil {
-		tx.Rollback()
-		return nil, err
+	if opts.RejectExisting {
+		var existing int64
+		if err := tx.Model(&dbmodels.Release{}).
+			Where("integration_id = ? AND version = ?", req.ID, req.Version).
+			Count(&existing).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if existing > 0 {
+			tx.Rollback()
+			return nil, ErrVersionExists
+		}
 	}
 
-	stats := integrationStats{Downloads: 0, TrendingScore: 0, Featured: false}
-	if current, err := getLatestStats(ctx, db, req.ID); err == nil && current != nil {
-		stats = *current
+	if opts.OwnerRepository != "" {
+		if err := claimOwnership(tx, req.ID, opts.OwnerRepository); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	} else if opts.RequirePublisher != "" {
+		if err := claimPublisher(tx, req.ID, opts.RequirePublisher); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
 	}
 
-	record := dbmodels.Integration{
-		ID:            req.ID,
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at"}),
+	}).Create(&dbmodels.Integration{ID: req.ID, Name: req.Name}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	record := dbmodels.Release{
+		IntegrationID: req.ID,
 		Version:       req.Version,
-		Name:          req.Name,
+		VersionKey:    version.Key(),
+		Prerelease:    version.IsPrerelease(),
 		Description:   req.Description,
 		ManifestURL:   req.ManifestURL,
 		Manifest:      manifestData,
 		Image:         req.Image,
+		ImageDigest:   opts.ImageDigest,
 		Images:        imagesData,
 		Assets:        assetsData,
 		ListenPath:    req.ListenPath,
 		ComposeFile:   composeFile,
 		Deployment:    deploymentData,
+		Attestations:  attestationsData,
 		RepoURL:       req.RepoURL,
 		ReleaseTag:    req.ReleaseTag,
 		Publisher:     req.Publisher,
-		Verified:      verified,
-		Latest:        true,
-		Downloads:     stats.Downloads,
-		TrendingScore: stats.TrendingScore,
-		Featured:      stats.Featured,
+		Verified:      opts.Verified,
 	}
 
 	if err := tx.Clauses(clause.OnConflict{
-		Columns: []clause.Column{{Name: "id"}, {Name: "version"}},
+		Columns: []clause.Column{{Name: "integration_id"}, {Name: "version"}},
 		DoUpdates: clause.AssignmentColumns([]string{
-			"name",
+			"version_key",
+			"prerelease",
 			"description",
 			"manifest_url",
 			"manifest",
 			"image",
+			"image_digest",
 			"images",
 			"assets",
 			"listen_path",
 			"compose_file",
 			"deployment",
+			"attestations",
 			"repo_url",
 			"release_tag",
 			"publisher",
 			"verified",
-			"downloads",
-			"trending_score",
-			"featured",
-			"latest",
 			"updated_at",
 		}),
 	}).Create(&record).Error; err != nil {
@@ -233,6 +463,16 @@ func PublishIntegration(ctx context.Context, db *gorm.DB, req models.PublishRequ
 		return nil, err
 	}
 
+	if err := saveSBOM(tx, req.ID, req.Version, opts.SBOM); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := refreshLatest(tx, req.ID, opts.PrereleaseLatest, req.Version, req.Name); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return nil, err
 	}
@@ -245,11 +485,47 @@ func PublishIntegration(ctx context.Context, db *gorm.DB, req models.PublishRequ
 	return item, nil
 }
 
+// refreshLatest points id at its highest non-yanked semver release, so
+// publishing an older hotfix does not displace a newer release and yanking
+// falls back to the previous good one. Unless includePrerelease is set,
+// prereleases are only picked when there is no stable release. When every
+// release is yanked the highest yanked one stays latest, so the integration
+// keeps its listen path and name; it is still hidden from listings and
+// resolution. Without any release the pointer is cleared. The integration is
+// renamed to name only when published, the version just published, becomes
+// latest, so an older hotfix never renames it; other callers pass "".
+func refreshLatest(tx *gorm.DB, id string, includePrerelease bool, published, name string) error {
+	order := "version_key DESC, version DESC"
+	if !includePrerelease {
+		order = "prerelease ASC, " + order
+	}
+	var latest dbmodels.Release
+	updates := map[string]any{"latest_version": nil}
+	err := tx.Model(&dbmodels.Release{}).
+		Select("version", "listen_path").
+		Where("integration_id = ?", id).
+		Order("yanked ASC, " + order).
+		Take(&latest).Error
+	switch {
+	case err == nil:
+		updates["latest_version"] = latest.Version
+		updates["listen_path"] = latest.ListenPath
+		if published != "" && name != "" && latest.Version == published {
+			updates["name"] = name
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+	return tx.Model(&dbmodels.Integration{}).
+		Where("id = ?", id).
+		Updates(updates).Error
+}
+
 func ensureListenPathAvailable(ctx context.Context, db *gorm.DB, listenPath, id string) error {
 	var count int64
 	if err := db.WithContext(ctx).
 		Model(&dbmodels.Integration{}).
-		Where("listen_path = ? AND latest = ? AND id <> ?", listenPath, true, id).
+		Where("listen_path = ? AND latest_version IS NOT NULL AND id <> ?", listenPath, id).
 		Count(&count).Error; err != nil {
 		return err
 	}
@@ -263,7 +539,7 @@ func ensureNameAvailable(ctx context.Context, db *gorm.DB, name, id string) erro
 	var count int64
 	if err := db.WithContext(ctx).
 		Model(&dbmodels.Integration{}).
-		Where("name = ? AND latest = ? AND id <> ?", name, true, id).
+		Where("name = ? AND latest_version IS NOT NULL AND id <> ?", name, id).
 		Count(&count).Error; err != nil {
 		return err
 	}
@@ -273,25 +549,7 @@ func ensureNameAvailable(ctx context.Context, db *gorm.DB, name, id string) erro
 	return nil
 }
 
-type integrationStats struct {
-	Downloads     int64
-	TrendingScore float64
-	Featured      bool
-}
-
-func getLatestStats(ctx context.Context, db *gorm.DB, id string) (*integrationStats, error) {
-	var stats integrationStats
-	if err := db.WithContext(ctx).
-		Model(&dbmodels.Integration{}).
-		Select("downloads", "trending_score", "featured").
-		Where("id = ? AND latest = ?", id, true).
-		Take(&stats).Error; err != nil {
-		return nil, err
-	}
-	return &stats, nil
-}
-
-func mapIntegrations(rows []dbmodels.Integration) []models.Integration {
+func mapIntegrations(rows []dbmodels.IntegrationVersion) []models.Integration {
 	out := make([]models.Integration, 0, len(rows))
 	for _, row := range rows {
 		out = append(out, fromDBIntegration(row))
@@ -299,27 +557,44 @@ func mapIntegrations(rows []dbmodels.Integration) []models.Integration {
 	return out
 }
 
-func fromDBIntegration(row dbmodels.Integration) models.Integration {
+// pinnedImage appends the verified digest so hosts pull exactly the image
+// that was checked at publish time.
+func pinnedImage(image, digest string) string {
+	if digest == "" || strings.Contains(image, "@") {
+		return image
+	}
+	return image + "@" + digest
+}
+
+func fromDBIntegration(row dbmodels.IntegrationVersion) models.Integration {
 	item := models.Integration{
-		ID:          row.ID,
-		Name:        row.Name,
-		Version:     row.Version,
-		Description: row.Description,
-		ManifestURL: row.ManifestURL,
-		Image:       row.Image,
-		ListenPath:  row.ListenPath,
-		ComposeFile: row.ComposeFile,
-		Deployment:  models.DeploymentArtifacts{},
-		RepoURL:     row.RepoURL,
-		ReleaseTag:  row.ReleaseTag,
-		Publisher:   row.Publisher,
-		Verified:    row.Verified,
-		Latest:      row.Latest,
-		Downloads:   row.Downloads,
-		Trending:    row.TrendingScore,
-		Featured:    row.Featured,
-		CreatedAt:   row.CreatedAt,
-		UpdatedAt:   row.UpdatedAt,
+		ID:                 row.ID,
+		Name:               row.Name,
+		Version:            row.Version,
+		Description:        row.Description,
+		ManifestURL:        row.ManifestURL,
+		Image:              pinnedImage(row.Image, row.ImageDigest),
+		ImageDigest:        row.ImageDigest,
+		ListenPath:         row.ListenPath,
+		ComposeFile:        row.ComposeFile,
+		Deployment:         models.DeploymentArtifacts{},
+		RepoURL:            row.RepoURL,
+		ReleaseTag:         row.ReleaseTag,
+		Publisher:          row.Publisher,
+		Verified:           row.Verified,
+		Latest:             row.Latest,
+		Prerelease:         row.Prerelease,
+		Yanked:             row.Yanked,
+		YankReason:         row.YankReason,
+		YankedAt:           row.YankedAt,
+		Deprecated:         row.Deprecated,
+		DeprecationMessage: row.DeprecationMessage,
+		Downloads:          row.Downloads,
+		VersionDownloads:   row.VersionDownloads,
+		Trending:           row.TrendingScore,
+		Featured:           row.Featured,
+		CreatedAt:          row.CreatedAt,
+		UpdatedAt:          row.UpdatedAt,
 	}
 	if len(row.Manifest) > 0 {
 		_ = json.Unmarshal(row.Manifest, &item.Manifest)
@@ -333,6 +608,9 @@ func fromDBIntegration(row dbmodels.Integration) models.Integration {
 	if len(row.Deployment) > 0 {
 		_ = json.Unmarshal(row.Deployment, &item.Deployment)
 	}
+	if len(row.Attestations) > 0 {
+		_ = json.Unmarshal(row.Attestations, &item.Attestations)
+	}
 	if strings.TrimSpace(item.Deployment.Compose.File) == "" && strings.TrimSpace(item.ComposeFile) != "" {
 		item.Deployment.Compose.File = strings.TrimSpace(item.ComposeFile)
 	}
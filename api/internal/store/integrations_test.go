@@ -2,7 +2,9 @@ package store
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
 	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
@@ -33,7 +35,7 @@ func TestPublishIntegrationAndLatest(t *testing.T) {
 	baseReq.Deployment.Helm.ChartRef = "oci://ghcr.io/petoadam/homenavi-spotify"
 	baseReq.Deployment.Helm.Version = "v0.1.0"
 
-	item, err := PublishIntegration(ctx, pool, baseReq, true)
+	item, err := PublishIntegration(ctx, pool, baseReq, PublishOptions{Verified: true})
 	if err != nil {
 		t.Fatalf("publish v0.1.0: %v", err)
 	}
@@ -44,7 +46,8 @@ func TestPublishIntegrationAndLatest(t *testing.T) {
 	baseReq.Version = "v0.2.0"
 	baseReq.ReleaseTag = "v0.2.0"
 	baseReq.Deployment.Helm.Version = "v0.2.0"
-	item2, err := PublishIntegration(ctx, pool, baseReq, true)
+	digest := "sha256:" + strings.Repeat("b", 64)
+	item2, err := PublishIntegration(ctx, pool, baseReq, PublishOptions{Verified: true, ImageDigest: digest})
 	if err != nil {
 		t.Fatalf("publish v0.2.0: %v", err)
 	}
@@ -59,11 +62,14 @@ func TestPublishIntegrationAndLatest(t *testing.T) {
 	if latest.Version != "v0.2.0" {
 		t.Fatalf("expected latest version v0.2.0, got %s", latest.Version)
 	}
+	if latest.ImageDigest != digest || latest.Image != "ghcr.io/petoadam/homenavi-spotify:latest@"+digest {
+		t.Fatalf("expected image pinned to %s, got %s", digest, latest.Image)
+	}
 	if latest.Deployment.Helm.ChartRef == "" {
 		t.Fatalf("expected deployment helm chart_ref to be persisted")
 	}
 
-	versions, err := ListVersions(ctx, pool, "spotify")
+	versions, _, err := ListVersions(ctx, pool, "spotify", Page{})
 	if err != nil {
 		t.Fatalf("list versions: %v", err)
 	}
@@ -95,13 +101,352 @@ func TestListenPathUnique(t *testing.T) {
 	}
 	req.Deployment.Compose.File = req.ComposeFile
 
-	if _, err := PublishIntegration(ctx, pool, req, true); err != nil {
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true}); err != nil {
 		t.Fatalf("publish initial: %v", err)
 	}
 
 	req.ID = "alt-spotify"
 	req.Version = "v0.1.0"
-	if _, err := PublishIntegration(ctx, pool, req, true); err == nil {
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true}); err == nil {
 		t.Fatalf("expected listen_path conflict")
 	}
 }
+
+func TestListIntegrationsSearchAndFilters(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	spotify := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		Description: "Play music from your Spotify account",
+		ManifestURL: "https://example.com/spotify/manifest.json",
+		Manifest:    map[string]any{"id": "spotify", "tags": []string{"media", "music"}},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+		ComposeFile: "https://example.com/spotify/docker-compose.integration.yml",
+		Publisher:   "Homenavi",
+	}
+	spotify.Deployment.Compose.File = spotify.ComposeFile
+	if _, err := PublishIntegration(ctx, pool, spotify, PublishOptions{Verified: true}); err != nil {
+		t.Fatalf("publish spotify: %v", err)
+	}
+
+	hue := models.PublishRequest{
+		ID:          "hue",
+		Name:        "Philips Hue",
+		Version:     "v0.1.0",
+		Description: "Control smart lights",
+		ManifestURL: "https://example.com/hue/manifest.json",
+		Manifest:    map[string]any{"id": "hue", "tags": []string{"lighting"}},
+		Image:       "ghcr.io/example/homenavi-hue:latest",
+		ListenPath:  "/integrations/hue",
+		Publisher:   "Community",
+	}
+	hue.Deployment.Helm.ChartRef = "oci://ghcr.io/example/homenavi-hue"
+	if _, err := PublishIntegration(ctx, pool, hue, PublishOptions{}); err != nil {
+		t.Fatalf("publish hue: %v", err)
+	}
+
+	items, _, err := ListIntegrations(ctx, pool, ListOptions{LatestOnly: true, Query: "music", SortBy: "relevance"})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != "spotify" {
+		t.Fatalf("expected spotify for q=music, got %+v", items)
+	}
+
+	verified := false
+	items, _, err = ListIntegrations(ctx, pool, ListOptions{LatestOnly: true, Verified: &verified})
+	if err != nil {
+		t.Fatalf("verified filter: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != "hue" {
+		t.Fatalf("expected hue for verified=false, got %+v", items)
+	}
+
+	items, _, err = ListIntegrations(ctx, pool, ListOptions{LatestOnly: true, Deployment: DeploymentHelm})
+	if err != nil {
+		t.Fatalf("deployment filter: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != "hue" {
+		t.Fatalf("expected hue for deployment=helm, got %+v", items)
+	}
+
+	items, _, err = ListIntegrations(ctx, pool, ListOptions{LatestOnly: true, Publisher: "homenavi", Tags: []string{"music"}})
+	if err != nil {
+		t.Fatalf("publisher/tag filter: %v", err)
+	}
+	if len(items) != 1 || items[0].ID != "spotify" {
+		t.Fatalf("expected spotify for publisher+tag, got %+v", items)
+	}
+}
+
+func TestListIntegrationsCursorPagination(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	for _, id := range []string{"alpha", "bravo", "charlie"} {
+		req := models.PublishRequest{
+			ID:          id,
+			Name:        id,
+			Version:     "v0.1.0",
+			ManifestURL: "https://example.com/" + id + "/manifest.json",
+			Manifest:    map[string]any{"id": id},
+			Image:       "ghcr.io/example/" + id + ":latest",
+			ListenPath:  "/integrations/" + id,
+		}
+		if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true}); err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+	}
+	if _, err := IncrementDownloads(ctx, pool, "charlie", DownloadOptions{}); err != nil {
+		t.Fatalf("increment downloads: %v", err)
+	}
+	if err := RecomputeDownloads(ctx, pool, time.Hour); err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+
+	first, cursor, err := ListIntegrations(ctx, pool, ListOptions{LatestOnly: true, SortBy: "downloads", Page: Page{Limit: 2}})
+	if err != nil {
+		t.Fatalf("list first page: %v", err)
+	}
+	if len(first) != 2 || first[0].ID != "charlie" || cursor == "" {
+		t.Fatalf("unexpected first page: %+v cursor=%q", first, cursor)
+	}
+
+	// Downloads and a recompute landing mid-scan must not make the next page
+	// skip or repeat items.
+	for _, id := range []string{"alpha", "bravo", "bravo"} {
+		if _, err := IncrementDownloads(ctx, pool, id, DownloadOptions{}); err != nil {
+			t.Fatalf("increment downloads: %v", err)
+		}
+	}
+	if err := RecomputeDownloads(ctx, pool, time.Hour); err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+
+	second, next, err := ListIntegrations(ctx, pool, ListOptions{LatestOnly: true, SortBy: "downloads", Page: Page{Limit: 2, Cursor: cursor}})
+	if err != nil {
+		t.Fatalf("list second page: %v", err)
+	}
+	if len(second) != 1 || second[0].ID != "bravo" || next != "" {
+		t.Fatalf("unexpected second page: %+v next=%q", second, next)
+	}
+	fresh, _, err := ListIntegrations(ctx, pool, ListOptions{LatestOnly: true, SortBy: "downloads", Page: Page{Limit: 1}})
+	if err != nil {
+		t.Fatalf("list fresh page: %v", err)
+	}
+	if len(fresh) != 1 || fresh[0].ID != "bravo" {
+		t.Fatalf("expected a new scan to use the latest counters, got %+v", fresh)
+	}
+
+	if _, _, err := ListIntegrations(ctx, pool, ListOptions{LatestOnly: true, SortBy: "name", Page: Page{Cursor: cursor}}); err != ErrInvalidCursor {
+		t.Fatalf("expected invalid cursor for mismatched sort, got %v", err)
+	}
+}
+
+func TestListIntegrationsByDownloadsBeforeRecompute(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	publish := func(id string, downloads int) {
+		t.Helper()
+		req := models.PublishRequest{
+			ID:          id,
+			Name:        id,
+			Version:     "v0.1.0",
+			ManifestURL: "https://example.com/" + id + "/manifest.json",
+			Manifest:    map[string]any{"id": id},
+			Image:       "ghcr.io/example/" + id + ":latest",
+			ListenPath:  "/integrations/" + id,
+		}
+		if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true}); err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+		for i := 0; i < downloads; i++ {
+			if _, err := IncrementDownloads(ctx, pool, id, DownloadOptions{}); err != nil {
+				t.Fatalf("increment downloads: %v", err)
+			}
+		}
+	}
+	ranked := func() []string {
+		t.Helper()
+		items, _, err := ListIntegrations(ctx, pool, ListOptions{LatestOnly: true, SortBy: "downloads"})
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		ids := make([]string, 0, len(items))
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	// No snapshot has been taken yet.
+	publish("alpha", 0)
+	publish("bravo", 1)
+	if got := strings.Join(ranked(), ","); got != "bravo,alpha" {
+		t.Fatalf("expected live counters before any recompute, got %s", got)
+	}
+
+	// charlie is published after the snapshot.
+	if err := RecomputeDownloads(ctx, pool, time.Hour); err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+	publish("charlie", 2)
+	if got := strings.Join(ranked(), ","); got != "charlie,bravo,alpha" {
+		t.Fatalf("expected an id missing from the snapshot ranked by live counters, got %s", got)
+	}
+}
+
+func TestPublishIntegrationLatestFollowsSemver(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	opts := PublishOptions{Verified: true, TagPrefix: "v"}
+	for _, version := range []string{"v0.2.0", "v0.10.0", "v0.1.9", "v0.11.0-rc.1"} {
+		req.Version = version
+		if _, err := PublishIntegration(ctx, pool, req, opts); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+
+	latest, err := GetIntegration(ctx, pool, "spotify", "")
+	if err != nil {
+		t.Fatalf("get latest: %v", err)
+	}
+	if latest.Version != "v0.10.0" {
+		t.Fatalf("expected latest v0.10.0, got %s", latest.Version)
+	}
+
+	versions, _, err := ListVersions(ctx, pool, "spotify", Page{})
+	if err != nil {
+		t.Fatalf("list versions: %v", err)
+	}
+	got := make([]string, 0, len(versions))
+	for _, v := range versions {
+		got = append(got, v.Version)
+	}
+	want := []string{"v0.11.0-rc.1", "v0.10.0", "v0.2.0", "v0.1.9"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected versions %v, got %v", want, got)
+	}
+
+	req.Version = "latest"
+	if _, err := PublishIntegration(ctx, pool, req, opts); err != ErrInvalidVersion {
+		t.Fatalf("expected ErrInvalidVersion, got %v", err)
+	}
+}
+
+func TestPublishOlderHotfixKeepsName(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.2.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	opts := PublishOptions{Verified: true, TagPrefix: "v"}
+	if _, err := PublishIntegration(ctx, pool, req, opts); err != nil {
+		t.Fatalf("publish v0.2.0: %v", err)
+	}
+	req.Version = "v0.1.1"
+	req.Name = "Spotify Old"
+	if _, err := PublishIntegration(ctx, pool, req, opts); err != nil {
+		t.Fatalf("publish v0.1.1: %v", err)
+	}
+
+	latest, err := GetIntegration(ctx, pool, "spotify", "")
+	if err != nil {
+		t.Fatalf("get latest: %v", err)
+	}
+	if latest.Version != "v0.2.0" || latest.Name != "Spotify" {
+		t.Fatalf("expected v0.2.0 named Spotify, got %s %q", latest.Version, latest.Name)
+	}
+
+	req.Version = "v0.3.0"
+	req.Name = "Spotify Connect"
+	if _, err := PublishIntegration(ctx, pool, req, opts); err != nil {
+		t.Fatalf("publish v0.3.0: %v", err)
+	}
+	latest, err = GetIntegration(ctx, pool, "spotify", "")
+	if err != nil {
+		t.Fatalf("get latest: %v", err)
+	}
+	if latest.Name != "Spotify Connect" {
+		t.Fatalf("expected the new latest to rename, got %q", latest.Name)
+	}
+}
+
+func TestPrereleaseOnlyIntegrationHasLatest(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	opts := PublishOptions{Verified: true, TagPrefix: "v"}
+	for _, version := range []string{"v1.0.0-rc.1", "v1.0.0-rc.2"} {
+		req.Version = version
+		if _, err := PublishIntegration(ctx, pool, req, opts); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+
+	latest, err := GetIntegration(ctx, pool, "spotify", "")
+	if err != nil || latest.Version != "v1.0.0-rc.2" {
+		t.Fatalf("expected the highest prerelease as latest, got %v %v", latest, err)
+	}
+	items, _, err := ListIntegrations(ctx, pool, ListOptions{LatestOnly: true})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("expected the integration listed, got %+v %v", items, err)
+	}
+
+	other := models.PublishRequest{
+		ID:          "other",
+		Name:        "Other",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "other"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := PublishIntegration(ctx, pool, other, opts); err != ErrListenPathInUse {
+		t.Fatalf("expected listen_path to stay reserved, got %v", err)
+	}
+
+	req.Version = "v0.9.0"
+	if _, err := PublishIntegration(ctx, pool, req, opts); err != nil {
+		t.Fatalf("publish v0.9.0: %v", err)
+	}
+	latest, err = GetIntegration(ctx, pool, "spotify", "")
+	if err != nil || latest.Version != "v0.9.0" {
+		t.Fatalf("expected a stable release to take over latest, got %v %v", latest, err)
+	}
+}
@@ -0,0 +1,364 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotOwner          = errors.New("integration id is owned by another repository")
+	ErrNoPendingTransfer = errors.New("no pending ownership transfer")
+	ErrInvalidRepository = errors.New("repository must be a repository url or owner/name")
+)
+
+// NormalizeRepository returns a lowercase "host/path" repository identity
+// for a repository URL. A bare "owner/name" is taken to be a GitHub
+// repository. It returns "" when the value is not a repository.
+func NormalizeRepository(value string) string {
+	repo := strings.ToLower(strings.TrimSpace(value))
+	if idx := strings.Index(repo, "://"); idx >= 0 {
+		repo = repo[idx+3:]
+	} else if host, _, _ := strings.Cut(repo, "/"); !strings.Contains(host, ".") {
+		repo = "github.com/" + repo
+	}
+	repo = strings.TrimSuffix(strings.TrimSuffix(repo, "/"), ".git")
+	parts := strings.Split(repo, "/")
+	if len(parts) < 3 {
+		return ""
+	}
+	for _, part := range parts {
+		if part == "" {
+			return ""
+		}
+	}
+	return repo
+}
+
+func GetOwnership(ctx context.Context, db *gorm.DB, id string) (*models.Ownership, error) {
+	var owner dbmodels.IntegrationOwner
+	if err := db.WithContext(ctx).Where("integration_id = ?", id).Take(&owner).Error; err != nil {
+		return nil, err
+	}
+	out := models.Ownership{ID: owner.IntegrationID, Repository: owner.Repository, Publisher: owner.Publisher}
+	var pending dbmodels.OwnershipTransfer
+	err := db.WithContext(ctx).
+		Where("integration_id = ? AND completed_at IS NULL AND cancelled_at IS NULL", id).
+		Take(&pending).Error
+	if err == nil {
+		transfer := fromDBTransfer(pending)
+		out.PendingTransfer = &transfer
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RequestTransfer records a pending transfer from the current owner to
+// toRepository, replacing any earlier pending transfer.
+func RequestTransfer(ctx context.Context, db *gorm.DB, id, fromRepository, toRepository string) (*models.OwnershipTransfer, error) {
+	from := NormalizeRepository(fromRepository)
+	to := NormalizeRepository(toRepository)
+	if to == "" {
+		return nil, ErrInvalidRepository
+	}
+
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	owner, err := lockOwner(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if owner.Repository != from {
+		tx.Rollback()
+		return nil, ErrNotOwner
+	}
+	now := time.Now()
+	if err := cancelPendingTransfers(tx, id, now); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	transfer := dbmodels.OwnershipTransfer{
+		IntegrationID:  id,
+		FromRepository: from,
+		ToRepository:   to,
+		CreatedAt:      now,
+	}
+	if err := tx.Create(&transfer).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	out := fromDBTransfer(transfer)
+	return &out, nil
+}
+
+// AcceptTransfer completes the pending transfer addressed to repository.
+func AcceptTransfer(ctx context.Context, db *gorm.DB, id, repository string) (*models.Ownership, error) {
+	repo := NormalizeRepository(repository)
+
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err := lockOwner(tx, id); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	var pending dbmodels.OwnershipTransfer
+	if err := tx.
+		Where("integration_id = ? AND to_repository = ? AND completed_at IS NULL AND cancelled_at IS NULL", id, repo).
+		Take(&pending).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoPendingTransfer
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if err := tx.Model(&dbmodels.OwnershipTransfer{}).
+		Where("id = ?", pending.ID).
+		Update("completed_at", now).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Model(&dbmodels.IntegrationOwner{}).
+		Where("integration_id = ?", id).
+		Updates(map[string]any{"repository": repo, "updated_at": now}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	log.Printf("store ownership transferred id=%q from=%q to=%q", id, pending.FromRepository, repo)
+	return GetOwnership(ctx, db, id)
+}
+
+// CancelTransfer withdraws the pending transfer; only the current owner may do so.
+func CancelTransfer(ctx context.Context, db *gorm.DB, id, repository string) error {
+	owner, err := GetOwnership(ctx, db, id)
+	if err != nil {
+		return err
+	}
+	if owner.Repository != NormalizeRepository(repository) {
+		return ErrNotOwner
+	}
+	if owner.PendingTransfer == nil {
+		return ErrNoPendingTransfer
+	}
+	return cancelPendingTransfers(db.WithContext(ctx), id, time.Now())
+}
+
+// SetOwner assigns id to repository regardless of the current owner and drops
+// any pending transfer. It is meant for admins.
+func SetOwner(ctx context.Context, db *gorm.DB, id, repository string) (*models.Ownership, error) {
+	repo := NormalizeRepository(repository)
+	if repo == "" {
+		return nil, ErrInvalidRepository
+	}
+
+	var owner *models.Ownership
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&dbmodels.Integration{}).Where("id = ?", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		now := time.Now()
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "integration_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"repository", "publisher", "updated_at"}),
+		}).Create(&dbmodels.IntegrationOwner{IntegrationID: id, Repository: repo, CreatedAt: now, UpdatedAt: now}).Error; err != nil {
+			return err
+		}
+		if err := cancelPendingTransfers(tx, id, now); err != nil {
+			return err
+		}
+		var err error
+		owner, err = GetOwnership(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return owner, nil
+}
+
+// CheckOwnership reports whether a publish with opts could claim id, without
+// claiming it. Publish handlers call it before fetching anything a request
+// points at; PublishIntegration checks again under lock.
+func CheckOwnership(ctx context.Context, db *gorm.DB, id string, opts PublishOptions) error {
+	if opts.OwnerRepository == "" && opts.RequirePublisher == "" {
+		return nil
+	}
+	repo := NormalizeRepository(opts.OwnerRepository)
+	if opts.OwnerRepository != "" && repo == "" {
+		return ErrInvalidRepository
+	}
+	tx := db.WithContext(ctx)
+	var owner dbmodels.IntegrationOwner
+	err := tx.Where("integration_id = ?", id).Take(&owner).Error
+	switch {
+	case err == nil && opts.OwnerRepository != "":
+		if owner.Repository != repo {
+			return ErrNotOwner
+		}
+		return nil
+	case err == nil:
+		switch {
+		case owner.Publisher == opts.RequirePublisher:
+			return nil
+		case owner.Publisher == "":
+			return ErrNotOwner
+		default:
+			return ErrPublisherMismatch
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+	var count int64
+	if err := tx.Model(&dbmodels.Integration{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+	if opts.OwnerRepository != "" {
+		return ErrNotOwner
+	}
+	return ErrPublisherMismatch
+}
+
+// claimOwnership binds an unclaimed id to repository, or checks that the
+// repository already owns it. Ids that already have releases but no owner
+// (published with an API key) cannot be claimed through OIDC.
+func claimOwnership(tx *gorm.DB, id, repository string) error {
+	repo := NormalizeRepository(repository)
+	if repo == "" {
+		return ErrInvalidRepository
+	}
+	owner, err := lockOwner(tx, id)
+	if err == nil {
+		if owner.Repository != repo {
+			return ErrNotOwner
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	var count int64
+	if err := tx.Model(&dbmodels.Integration{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrNotOwner
+	}
+	now := time.Now()
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&dbmodels.IntegrationOwner{IntegrationID: id, Repository: repo, CreatedAt: now, UpdatedAt: now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// Lost a race with a concurrent first publish from another repository.
+		return ErrNotOwner
+	}
+	log.Printf("store ownership claimed id=%q repo=%q", id, repo)
+	return nil
+}
+
+// claimPublisher binds an unclaimed id to the publisher account of an API
+// key, or checks that the account already owns it. Ids owned by a repository
+// or by another account are refused, as are ids that already have releases
+// but no owner.
+func claimPublisher(tx *gorm.DB, id, publisher string) error {
+	owner, err := lockOwner(tx, id)
+	if err == nil {
+		switch {
+		case owner.Publisher == publisher:
+			return nil
+		case owner.Publisher == "":
+			return ErrNotOwner
+		default:
+			return ErrPublisherMismatch
+		}
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	var count int64
+	if err := tx.Model(&dbmodels.Integration{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPublisherMismatch
+	}
+	now := time.Now()
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&dbmodels.IntegrationOwner{IntegrationID: id, Publisher: publisher, CreatedAt: now, UpdatedAt: now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		// Lost a race with a concurrent first publish from another owner.
+		return ErrPublisherMismatch
+	}
+	log.Printf("store ownership claimed id=%q publisher=%q", id, publisher)
+	return nil
+}
+
+func lockOwner(tx *gorm.DB, id string) (*dbmodels.IntegrationOwner, error) {
+	var owner dbmodels.IntegrationOwner
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("integration_id = ?", id).
+		Take(&owner).Error; err != nil {
+		return nil, err
+	}
+	return &owner, nil
+}
+
+func cancelPendingTransfers(tx *gorm.DB, id string, now time.Time) error {
+	return tx.Model(&dbmodels.OwnershipTransfer{}).
+		Where("integration_id = ? AND completed_at IS NULL AND cancelled_at IS NULL", id).
+		Update("cancelled_at", now).Error
+}
+
+func fromDBTransfer(row dbmodels.OwnershipTransfer) models.OwnershipTransfer {
+	return models.OwnershipTransfer{
+		ID:             row.ID,
+		IntegrationID:  row.IntegrationID,
+		FromRepository: row.FromRepository,
+		ToRepository:   row.ToRepository,
+		CreatedAt:      row.CreatedAt,
+		CompletedAt:    row.CompletedAt,
+		CancelledAt:    row.CancelledAt,
+	}
+}
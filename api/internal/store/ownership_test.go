@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestOwnershipClaimAndTransfer(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+		Publisher:   "Homenavi",
+	}
+	opts := PublishOptions{Verified: true, TagPrefix: "v", OwnerRepository: "PetoAdam/homenavi-spotify"}
+	if _, err := PublishIntegration(ctx, pool, req, opts); err != nil {
+		t.Fatalf("first publish: %v", err)
+	}
+
+	req.Version = "v0.2.0"
+	foreign := opts
+	foreign.OwnerRepository = "mallory/spotify"
+	if _, err := PublishIntegration(ctx, pool, req, foreign); err != ErrNotOwner {
+		t.Fatalf("expected ErrNotOwner for foreign repository, got %v", err)
+	}
+	if err := CheckOwnership(ctx, pool, "spotify", foreign); err != ErrNotOwner {
+		t.Fatalf("expected CheckOwnership to refuse a foreign repository, got %v", err)
+	}
+	if err := CheckOwnership(ctx, pool, "spotify", opts); err != nil {
+		t.Fatalf("expected CheckOwnership to accept the owner, got %v", err)
+	}
+	if err := CheckOwnership(ctx, pool, "unclaimed", foreign); err != nil {
+		t.Fatalf("expected CheckOwnership to accept an unclaimed id, got %v", err)
+	}
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{TagPrefix: "v", RequirePublisher: "Homenavi"}); err != ErrNotOwner {
+		t.Fatalf("expected ErrNotOwner for api key publish, got %v", err)
+	}
+
+	if _, err := RequestTransfer(ctx, pool, "spotify", "mallory/spotify", "acme/spotify"); err != ErrNotOwner {
+		t.Fatalf("expected ErrNotOwner for foreign transfer request, got %v", err)
+	}
+	transfer, err := RequestTransfer(ctx, pool, "spotify", "petoadam/homenavi-spotify", "https://github.com/Acme/Spotify")
+	if err != nil {
+		t.Fatalf("request transfer: %v", err)
+	}
+	if transfer.ToRepository != "github.com/acme/spotify" {
+		t.Fatalf("expected normalized target, got %q", transfer.ToRepository)
+	}
+	if _, err := AcceptTransfer(ctx, pool, "spotify", "mallory/spotify"); err != ErrNoPendingTransfer {
+		t.Fatalf("expected ErrNoPendingTransfer for wrong repository, got %v", err)
+	}
+	owner, err := AcceptTransfer(ctx, pool, "spotify", "acme/spotify")
+	if err != nil {
+		t.Fatalf("accept transfer: %v", err)
+	}
+	if owner.Repository != "github.com/acme/spotify" || owner.PendingTransfer != nil {
+		t.Fatalf("expected acme/spotify without pending transfer, got %+v", owner)
+	}
+
+	req.Version = "v0.3.0"
+	if _, err := PublishIntegration(ctx, pool, req, opts); err != ErrNotOwner {
+		t.Fatalf("expected previous owner to be rejected, got %v", err)
+	}
+	foreign.OwnerRepository = "acme/spotify"
+	if _, err := PublishIntegration(ctx, pool, req, foreign); err != nil {
+		t.Fatalf("publish from new owner: %v", err)
+	}
+
+	if _, err := SetOwner(ctx, pool, "spotify", "https://gitlab.com/PetoAdam/mirrors/homenavi-spotify"); err != nil {
+		t.Fatalf("set gitlab owner: %v", err)
+	}
+	if _, err := SetOwner(ctx, pool, "spotify", "petoadam/homenavi-spotify"); err != nil {
+		t.Fatalf("set owner: %v", err)
+	}
+	owner, err = GetOwnership(ctx, pool, "spotify")
+	if err != nil || owner.Repository != "github.com/petoadam/homenavi-spotify" {
+		t.Fatalf("expected admin override, got %+v err=%v", owner, err)
+	}
+}
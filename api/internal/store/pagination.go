@@ -0,0 +1,129 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageLimit = 50
+	MaxPageLimit     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type Page struct {
+	Limit  int
+	Cursor string
+}
+
+func (p Page) limit() int {
+	if p.Limit <= 0 {
+		return DefaultPageLimit
+	}
+	if p.Limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return p.Limit
+}
+
+// pageCursor is the position of the last returned row. Every integration sort
+// mode ends in (id, version) so the position is unique; the downloads and
+// trending modes compare against the counters of ranking Snapshot, which do
+// not change between requests. Event logs page by their serial Seq.
+type pageCursor struct {
+	Sort       string  `json:"s"`
+	SearchRank float64 `json:"r,omitempty"`
+	Downloads  int64   `json:"d,omitempty"`
+	Trending   float64 `json:"t,omitempty"`
+	Name       string  `json:"n,omitempty"`
+	VersionKey string  `json:"k,omitempty"`
+	ID         string  `json:"i,omitempty"`
+	Version    string  `json:"v,omitempty"`
+	Seq        uint    `json:"q,omitempty"`
+	Snapshot   uint    `json:"p,omitempty"`
+}
+
+type sortColumn struct {
+	column string
+	desc   bool
+	value  func(c pageCursor) any
+}
+
+var (
+	sortByRank        = sortColumn{column: "search_rank", desc: true, value: func(c pageCursor) any { return c.SearchRank }}
+	sortByDownloads   = sortColumn{column: "ranked_downloads", desc: true, value: func(c pageCursor) any { return c.Downloads }}
+	sortByTrending    = sortColumn{column: "ranked_trending", desc: true, value: func(c pageCursor) any { return c.Trending }}
+	sortByName        = sortColumn{column: "name", value: func(c pageCursor) any { return c.Name }}
+	sortByVersionKey  = sortColumn{column: "version_key", desc: true, value: func(c pageCursor) any { return c.VersionKey }}
+	sortByID          = sortColumn{column: "id", value: func(c pageCursor) any { return c.ID }}
+	sortByVersion     = sortColumn{column: "version", value: func(c pageCursor) any { return c.Version }}
+	sortByVersionDesc = sortColumn{column: "version", desc: true, value: func(c pageCursor) any { return c.Version }}
+	sortBySeqDesc     = sortColumn{column: "id", desc: true, value: func(c pageCursor) any { return c.Seq }}
+)
+
+func encodeCursor(c pageCursor) string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string, sortMode string) (*pageCursor, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sortMode {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// applyKeyset orders the query by columns and, when a cursor is given, only
+// keeps rows that sort strictly after it.
+func applyKeyset(query *gorm.DB, columns []sortColumn, cursor *pageCursor) *gorm.DB {
+	order := make([]string, 0, len(columns))
+	for _, col := range columns {
+		if col.desc {
+			order = append(order, col.column+" DESC")
+		} else {
+			order = append(order, col.column+" ASC")
+		}
+	}
+	query = query.Order(strings.Join(order, ", "))
+	if cursor == nil {
+		return query
+	}
+
+	clauses := make([]string, 0, len(columns))
+	vars := make([]any, 0, len(columns)*(len(columns)+1)/2)
+	for i, col := range columns {
+		parts := make([]string, 0, i+1)
+		for _, prev := range columns[:i] {
+			parts = append(parts, prev.column+" = ?")
+			vars = append(vars, prev.value(*cursor))
+		}
+		if col.desc {
+			parts = append(parts, col.column+" < ?")
+		} else {
+			parts = append(parts, col.column+" > ?")
+		}
+		vars = append(vars, col.value(*cursor))
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+	return query.Where(strings.Join(clauses, " OR "), vars...)
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTokenReplayed = errors.New("oidc token already used")
+
+// ConsumeOIDCToken marks tokenID from issuer as used. It returns
+// ErrTokenReplayed when the token was seen before. Entries are kept until
+// the token expires, after which the issuer rejects it anyway.
+func ConsumeOIDCToken(ctx context.Context, db *gorm.DB, issuer, tokenID string, expiresAt time.Time) error {
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Where("expires_at < ?", time.Now()).Delete(&dbmodels.OIDCTokenUse{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&dbmodels.OIDCTokenUse{
+		Issuer:    issuer,
+		TokenID:   tokenID,
+		ExpiresAt: expiresAt,
+	})
+	if res.Error != nil {
+		tx.Rollback()
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		tx.Rollback()
+		return ErrTokenReplayed
+	}
+	return tx.Commit().Error
+}
+
+func RecordPublishEvent(ctx context.Context, db *gorm.DB, event models.PublishEvent) error {
+	row := dbmodels.PublishEvent{
+		Endpoint:      event.Endpoint,
+		Outcome:       event.Outcome,
+		Status:        event.Status,
+		Error:         event.Error,
+		IntegrationID: event.IntegrationID,
+		Version:       event.Version,
+		Publisher:     event.Publisher,
+		Issuer:        event.Issuer,
+		Subject:       event.Subject,
+		Repository:    event.Repository,
+		Actor:         event.Actor,
+		RunID:         event.RunID,
+		RunAttempt:    event.RunAttempt,
+		TokenID:       event.TokenID,
+	}
+	for _, field := range []struct {
+		value map[string]any
+		dest  *datatypes.JSON
+	}{
+		{event.Claims, &row.Claims},
+		{event.Request, &row.Request},
+		{event.Response, &row.Response},
+	} {
+		if len(field.value) == 0 {
+			continue
+		}
+		data, err := json.Marshal(field.value)
+		if err != nil {
+			return err
+		}
+		*field.dest = datatypes.JSON(data)
+	}
+	return db.WithContext(ctx).Create(&row).Error
+}
+
+type PublishEventFilter struct {
+	IntegrationID string
+	Repository    string
+	Outcome       string
+}
+
+func ListPublishEvents(ctx context.Context, db *gorm.DB, filter PublishEventFilter, page Page) ([]models.PublishEvent, string, error) {
+	const sortMode = "publish_events"
+	cursor, err := decodeCursor(page.Cursor, sortMode)
+	if err != nil {
+		return nil, "", err
+	}
+	limit := page.limit()
+	query := db.WithContext(ctx).Model(&dbmodels.PublishEvent{})
+	if filter.IntegrationID != "" {
+		query = query.Where("integration_id = ?", filter.IntegrationID)
+	}
+	if filter.Repository != "" {
+		query = query.Where("repository = ?", filter.Repository)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	query = applyKeyset(query, []sortColumn{sortBySeqDesc}, cursor)
+
+	rows := []dbmodels.PublishEvent{}
+	if err := query.Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, "", err
+	}
+	nextCursor := ""
+	if len(rows) > limit {
+		rows = rows[:limit]
+		nextCursor = encodeCursor(pageCursor{Sort: sortMode, Seq: rows[len(rows)-1].ID})
+	}
+	out := make([]models.PublishEvent, 0, len(rows))
+	for _, row := range rows {
+		event := models.PublishEvent{
+			ID:            row.ID,
+			Endpoint:      row.Endpoint,
+			Outcome:       row.Outcome,
+			Status:        row.Status,
+			Error:         row.Error,
+			IntegrationID: row.IntegrationID,
+			Version:       row.Version,
+			Publisher:     row.Publisher,
+			Issuer:        row.Issuer,
+			Subject:       row.Subject,
+			Repository:    row.Repository,
+			Actor:         row.Actor,
+			RunID:         row.RunID,
+			RunAttempt:    row.RunAttempt,
+			TokenID:       row.TokenID,
+			CreatedAt:     row.CreatedAt,
+		}
+		if len(row.Claims) > 0 {
+			_ = json.Unmarshal(row.Claims, &event.Claims)
+		}
+		if len(row.Request) > 0 {
+			_ = json.Unmarshal(row.Request, &event.Request)
+		}
+		if len(row.Response) > 0 {
+			_ = json.Unmarshal(row.Response, &event.Response)
+		}
+		out = append(out, event)
+	}
+	return out, nextCursor, nil
+}
+
+// CountUnauthenticatedPublish counts a publish attempt that was rejected
+// before its credential verified. Such attempts are only counted per day
+// and status, so unauthenticated callers cannot grow publish_events.
+func CountUnauthenticatedPublish(ctx context.Context, db *gorm.DB, endpoint string, status int, at time.Time) error {
+	day := at.UTC().Truncate(24 * time.Hour)
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint"}, {Name: "day"}, {Name: "status"}},
+		DoUpdates: clause.Assignments(map[string]any{"attempts": gorm.Expr("unauthenticated_publish_attempts.attempts + 1")}),
+	}).Create(&dbmodels.UnauthenticatedPublishAttempt{Endpoint: endpoint, Day: day, Status: status, Attempts: 1}).Error
+}
+
+// ListUnauthenticatedPublishAttempts returns the daily counts since the UTC
+// day of since, newest first.
+func ListUnauthenticatedPublishAttempts(ctx context.Context, db *gorm.DB, since time.Time) ([]models.UnauthenticatedPublishAttempts, error) {
+	rows := []dbmodels.UnauthenticatedPublishAttempt{}
+	if err := db.WithContext(ctx).
+		Where("day >= ?", since.UTC().Truncate(24*time.Hour)).
+		Order("day DESC, endpoint ASC, status ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]models.UnauthenticatedPublishAttempts, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, models.UnauthenticatedPublishAttempts{Endpoint: row.Endpoint, Day: row.Day, Status: row.Status, Attempts: row.Attempts})
+	}
+	return out, nil
+}
+
+// PrunePublishEvents deletes publish events and unauthenticated attempt
+// counts from before the given time.
+func PrunePublishEvents(ctx context.Context, db *gorm.DB, before time.Time) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("created_at < ?", before).Delete(&dbmodels.PublishEvent{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if err := tx.Where("day < ?", before.UTC().Truncate(24*time.Hour)).Delete(&dbmodels.UnauthenticatedPublishAttempt{}).Error; err != nil {
+			return err
+		}
+		if res.RowsAffected > 0 {
+			log.Printf("store publish events pruned count=%d before=%s", res.RowsAffected, before.Format(time.RFC3339))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestPublishEventRetention(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+	for _, status := range []int{401, 401, 503} {
+		if err := CountUnauthenticatedPublish(ctx, pool, "publish-oidc", status, now); err != nil {
+			t.Fatalf("count attempt: %v", err)
+		}
+	}
+	if err := CountUnauthenticatedPublish(ctx, pool, "publish", 401, now.AddDate(0, 0, -100)); err != nil {
+		t.Fatalf("count old attempt: %v", err)
+	}
+	if err := RecordPublishEvent(ctx, pool, models.PublishEvent{Endpoint: "publish", Outcome: "published", Status: 200, IntegrationID: "spotify"}); err != nil {
+		t.Fatalf("record event: %v", err)
+	}
+	if err := pool.Exec("UPDATE publish_events SET created_at = ?", now.AddDate(0, 0, -100)).Error; err != nil {
+		t.Fatalf("age event: %v", err)
+	}
+	if err := RecordPublishEvent(ctx, pool, models.PublishEvent{Endpoint: "publish", Outcome: "rejected", Status: 403, IntegrationID: "spotify"}); err != nil {
+		t.Fatalf("record event: %v", err)
+	}
+
+	if err := PrunePublishEvents(ctx, pool, now.AddDate(0, 0, -90)); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	events, _, err := ListPublishEvents(ctx, pool, PublishEventFilter{}, Page{})
+	if err != nil || len(events) != 1 || events[0].Outcome != "rejected" {
+		t.Fatalf("expected only the recent event kept, got %+v err=%v", events, err)
+	}
+	attempts, err := ListUnauthenticatedPublishAttempts(ctx, pool, now.AddDate(0, 0, -365))
+	if err != nil {
+		t.Fatalf("list attempts: %v", err)
+	}
+	if len(attempts) != 2 || attempts[0].Status != 401 || attempts[0].Attempts != 2 || attempts[1].Status != 503 || attempts[1].Attempts != 1 {
+		t.Fatalf("expected today's counts only, got %+v", attempts)
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// YankRelease hides a release from listings and resolution and moves latest
+// back to the newest remaining release.
+func YankRelease(ctx context.Context, db *gorm.DB, id, version, reason string, prereleaseLatest bool) (*models.Integration, error) {
+	now := time.Now()
+	return updateRelease(ctx, db, id, version, map[string]any{
+		"yanked":      true,
+		"yank_reason": reason,
+		"yanked_at":   &now,
+	}, &prereleaseLatest)
+}
+
+func UnyankRelease(ctx context.Context, db *gorm.DB, id, version string, prereleaseLatest bool) (*models.Integration, error) {
+	return updateRelease(ctx, db, id, version, map[string]any{
+		"yanked":      false,
+		"yank_reason": "",
+		"yanked_at":   nil,
+	}, &prereleaseLatest)
+}
+
+// DeprecateRelease flags a release without hiding it; it stays installable.
+func DeprecateRelease(ctx context.Context, db *gorm.DB, id, version, message string) (*models.Integration, error) {
+	return updateRelease(ctx, db, id, version, map[string]any{
+		"deprecated":          true,
+		"deprecation_message": message,
+	}, nil)
+}
+
+func UndeprecateRelease(ctx context.Context, db *gorm.DB, id, version string) (*models.Integration, error) {
+	return updateRelease(ctx, db, id, version, map[string]any{
+		"deprecated":          false,
+		"deprecation_message": "",
+	}, nil)
+}
+
+// updateRelease applies updates to one (id, version) release and, when
+// prereleaseLatest is set, recomputes the latest release in the same
+// transaction.
+func updateRelease(ctx context.Context, db *gorm.DB, id, version string, updates map[string]any, prereleaseLatest *bool) (*models.Integration, error) {
+	updates["updated_at"] = time.Now()
+	var item *models.Integration
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&dbmodels.Release{}).
+			Where("integration_id = ? AND version = ?", id, version).
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if prereleaseLatest != nil {
+			if err := refreshLatest(tx, id, *prereleaseLatest, "", ""); err != nil {
+				return err
+			}
+		}
+		var err error
+		item, err = GetIntegration(ctx, tx, id, version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
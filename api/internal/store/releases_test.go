@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+	"gorm.io/gorm"
+)
+
+func TestYankReleaseFallsBackToPreviousLatest(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	for _, version := range []string{"v0.1.0", "v0.2.0"} {
+		req.Version = version
+		if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+	if _, err := IncrementDownloads(ctx, pool, "spotify", DownloadOptions{}); err != nil {
+		t.Fatalf("increment downloads: %v", err)
+	}
+
+	yanked, err := YankRelease(ctx, pool, "spotify", "v0.2.0", "crashes on start", false)
+	if err != nil {
+		t.Fatalf("yank: %v", err)
+	}
+	if !yanked.Yanked || yanked.YankReason != "crashes on start" || yanked.Latest {
+		t.Fatalf("unexpected yanked release: %+v", yanked)
+	}
+
+	latest, err := GetIntegration(ctx, pool, "spotify", "")
+	if err != nil {
+		t.Fatalf("get latest: %v", err)
+	}
+	if latest.Version != "v0.1.0" || latest.Downloads != 1 {
+		t.Fatalf("expected v0.1.0 with carried downloads, got %s downloads=%d", latest.Version, latest.Downloads)
+	}
+
+	items, _, err := ListIntegrations(ctx, pool, ListOptions{})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(items) != 1 || items[0].Version != "v0.1.0" {
+		t.Fatalf("expected yanked release hidden from list, got %+v", items)
+	}
+	items, _, err = ListIntegrations(ctx, pool, ListOptions{IncludeYanked: true})
+	if err != nil {
+		t.Fatalf("list with yanked: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected 2 releases with include_yanked, got %d", len(items))
+	}
+
+	wildcard, _ := semver.ParseConstraint("*", "v")
+	resolved, err := ResolveIntegration(ctx, pool, "spotify", wildcard, ResolveOptions{TagPrefix: "v"})
+	if err != nil || resolved.Version != "v0.1.0" {
+		t.Fatalf("expected resolve to skip yanked release, got %v %v", resolved, err)
+	}
+
+	if _, err := UnyankRelease(ctx, pool, "spotify", "v0.2.0", false); err != nil {
+		t.Fatalf("unyank: %v", err)
+	}
+	latest, err = GetIntegration(ctx, pool, "spotify", "")
+	if err != nil || latest.Version != "v0.2.0" {
+		t.Fatalf("expected v0.2.0 latest after unyank, got %v %v", latest, err)
+	}
+
+	deprecated, err := DeprecateRelease(ctx, pool, "spotify", "v0.1.0", "use v0.2.0")
+	if err != nil {
+		t.Fatalf("deprecate: %v", err)
+	}
+	if !deprecated.Deprecated || deprecated.DeprecationMessage != "use v0.2.0" {
+		t.Fatalf("unexpected deprecated release: %+v", deprecated)
+	}
+
+	if _, err := YankRelease(ctx, pool, "spotify", "v9.9.9", "missing", false); err == nil {
+		t.Fatalf("expected error yanking unknown release")
+	}
+}
+
+func TestYankSoleReleaseKeepsReservation(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := IncrementDownloads(ctx, pool, "spotify", DownloadOptions{}); err != nil {
+		t.Fatalf("increment downloads: %v", err)
+	}
+	if err := SetFeatured(ctx, pool, "spotify", true); err != nil {
+		t.Fatalf("feature: %v", err)
+	}
+	if _, err := YankRelease(ctx, pool, "spotify", "v0.1.0", "leaks tokens", false); err != nil {
+		t.Fatalf("yank: %v", err)
+	}
+
+	items, _, err := ListIntegrations(ctx, pool, ListOptions{LatestOnly: true})
+	if err != nil || len(items) != 0 {
+		t.Fatalf("expected the yanked integration hidden from list, got %+v %v", items, err)
+	}
+	if _, err := IncrementDownloads(ctx, pool, "spotify", DownloadOptions{}); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected no default release to download, got %v", err)
+	}
+
+	other := models.PublishRequest{
+		ID:          "other",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "other"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := PublishIntegration(ctx, pool, other, PublishOptions{Verified: true, TagPrefix: "v"}); err != ErrListenPathInUse {
+		t.Fatalf("expected listen_path to stay reserved, got %v", err)
+	}
+	other.ListenPath = "/integrations/other"
+	if _, err := PublishIntegration(ctx, pool, other, PublishOptions{Verified: true, TagPrefix: "v"}); err != ErrNameInUse {
+		t.Fatalf("expected name to stay reserved, got %v", err)
+	}
+
+	if _, err := UnyankRelease(ctx, pool, "spotify", "v0.1.0", false); err != nil {
+		t.Fatalf("unyank: %v", err)
+	}
+	latest, err := GetIntegration(ctx, pool, "spotify", "")
+	if err != nil || latest.Downloads != 1 || !latest.Featured {
+		t.Fatalf("expected downloads and featured kept across the yank, got %+v %v", latest, err)
+	}
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
+	"gorm.io/gorm"
+)
+
+var ErrNoMatchingVersion = errors.New("no version matches constraint")
+
+type ResolveOptions struct {
+	TagPrefix         string
+	IncludePrerelease bool
+}
+
+type ResolveRequest struct {
+	ID         string
+	Constraint semver.Constraint
+}
+
+type ResolveResult struct {
+	Integration *models.Integration
+	Err         error
+}
+
+// ResolveIntegration returns the newest non-yanked release of id that satisfies constraint.
+func ResolveIntegration(ctx context.Context, db *gorm.DB, id string, constraint semver.Constraint, opts ResolveOptions) (*models.Integration, error) {
+	results, err := ResolveIntegrations(ctx, db, []ResolveRequest{{ID: id, Constraint: constraint}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return results[0].Integration, results[0].Err
+}
+
+// ResolveIntegrations resolves many id/constraint pairs with two queries; the
+// results are returned in request order.
+func ResolveIntegrations(ctx context.Context, db *gorm.DB, reqs []ResolveRequest, opts ResolveOptions) ([]ResolveResult, error) {
+	results := make([]ResolveResult, len(reqs))
+	if len(reqs) == 0 {
+		return results, nil
+	}
+
+	ids := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		ids = append(ids, req.ID)
+	}
+	candidates := []dbmodels.IntegrationVersion{}
+	if err := db.WithContext(ctx).
+		Model(&dbmodels.IntegrationVersion{}).
+		Select("id", "version").
+		Where("id IN ? AND yanked = ?", ids, false).
+		Order("id ASC, version_key DESC, version DESC").
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	versionsByID := make(map[string][]string, len(ids))
+	for _, row := range candidates {
+		versionsByID[row.ID] = append(versionsByID[row.ID], row.Version)
+	}
+
+	picked := make([]string, len(reqs))
+	matched := make([][]any, 0, len(reqs))
+	for i, req := range reqs {
+		for _, raw := range versionsByID[req.ID] {
+			version, err := semver.Parse(raw, opts.TagPrefix)
+			if err != nil || !req.Constraint.Check(version, opts.IncludePrerelease) {
+				continue
+			}
+			picked[i] = raw
+			matched = append(matched, []any{req.ID, raw})
+			break
+		}
+	}
+
+	byKey := map[[2]string]models.Integration{}
+	if len(matched) > 0 {
+		rows := []dbmodels.IntegrationVersion{}
+		if err := db.WithContext(ctx).
+			Model(&dbmodels.IntegrationVersion{}).
+			Where("(id, version) IN ?", matched).
+			Find(&rows).Error; err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			byKey[[2]string{row.ID, row.Version}] = fromDBIntegration(row)
+		}
+	}
+	for i, req := range reqs {
+		item, ok := byKey[[2]string{req.ID, picked[i]}]
+		if picked[i] == "" || !ok {
+			results[i].Err = ErrNoMatchingVersion
+			continue
+		}
+		results[i].Integration = &item
+	}
+	return results, nil
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestResolveIntegrations(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	for _, version := range []string{"v0.2.5", "v0.3.0", "v0.3.4", "v0.4.0-rc.1", "v1.0.0"} {
+		req.Version = version
+		if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+
+	caret, _ := semver.ParseConstraint("^0.3", "v")
+	item, err := ResolveIntegration(ctx, pool, "spotify", caret, ResolveOptions{TagPrefix: "v"})
+	if err != nil {
+		t.Fatalf("resolve ^0.3: %v", err)
+	}
+	if item.Version != "v0.3.4" {
+		t.Fatalf("expected v0.3.4, got %s", item.Version)
+	}
+
+	pre, _ := semver.ParseConstraint(">0.3.4 <1.0.0", "v")
+	if _, err := ResolveIntegration(ctx, pool, "spotify", pre, ResolveOptions{TagPrefix: "v"}); err != ErrNoMatchingVersion {
+		t.Fatalf("expected no match without prereleases, got %v", err)
+	}
+	item, err = ResolveIntegration(ctx, pool, "spotify", pre, ResolveOptions{TagPrefix: "v", IncludePrerelease: true})
+	if err != nil || item.Version != "v0.4.0-rc.1" {
+		t.Fatalf("expected v0.4.0-rc.1 with prereleases, got %v %v", item, err)
+	}
+
+	wildcard, _ := semver.ParseConstraint("*", "v")
+	results, err := ResolveIntegrations(ctx, pool, []ResolveRequest{
+		{ID: "spotify", Constraint: wildcard},
+		{ID: "missing", Constraint: wildcard},
+		{ID: "spotify", Constraint: caret},
+	}, ResolveOptions{TagPrefix: "v"})
+	if err != nil {
+		t.Fatalf("bulk resolve: %v", err)
+	}
+	if results[0].Integration == nil || results[0].Integration.Version != "v1.0.0" {
+		t.Fatalf("expected v1.0.0 for *, got %+v", results[0])
+	}
+	if results[1].Err != ErrNoMatchingVersion {
+		t.Fatalf("expected no match for missing id, got %+v", results[1])
+	}
+	if results[2].Integration == nil || results[2].Integration.Version != "v0.3.4" {
+		t.Fatalf("expected v0.3.4 for ^0.3, got %+v", results[2])
+	}
+}
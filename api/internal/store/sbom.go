@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/sbom"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// GetSBOM returns the SBOM stored for one release.
+func GetSBOM(ctx context.Context, db *gorm.DB, id, version string) (*models.SBOM, error) {
+	var row dbmodels.IntegrationSBOM
+	if err := db.WithContext(ctx).
+		Where("integration_id = ? AND version = ?", id, version).
+		Take(&row).Error; err != nil {
+		return nil, err
+	}
+	out := &models.SBOM{
+		IntegrationID: row.IntegrationID,
+		Version:       row.Version,
+		Format:        row.Format,
+		SpecVersion:   row.SpecVersion,
+		Document:      row.Document,
+	}
+	if len(row.Summary) > 0 {
+		_ = json.Unmarshal(row.Summary, &out.Summary)
+	}
+	return out, nil
+}
+
+// saveSBOM replaces the SBOM of a release inside the publish transaction, so
+// republishing a version never leaves the previous build's SBOM behind.
+func saveSBOM(tx *gorm.DB, id, version string, doc *sbom.Document) error {
+	if err := tx.Where("integration_id = ? AND version = ?", id, version).Delete(&dbmodels.IntegrationSBOM{}).Error; err != nil {
+		return err
+	}
+	if doc == nil {
+		return nil
+	}
+	summary, err := json.Marshal(doc.Summary())
+	if err != nil {
+		return fmt.Errorf("sbom summary json invalid: %w", err)
+	}
+	return tx.Create(&dbmodels.IntegrationSBOM{
+		IntegrationID: id,
+		Version:       version,
+		Format:        doc.Format,
+		SpecVersion:   doc.SpecVersion,
+		Document:      datatypes.JSON(doc.Raw),
+		Summary:       datatypes.JSON(summary),
+	}).Error
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/sbom"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+	"gorm.io/gorm"
+)
+
+func TestSBOMStoredPerRelease(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	doc, err := sbom.Parse([]byte(`{"bomFormat":"CycloneDX","specVersion":"1.5","components":[{"name":"requests","version":"2.31.0","purl":"pkg:pypi/requests@2.31.0","licenses":[{"license":{"id":"Apache-2.0"}}]}]}`))
+	if err != nil {
+		t.Fatalf("parse sbom: %v", err)
+	}
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:v0.1.0",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, SBOM: doc}); err != nil {
+		t.Fatalf("publish v0.1.0: %v", err)
+	}
+	req.Version = "v0.2.0"
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true}); err != nil {
+		t.Fatalf("publish v0.2.0: %v", err)
+	}
+
+	stored, err := GetSBOM(ctx, pool, "spotify", "v0.1.0")
+	if err != nil {
+		t.Fatalf("get sbom: %v", err)
+	}
+	if stored.Format != sbom.FormatCycloneDX || stored.Summary.ComponentCount != 1 || stored.Summary.Licenses[0].License != "Apache-2.0" {
+		t.Fatalf("unexpected stored sbom %+v", stored)
+	}
+	if _, err := GetSBOM(ctx, pool, "spotify", "v0.2.0"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected no sbom for v0.2.0, got %v", err)
+	}
+
+	req.Version = "v0.1.0"
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true}); err != nil {
+		t.Fatalf("republish v0.1.0: %v", err)
+	}
+	if _, err := GetSBOM(ctx, pool, "spotify", "v0.1.0"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected republish without sbom to drop it, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoadOrCreateSecret returns the server secret called name, generating and
+// storing a random one first if no replica has yet. Concurrent callers all
+// get the value that was stored first.
+func LoadOrCreateSecret(ctx context.Context, db *gorm.DB, name string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	if err := db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&dbmodels.ServerSecret{Name: name, Value: hex.EncodeToString(raw)}).Error; err != nil {
+		return "", err
+	}
+	var secret dbmodels.ServerSecret
+	if err := db.WithContext(ctx).Where("name = ?", name).Take(&secret).Error; err != nil {
+		return "", err
+	}
+	return secret.Value, nil
+}
@@ -0,0 +1,27 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestLoadOrCreateSecretIsStable(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	first, err := LoadOrCreateSecret(ctx, pool, "download_hash")
+	if err != nil || len(first) != 64 {
+		t.Fatalf("expected a generated secret, got %q %v", first, err)
+	}
+	second, err := LoadOrCreateSecret(ctx, pool, "download_hash")
+	if err != nil || second != first {
+		t.Fatalf("expected the stored secret again, got %q %v", second, err)
+	}
+	other, err := LoadOrCreateSecret(ctx, pool, "other")
+	if err != nil || other == first {
+		t.Fatalf("expected a separate secret per name, got %q %v", other, err)
+	}
+}
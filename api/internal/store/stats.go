@@ -0,0 +1,228 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+
+	DefaultStatsDays = 30
+	MaxStatsDays     = 365
+	topIntegrations  = 10
+)
+
+var ErrInvalidInterval = errors.New("interval must be day or week")
+
+// StatsOptions select the window of a download series: the last Days days,
+// widened to whole Interval buckets in UTC.
+type StatsOptions struct {
+	Interval string
+	Days     int
+}
+
+func (o StatsOptions) window(now time.Time) (string, time.Time, time.Time, error) {
+	interval := o.Interval
+	if interval == "" {
+		interval = IntervalDay
+	}
+	if interval != IntervalDay && interval != IntervalWeek {
+		return "", time.Time{}, time.Time{}, ErrInvalidInterval
+	}
+	days := o.Days
+	if days <= 0 {
+		days = DefaultStatsDays
+	}
+	days = min(days, MaxStatsDays)
+	now = now.UTC()
+	return interval, truncateInterval(now.AddDate(0, 0, -days+1), interval), now, nil
+}
+
+type statsRow struct {
+	Bucket        time.Time
+	IntegrationID string
+	Version       string
+	Method        string
+	Downloads     int64
+}
+
+// downloadRows counts downloads from `from` on per bucket, integration,
+// version and method, across recent events and daily rollups. An empty id
+// counts every integration.
+func downloadRows(ctx context.Context, db *gorm.DB, id, interval string, from time.Time) ([]statsRow, error) {
+	query := db.WithContext(ctx).
+		Table("("+downloadsSQL+") AS d").
+		Select("date_trunc(?, at AT TIME ZONE 'UTC') AS bucket, integration_id, version, method, SUM(downloads) AS downloads", interval).
+		Where("at >= ?", from).
+		Group("1, 2, 3, 4")
+	if id != "" {
+		query = query.Where("integration_id = ?", id)
+	}
+	rows := []statsRow{}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].Bucket = time.Date(rows[i].Bucket.Year(), rows[i].Bucket.Month(), rows[i].Bucket.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return rows, nil
+}
+
+// IntegrationStats returns the download series of id, in total and per
+// version, newest version first.
+func IntegrationStats(ctx context.Context, db *gorm.DB, id string, opts StatsOptions) (*models.DownloadStats, error) {
+	interval, from, to, err := opts.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	if err := db.WithContext(ctx).
+		Model(&dbmodels.Release{}).
+		Where("integration_id = ?", id).
+		Order("version_key DESC, version DESC").
+		Pluck("version", &versions).Error; err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	rows, err := downloadRows(ctx, db, id, interval, from)
+	if err != nil {
+		return nil, err
+	}
+
+	out := models.DownloadStats{ID: id, Interval: interval, From: from, To: to, Methods: map[string]int64{}}
+	total := map[time.Time]int64{}
+	perVersion := map[string]map[time.Time]int64{}
+	for _, row := range rows {
+		out.Downloads += row.Downloads
+		total[row.Bucket] += row.Downloads
+		if perVersion[row.Version] == nil {
+			perVersion[row.Version] = map[time.Time]int64{}
+		}
+		perVersion[row.Version][row.Bucket] += row.Downloads
+		out.Methods[methodKey(row.Method)] += row.Downloads
+	}
+	out.Series = fillSeries(from, to, interval, total)
+	// Events recorded before versions were tracked have no version; they are
+	// reported under "" after the published versions.
+	for version := range perVersion {
+		if !slices.Contains(versions, version) {
+			versions = append(versions, version)
+		}
+	}
+	out.Versions = make([]models.VersionStats, 0, len(versions))
+	for _, version := range versions {
+		series := fillSeries(from, to, interval, perVersion[version])
+		stats := models.VersionStats{Version: version, Series: series}
+		for _, point := range series {
+			stats.Downloads += point.Downloads
+		}
+		out.Versions = append(out.Versions, stats)
+	}
+	return &out, nil
+}
+
+// MarketplaceStats returns the download series across every integration and
+// the most downloaded integrations in the window.
+func MarketplaceStats(ctx context.Context, db *gorm.DB, opts StatsOptions) (*models.MarketplaceStats, error) {
+	interval, from, to, err := opts.window(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	out := models.MarketplaceStats{Interval: interval, From: from, To: to, Methods: map[string]int64{}, Top: []models.IntegrationDownloads{}}
+	if err := db.WithContext(ctx).
+		Model(&dbmodels.Integration{}).
+		Where("latest_version IS NOT NULL").
+		Count(&out.Integrations).Error; err != nil {
+		return nil, err
+	}
+	rows, err := downloadRows(ctx, db, "", interval, from)
+	if err != nil {
+		return nil, err
+	}
+
+	total := map[time.Time]int64{}
+	perIntegration := map[string]int64{}
+	for _, row := range rows {
+		out.Downloads += row.Downloads
+		total[row.Bucket] += row.Downloads
+		perIntegration[row.IntegrationID] += row.Downloads
+		out.Methods[methodKey(row.Method)] += row.Downloads
+	}
+	out.Series = fillSeries(from, to, interval, total)
+
+	for id, downloads := range perIntegration {
+		out.Top = append(out.Top, models.IntegrationDownloads{ID: id, Downloads: downloads})
+	}
+	sort.Slice(out.Top, func(i, j int) bool {
+		if out.Top[i].Downloads != out.Top[j].Downloads {
+			return out.Top[i].Downloads > out.Top[j].Downloads
+		}
+		return out.Top[i].ID < out.Top[j].ID
+	})
+	out.Top = out.Top[:min(len(out.Top), topIntegrations)]
+	if len(out.Top) > 0 {
+		ids := make([]string, 0, len(out.Top))
+		for _, item := range out.Top {
+			ids = append(ids, item.ID)
+		}
+		names := []struct{ ID, Name string }{}
+		if err := db.WithContext(ctx).
+			Model(&dbmodels.Integration{}).
+			Select("id", "name").
+			Where("id IN ?", ids).
+			Scan(&names).Error; err != nil {
+			return nil, err
+		}
+		byID := map[string]string{}
+		for _, n := range names {
+			byID[n.ID] = n.Name
+		}
+		for i := range out.Top {
+			out.Top[i].Name = byID[out.Top[i].ID]
+		}
+	}
+	return &out, nil
+}
+
+// truncateInterval returns the start of the UTC day or ISO week (Monday)
+// containing t, matching Postgres date_trunc.
+func truncateInterval(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if interval == IntervalWeek {
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+// fillSeries returns one point per bucket from `from` to `to`, with zero for
+// buckets without downloads.
+func fillSeries(from, to time.Time, interval string, counts map[time.Time]int64) []models.StatsPoint {
+	step := 1
+	if interval == IntervalWeek {
+		step = 7
+	}
+	out := []models.StatsPoint{}
+	for bucket := truncateInterval(from, interval); !bucket.After(to); bucket = bucket.AddDate(0, 0, step) {
+		out = append(out, models.StatsPoint{Date: bucket, Downloads: counts[bucket]})
+	}
+	return out
+}
+
+func methodKey(method string) string {
+	if method == "" {
+		return "unknown"
+	}
+	return method
+}
@@ -0,0 +1,351 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestFillSeries(t *testing.T) {
+	// 2026-03-04 is a Wednesday.
+	from := time.Date(2026, 3, 4, 15, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 3, 17, 9, 0, 0, 0, time.UTC)
+	monday := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	weeks := fillSeries(from, to, IntervalWeek, map[time.Time]int64{monday.AddDate(0, 0, 7): 3})
+	if len(weeks) != 3 || !weeks[0].Date.Equal(monday) || weeks[1].Downloads != 3 || weeks[2].Downloads != 0 {
+		t.Fatalf("unexpected weekly series %+v", weeks)
+	}
+	days := fillSeries(from, to, IntervalDay, nil)
+	if len(days) != 14 || !days[0].Date.Equal(time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected daily series %+v", days)
+	}
+}
+
+func TestDownloadStats(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	for _, version := range []string{"v0.1.0", "v0.2.0"} {
+		req.Version = version
+		if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+	for _, opts := range []DownloadOptions{
+		{Method: InstallHelm},
+		{Method: InstallCompose},
+		{Version: "v0.1.0", Method: InstallCompose},
+	} {
+		if _, err := IncrementDownloads(ctx, pool, "spotify", opts); err != nil {
+			t.Fatalf("increment downloads: %v", err)
+		}
+	}
+	if _, err := IncrementDownloads(ctx, pool, "spotify", DownloadOptions{Version: "v9.9.9"}); err == nil {
+		t.Fatalf("expected unknown version to be rejected")
+	}
+
+	stats, err := IntegrationStats(ctx, pool, "spotify", StatsOptions{Days: 7})
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Downloads != 3 || len(stats.Series) != 7 || stats.Series[6].Downloads != 3 {
+		t.Fatalf("unexpected totals %+v", stats)
+	}
+	if len(stats.Versions) != 2 || stats.Versions[0].Version != "v0.2.0" || stats.Versions[0].Downloads != 2 || stats.Versions[1].Downloads != 1 {
+		t.Fatalf("unexpected version stats %+v", stats.Versions)
+	}
+	if stats.Methods[InstallCompose] != 2 || stats.Methods[InstallHelm] != 1 {
+		t.Fatalf("unexpected methods %+v", stats.Methods)
+	}
+
+	market, err := MarketplaceStats(ctx, pool, StatsOptions{Interval: IntervalWeek})
+	if err != nil {
+		t.Fatalf("marketplace stats: %v", err)
+	}
+	if market.Integrations != 1 || market.Downloads != 3 || len(market.Top) != 1 || market.Top[0].Name != "Spotify" {
+		t.Fatalf("unexpected marketplace stats %+v", market)
+	}
+	if _, err := IntegrationStats(ctx, pool, "missing", StatsOptions{}); err == nil {
+		t.Fatalf("expected missing integration to fail")
+	}
+}
+
+func TestDownloadDedupAndRecompute(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	for _, client := range []string{"a", "a", "a", "b"} {
+		if _, err := IncrementDownloads(ctx, pool, "spotify", DownloadOptions{ClientHash: client, DedupWindow: time.Hour}); err != nil {
+			t.Fatalf("increment downloads: %v", err)
+		}
+	}
+	item, err := GetIntegration(ctx, pool, "spotify", "")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if item.Downloads != 2 {
+		t.Fatalf("expected repeat downloads by one client to be ignored, got %d", item.Downloads)
+	}
+
+	if err := pool.Model(&dbmodels.Integration{}).Where("id = ?", "spotify").
+		Updates(map[string]any{"downloads": 1000, "trending_score": 1000}).Error; err != nil {
+		t.Fatalf("inflate counters: %v", err)
+	}
+	if err := RecomputeDownloads(ctx, pool, time.Hour); err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+	item, err = GetIntegration(ctx, pool, "spotify", "")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if item.Downloads != 2 || item.Trending < 1.9 || item.Trending > 2 {
+		t.Fatalf("expected counters recomputed from events, got downloads=%d trending=%v", item.Downloads, item.Trending)
+	}
+}
+
+func TestDownloadRotatingInstallIDsFromOneIP(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		opts := DownloadOptions{ClientHash: fmt.Sprintf("ip-a|install-%d", i), IPHash: "ip-a", DedupWindow: time.Hour, ClientsPerIP: 3}
+		if _, err := IncrementDownloads(ctx, pool, "spotify", opts); err != nil {
+			t.Fatalf("increment downloads: %v", err)
+		}
+	}
+	opts := DownloadOptions{ClientHash: "ip-b|install-0", IPHash: "ip-b", DedupWindow: time.Hour, ClientsPerIP: 3}
+	item, err := IncrementDownloads(ctx, pool, "spotify", opts)
+	if err != nil {
+		t.Fatalf("increment downloads: %v", err)
+	}
+	if item.Downloads != 4 {
+		t.Fatalf("expected 3 installs counted for the rotating IP and 1 for another, got %d", item.Downloads)
+	}
+}
+
+func TestDownloadRollupSkipsWhileAnotherReplicaRuns(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := IncrementDownloads(ctx, pool, "spotify", DownloadOptions{ClientHash: "old"}); err != nil {
+		t.Fatalf("increment downloads: %v", err)
+	}
+	if err := pool.Model(&dbmodels.IntegrationDownloadEvent{}).Update("created_at", time.Now().AddDate(0, 0, -40)).Error; err != nil {
+		t.Fatalf("backdate event: %v", err)
+	}
+	countEvents := func() int64 {
+		var events int64
+		if err := pool.Model(&dbmodels.IntegrationDownloadEvent{}).Count(&events).Error; err != nil {
+			t.Fatalf("count events: %v", err)
+		}
+		return events
+	}
+
+	other := pool.Begin()
+	if locked, err := tryWorkerLock(other, "download rollup"); err != nil || !locked {
+		t.Fatalf("expected to take the rollup lock, got %t err=%v", locked, err)
+	}
+	if err := RollupDownloadEvents(ctx, pool, time.Now().AddDate(0, 0, -30)); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if events := countEvents(); events != 1 {
+		t.Fatalf("expected the rollup skipped while the lock is held, got %d events", events)
+	}
+	other.Rollback()
+
+	if err := RollupDownloadEvents(ctx, pool, time.Now().AddDate(0, 0, -30)); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	if events := countEvents(); events != 0 {
+		t.Fatalf("expected the event rolled up once the lock is free, got %d events", events)
+	}
+}
+
+func TestDownloadRollupAndDecay(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	for _, client := range []string{"new", "halved", "old"} {
+		if _, err := IncrementDownloads(ctx, pool, "spotify", DownloadOptions{ClientHash: client, Method: InstallHelm}); err != nil {
+			t.Fatalf("increment downloads: %v", err)
+		}
+	}
+	halfLife := 10 * 24 * time.Hour
+	for client, age := range map[string]time.Duration{"halved": halfLife, "old": 40 * 24 * time.Hour} {
+		if err := pool.Model(&dbmodels.IntegrationDownloadEvent{}).Where("client_hash = ?", client).
+			Update("created_at", time.Now().Add(-age)).Error; err != nil {
+			t.Fatalf("backdate event: %v", err)
+		}
+	}
+
+	if err := RollupDownloadEvents(ctx, pool, time.Now().Add(-30*24*time.Hour)); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	var events int64
+	if err := pool.Model(&dbmodels.IntegrationDownloadEvent{}).Count(&events).Error; err != nil {
+		t.Fatalf("count events: %v", err)
+	}
+	var daily []dbmodels.IntegrationDownloadDaily
+	if err := pool.Find(&daily).Error; err != nil {
+		t.Fatalf("list rollups: %v", err)
+	}
+	if events != 2 || len(daily) != 1 || daily[0].Downloads != 1 || daily[0].Method != InstallHelm {
+		t.Fatalf("expected the old event rolled up, got events=%d daily=%+v", events, daily)
+	}
+
+	if err := RecomputeDownloads(ctx, pool, halfLife); err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+	item, err := GetIntegration(ctx, pool, "spotify", "")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if item.Downloads != 3 || item.Trending < 1.5 || item.Trending > 1.6 {
+		t.Fatalf("expected rolled-up downloads counted and trending decayed, got downloads=%d trending=%v", item.Downloads, item.Trending)
+	}
+
+	stats, err := IntegrationStats(ctx, pool, "spotify", StatsOptions{Days: 60})
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Downloads != 3 || stats.Methods[InstallHelm] != 3 {
+		t.Fatalf("expected stats to include rollups, got %+v", stats)
+	}
+}
+
+func TestVersionDownloads(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		Version:     "v0.1.0",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	publish := func(version string) {
+		t.Helper()
+		req.Version = version
+		if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+	download := func(version string) *models.Integration {
+		t.Helper()
+		item, err := IncrementDownloads(ctx, pool, "spotify", DownloadOptions{Version: version})
+		if err != nil {
+			t.Fatalf("increment downloads: %v", err)
+		}
+		return item
+	}
+
+	publish("v0.1.0")
+	download("")
+	download("")
+	publish("v0.2.0")
+	download("v0.2.0")
+	if item := download("v0.1.0"); item.Version != "v0.1.0" || item.Downloads != 4 || item.VersionDownloads != 3 {
+		t.Fatalf("expected the downloaded version with both counts, got %s downloads=%d version_downloads=%d", item.Version, item.Downloads, item.VersionDownloads)
+	}
+
+	check := func(when string) {
+		t.Helper()
+		versions, _, err := ListVersions(ctx, pool, "spotify", Page{})
+		if err != nil {
+			t.Fatalf("versions: %v", err)
+		}
+		want := map[string]int64{"v0.2.0": 1, "v0.1.0": 3}
+		if len(versions) != len(want) {
+			t.Fatalf("%s: expected %d versions, got %d", when, len(want), len(versions))
+		}
+		for _, v := range versions {
+			if v.Downloads != 4 || v.VersionDownloads != want[v.Version] {
+				t.Fatalf("%s: %s has downloads=%d version_downloads=%d", when, v.Version, v.Downloads, v.VersionDownloads)
+			}
+		}
+	}
+	check("after downloads")
+	if err := pool.Model(&dbmodels.Integration{}).Where("id = ?", "spotify").
+		Update("downloads", 0).Error; err != nil {
+		t.Fatalf("reset counters: %v", err)
+	}
+	if err := pool.Model(&dbmodels.Release{}).Where("integration_id = ?", "spotify").
+		Update("version_downloads", 0).Error; err != nil {
+		t.Fatalf("reset counters: %v", err)
+	}
+	if err := RecomputeDownloads(ctx, pool, time.Hour); err != nil {
+		t.Fatalf("recompute: %v", err)
+	}
+	check("after recompute")
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+
+	dbmodels "github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/semver"
+	"gorm.io/gorm"
+)
+
+// CheckUpdates compares installed releases against the latest release of each
+// integration. Known reports whether the installed (id, version) is in the
+// catalog; unknown installs still get the latest version if the id exists.
+func CheckUpdates(ctx context.Context, db *gorm.DB, installed []models.InstalledIntegration, tagPrefix string) ([]models.UpdateStatus, error) {
+	out := make([]models.UpdateStatus, len(installed))
+	if len(installed) == 0 {
+		return out, nil
+	}
+
+	ids := make([]string, 0, len(installed))
+	pairs := make([][]any, 0, len(installed))
+	for _, item := range installed {
+		ids = append(ids, item.ID)
+		pairs = append(pairs, []any{item.ID, item.Version})
+	}
+
+	latestRows := []dbmodels.IntegrationVersion{}
+	if err := db.WithContext(ctx).
+		Model(&dbmodels.IntegrationVersion{}).
+		Select("id", "version").
+		Where("id IN ? AND latest = ? AND yanked = ?", ids, true, false).
+		Find(&latestRows).Error; err != nil {
+		return nil, err
+	}
+	latestByID := make(map[string]string, len(latestRows))
+	for _, row := range latestRows {
+		latestByID[row.ID] = row.Version
+	}
+
+	installedRows := []dbmodels.IntegrationVersion{}
+	if err := db.WithContext(ctx).
+		Model(&dbmodels.IntegrationVersion{}).
+		Select("id", "version", "yanked", "yank_reason", "deprecated", "deprecation_message").
+		Where("(id, version) IN ?", pairs).
+		Find(&installedRows).Error; err != nil {
+		return nil, err
+	}
+	installedByKey := make(map[[2]string]dbmodels.IntegrationVersion, len(installedRows))
+	for _, row := range installedRows {
+		installedByKey[[2]string{row.ID, row.Version}] = row
+	}
+
+	for i, item := range installed {
+		status := models.UpdateStatus{ID: item.ID, InstalledVersion: item.Version}
+		if row, ok := installedByKey[[2]string{item.ID, item.Version}]; ok {
+			status.Known = true
+			status.Yanked = row.Yanked
+			status.YankReason = row.YankReason
+			status.Deprecated = row.Deprecated
+			status.DeprecationMessage = row.DeprecationMessage
+		}
+		if latest, ok := latestByID[item.ID]; ok {
+			status.LatestVersion = latest
+			status.UpdateAvailable = isNewer(latest, item.Version, tagPrefix)
+		}
+		out[i] = status
+	}
+	return out, nil
+}
+
+// isNewer reports whether candidate should replace current. Versions that do
+// not parse as semver are only compared for equality.
+func isNewer(candidate, current, tagPrefix string) bool {
+	next, errNext := semver.Parse(candidate, tagPrefix)
+	cur, errCur := semver.Parse(current, tagPrefix)
+	if errNext != nil || errCur != nil {
+		return candidate != current
+	}
+	return next.Compare(cur) > 0
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/db"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/models"
+	"github.com/PetoAdam/homenavi-marketplace/api/internal/testutil"
+)
+
+func TestCheckUpdates(t *testing.T) {
+	pool, cleanup := testutil.StartPostgres(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	req := models.PublishRequest{
+		ID:          "spotify",
+		Name:        "Spotify",
+		ManifestURL: "https://example.com/manifest.json",
+		Manifest:    map[string]any{"id": "spotify"},
+		Image:       "ghcr.io/petoadam/homenavi-spotify:latest",
+		ListenPath:  "/integrations/spotify",
+	}
+	for _, version := range []string{"v0.1.0", "v0.2.0"} {
+		req.Version = version
+		if _, err := PublishIntegration(ctx, pool, req, PublishOptions{Verified: true, TagPrefix: "v"}); err != nil {
+			t.Fatalf("publish %s: %v", version, err)
+		}
+	}
+	if err := pool.Model(&db.Release{}).
+		Where("integration_id = ? AND version = ?", "spotify", "v0.1.0").
+		Updates(map[string]any{"deprecated": true, "deprecation_message": "upgrade to v0.2.0"}).Error; err != nil {
+		t.Fatalf("deprecate: %v", err)
+	}
+
+	updates, err := CheckUpdates(ctx, pool, []models.InstalledIntegration{
+		{ID: "spotify", Version: "v0.1.0"},
+		{ID: "spotify", Version: "v0.2.0"},
+		{ID: "unknown", Version: "v1.0.0"},
+	}, "v")
+	if err != nil {
+		t.Fatalf("check updates: %v", err)
+	}
+	if !updates[0].UpdateAvailable || updates[0].LatestVersion != "v0.2.0" || !updates[0].Deprecated {
+		t.Fatalf("expected deprecated v0.1.0 with update to v0.2.0, got %+v", updates[0])
+	}
+	if updates[1].UpdateAvailable || !updates[1].Known {
+		t.Fatalf("expected v0.2.0 to be current, got %+v", updates[1])
+	}
+	if updates[2].Known || updates[2].LatestVersion != "" {
+		t.Fatalf("expected unknown integration, got %+v", updates[2])
+	}
+}
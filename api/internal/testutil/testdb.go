@@ -2,6 +2,11 @@ package testutil
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,15 +17,76 @@ import (
 	"gorm.io/gorm"
 )
 
+// templateDatabase is migrated once per container and cloned for every test.
+const templateDatabase = "marketplace"
+
+// shared is the container of the running test binary. It is started by the
+// first StartPostgres call, so packages whose tests all skip the database
+// never start one, and terminated by Main.
+var shared struct {
+	once      sync.Once
+	err       error
+	container *postgres.PostgresContainer
+	dsn       *url.URL
+	admin     *gorm.DB
+	databases atomic.Int64
+}
+
+// Main runs the tests of a package that uses StartPostgres and terminates
+// the shared container afterwards. Call it from TestMain:
+//
+//	func TestMain(m *testing.M) { testutil.Main(m) }
+func Main(m *testing.M) {
+	code := m.Run()
+	if shared.admin != nil {
+		if sqlDB, _ := shared.admin.DB(); sqlDB != nil {
+			sqlDB.Close()
+		}
+	}
+	if shared.container != nil {
+		_ = shared.container.Terminate(context.Background())
+	}
+	os.Exit(code)
+}
+
+// StartPostgres returns a freshly migrated database of its own in the
+// package's shared container. cleanup drops it.
 func StartPostgres(t *testing.T) (*gorm.DB, func()) {
 	t.Helper()
 
+	shared.once.Do(func() { shared.err = startShared() })
+	if shared.err != nil {
+		t.Fatalf("start postgres: %v", shared.err)
+	}
+
+	name := fmt.Sprintf("test_%d", shared.databases.Add(1))
+	if err := shared.admin.Exec(fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", name, templateDatabase)).Error; err != nil {
+		t.Fatalf("create database: %v", err)
+	}
+	gormDB, err := connect(context.Background(), name)
+	if err != nil {
+		t.Fatalf("db connect: %v", err)
+	}
+
+	cleanup := func() {
+		sqlDB, _ := gormDB.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+		_ = shared.admin.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s WITH (FORCE)", name)).Error
+	}
+
+	return gormDB, cleanup
+}
+
+// startShared starts the container and migrates the template database.
+func startShared() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
 	container, err := postgres.RunContainer(
 		ctx,
-		postgres.WithDatabase("marketplace"),
+		postgres.WithDatabase(templateDatabase),
 		postgres.WithUsername("postgres"),
 		postgres.WithPassword("postgres"),
 		testcontainers.WithImage("postgres:15-alpine"),
@@ -32,53 +98,58 @@ func StartPostgres(t *testing.T) (*gorm.DB, func()) {
 		),
 	)
 	if err != nil {
-		t.Fatalf("start postgres: %v", err)
+		return err
 	}
+	shared.container = container
 
 	conn, err := container.ConnectionString(ctx, "sslmode=disable")
 	if err != nil {
-		_ = container.Terminate(ctx)
-		t.Fatalf("connection string: %v", err)
+		return fmt.Errorf("connection string: %w", err)
+	}
+	if shared.dsn, err = url.Parse(conn); err != nil {
+		return fmt.Errorf("connection string: %w", err)
 	}
 
+	template, err := connect(ctx, templateDatabase)
+	if err != nil {
+		return fmt.Errorf("db connect: %w", err)
+	}
+	migrateErr := db.Migrate(ctx, template)
+	// A template cannot be cloned while anything is connected to it.
+	if sqlDB, _ := template.DB(); sqlDB != nil {
+		sqlDB.Close()
+	}
+	if migrateErr != nil {
+		return fmt.Errorf("db migrate: %w", migrateErr)
+	}
+
+	if shared.admin, err = connect(ctx, "postgres"); err != nil {
+		return fmt.Errorf("db connect: %w", err)
+	}
+	return nil
+}
+
+// connect opens the named database, retrying while the server settles.
+func connect(ctx context.Context, name string) (*gorm.DB, error) {
+	dsn := *shared.dsn
+	dsn.Path = "/" + name
+
 	var gormDB *gorm.DB
 	var lastErr error
 	for attempt := 0; attempt < 10; attempt++ {
-		gormDB, lastErr = db.Connect(conn)
+		gormDB, lastErr = db.Connect(dsn.String())
 		if lastErr == nil {
 			sqlDB, err := gormDB.DB()
 			if err == nil {
 				pingErr := sqlDB.PingContext(ctx)
 				if pingErr == nil {
-					lastErr = nil
-					break
+					return gormDB, nil
 				}
+				sqlDB.Close()
 				lastErr = pingErr
 			}
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
-	if lastErr != nil {
-		_ = container.Terminate(ctx)
-		t.Fatalf("db connect: %v", lastErr)
-	}
-
-	if err := db.Migrate(ctx, gormDB); err != nil {
-		sqlDB, _ := gormDB.DB()
-		if sqlDB != nil {
-			sqlDB.Close()
-		}
-		_ = container.Terminate(ctx)
-		t.Fatalf("db migrate: %v", err)
-	}
-
-	cleanup := func() {
-		sqlDB, _ := gormDB.DB()
-		if sqlDB != nil {
-			sqlDB.Close()
-		}
-		_ = container.Terminate(ctx)
-	}
-
-	return gormDB, cleanup
+	return nil, lastErr
 }
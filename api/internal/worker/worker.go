@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every runs fn immediately and then every interval until ctx is done.
+// Failures are logged and retried on the next tick.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	if interval <= 0 {
+		log.Printf("worker %s disabled", name)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		start := time.Now()
+		if err := fn(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("worker %s failed: %v", name, err)
+		} else if err == nil {
+			log.Printf("worker %s done in %s", name, time.Since(start))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
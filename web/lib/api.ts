@@ -51,15 +51,22 @@ class MarketplaceApi {
   }
 
   async listIntegrations(): Promise<Integration[]> {
+    const items: Integration[] = [];
+    let cursor: string | null = null;
     try {
-      const res = await fetch(this.buildUrl('/integrations'), { cache: 'no-store' });
-      if (!res.ok) {
-        return [];
-      }
-      const data = await res.json();
-      return data.integrations || [];
+      do {
+        const query: string = cursor ? `?limit=200&cursor=${encodeURIComponent(cursor)}` : '?limit=200';
+        const res = await fetch(this.buildUrl(`/integrations${query}`), { cache: 'no-store' });
+        if (!res.ok) {
+          return items;
+        }
+        const data = await res.json();
+        items.push(...(data.integrations || []));
+        cursor = data.next_cursor || null;
+      } while (cursor);
+      return items;
     } catch {
-      return [];
+      return items;
     }
   }
 